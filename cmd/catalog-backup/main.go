@@ -0,0 +1,105 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/say8hi/go-api-test/internal/backup"
+	"github.com/say8hi/go-api-test/internal/database"
+)
+
+const usage = `Usage:
+  catalog-backup backup -o file              write a backup archive
+  catalog-backup restore [-i file] [-verify] restore an archive into an empty database (default: stdin)
+
+The database is configured with DB_USER, DB_PASSWORD, DB_HOST, DB_PORT and DB_NAME.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	switch os.Args[1] {
+	case "backup":
+		runBackup(os.Args[2:])
+	case "restore":
+		runRestore(os.Args[2:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
+
+func runBackup(args []string) {
+	flags := flag.NewFlagSet("backup", flag.ExitOnError)
+	output := flags.String("o", "", "Archive file to write")
+	flags.Parse(args)
+
+	// The database package logs to stdout, so the archive can't go there.
+	if *output == "" {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	file, err := os.Create(*output)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	database.Init()
+	defer database.CloseConnection()
+
+	summary, err := database.BackupCatalog(file)
+	if err == nil {
+		err = file.Close()
+	}
+	if err != nil {
+		os.Remove(*output)
+		log.Fatalf("Backup failed: %s", err)
+	}
+	printSummary("Backed up", summary)
+}
+
+func runRestore(args []string) {
+	flags := flag.NewFlagSet("restore", flag.ExitOnError)
+	input := flags.String("i", "", "Archive file to read")
+	verify := flags.Bool("verify", false, "Compare counts and checksums of the restored data with the archive")
+	flags.Parse(args)
+
+	var r io.Reader = os.Stdin
+	if *input != "" {
+		file, err := os.Open(*input)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer file.Close()
+		r = file
+	}
+
+	database.Init()
+	defer database.CloseConnection()
+	database.CreateTables()
+	database.Migrate()
+
+	summary, err := database.RestoreCatalog(r, *verify)
+	if err != nil {
+		log.Fatalf("Restore failed: %s", err)
+	}
+	printSummary("Restored", summary)
+	if *verify {
+		fmt.Println("Counts and checksums match the archive")
+	}
+}
+
+func printSummary(action string, summary backup.Summary) {
+	fmt.Printf("%s %d users, %d categories, %d products, %d exchange rates, %d product relations, %d promotions, %d scheduled changes, %d orders\n", action,
+		summary.Counts[backup.KindUser], summary.Counts[backup.KindCategory],
+		summary.Counts[backup.KindProduct], summary.Counts[backup.KindExchangeRate],
+		summary.Counts[backup.KindRelation], summary.Counts[backup.KindPromotion],
+		summary.Counts[backup.KindScheduledChange], summary.Counts[backup.KindOrder])
+}
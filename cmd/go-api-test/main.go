@@ -1,12 +1,14 @@
 package main
 
 import (
+	"expvar"
 	"log"
 	"net/http"
 
 	"github.com/gorilla/mux"
 	"github.com/say8hi/go-api-test/internal/database"
 	"github.com/say8hi/go-api-test/internal/handlers"
+	"github.com/say8hi/go-api-test/internal/media"
 	"github.com/say8hi/go-api-test/internal/middlewares"
 	"github.com/say8hi/go-api-test/internal/rabbitmq"
 )
@@ -14,6 +16,8 @@ import (
 func main() {
 	database.Init()
 	database.CreateTables()
+	database.Migrate()
+	media.Init()
   defer database.CloseConnection()
   
   rabbitMQChannel := rabbitmq.InitRabbitMQ()
@@ -21,33 +25,148 @@ func main() {
 
 	r := mux.NewRouter()
 	r.Use(middlewares.LoggingMiddleware)
+	r.Use(middlewares.OptionalAuthMiddleware)
 
 	authRouter := r.NewRoute().Subrouter()
 	authRouter.Use(middlewares.AuthMiddleware)
 
+	adminRouter := authRouter.NewRoute().Subrouter()
+	adminRouter.Use(middlewares.AdminMiddleware)
+
 	// Unauthorized endpoints
 	// Users
 	r.HandleFunc("/users/create", handlers.CreateUserHandler).Methods("POST")
 
 	// Categories
 	r.HandleFunc("/category/{id:[0-9]+}", handlers.GetCategoryByIDHandler).Methods("GET")
+	r.HandleFunc("/category/by-slug/{slug}", handlers.GetCategoryBySlugHandler).Methods("GET")
 	r.HandleFunc("/category/", handlers.GetAllCategoriesHandler).Methods("GET")
+	r.HandleFunc("/category/tree", handlers.GetCategoryTreeHandler).Methods("GET")
+	r.HandleFunc("/category/{id:[0-9]+}/tree", handlers.GetCategorySubtreeHandler).Methods("GET")
+	r.HandleFunc("/category/{id:[0-9]+}/path", handlers.GetCategoryPathHandler).Methods("GET")
+	r.HandleFunc("/category/{id:[0-9]+}/attributes", handlers.GetCategoryAttributesHandler).Methods("GET")
+	r.HandleFunc("/category/{id:[0-9]+}/translations", handlers.GetCategoryTranslationsHandler).Methods("GET")
 
 	// Products
 	r.HandleFunc("/product/{id:[0-9]+}", handlers.GetProductByIDHandler).Methods("GET")
+	r.HandleFunc("/product/by-slug/{slug}", handlers.GetProductBySlugHandler).Methods("GET")
 	r.HandleFunc("/category/{id:[0-9]+}/products", handlers.GetAllProductsInCategoryHandler).Methods("GET")
+	r.HandleFunc("/product/{id:[0-9]+}/prices", handlers.GetProductPricesHandler).Methods("GET")
+	r.HandleFunc("/product/{id:[0-9]+}/variants", handlers.GetProductVariantsHandler).Methods("GET")
+	r.HandleFunc("/product/{id:[0-9]+}/variants/{variantID:[0-9]+}", handlers.GetProductVariantHandler).Methods("GET")
+	r.HandleFunc("/product/{id:[0-9]+}/stock", handlers.GetProductStockHandler).Methods("GET")
+	r.HandleFunc("/product/{id:[0-9]+}/images", handlers.GetProductImagesHandler).Methods("GET")
+	r.HandleFunc("/product/{id:[0-9]+}/tags", handlers.GetProductTagsHandler).Methods("GET")
+	r.HandleFunc("/product/{id:[0-9]+}/translations", handlers.GetProductTranslationsHandler).Methods("GET")
+	r.HandleFunc("/product/{id:[0-9]+}/reviews", handlers.GetProductReviewsHandler).Methods("GET")
+	r.HandleFunc("/product/{id:[0-9]+}/related", handlers.GetRelatedProductsHandler).Methods("GET")
+
+	// Tags
+	r.HandleFunc("/tags/", handlers.GetTagsHandler).Methods("GET")
+	r.HandleFunc("/tags/{tag}/products", handlers.GetProductsByTagHandler).Methods("GET")
+
+	// Media
+	if handler := media.Handler(); handler != nil {
+		r.PathPrefix("/media/").Handler(http.StripPrefix("/media/", handler)).Methods("GET", "HEAD")
+	}
+
+	// Exchange rates
+	r.HandleFunc("/exchange-rates/", handlers.GetExchangeRatesHandler).Methods("GET")
 
 	// Authorized endpoints
 	// Categories
 	authRouter.HandleFunc("/category/create", handlers.CreateCategoryHandler).Methods("POST")
 	authRouter.HandleFunc("/category/{id:[0-9]+}", handlers.UpdateCategoryHandler).Methods("PATCH")
 	authRouter.HandleFunc("/category/{id:[0-9]+}", handlers.DeleteCategoryHandler).Methods("DELETE")
+	authRouter.HandleFunc("/category/{id:[0-9]+}/parent", handlers.MoveCategoryHandler).Methods("PUT")
+	authRouter.HandleFunc("/category/order", handlers.ReorderCategoriesHandler).Methods("PUT")
+	authRouter.HandleFunc("/category/{id:[0-9]+}/products/order", handlers.ReorderCategoryProductsHandler).Methods("PUT")
+	authRouter.HandleFunc("/category/{id:[0-9]+}/attributes", handlers.CreateAttributeHandler).Methods("POST")
+	authRouter.HandleFunc("/category/{id:[0-9]+}/attributes/{attributeID:[0-9]+}", handlers.UpdateAttributeHandler).Methods("PATCH")
+	authRouter.HandleFunc("/category/{id:[0-9]+}/attributes/{attributeID:[0-9]+}", handlers.DeleteAttributeHandler).Methods("DELETE")
+	authRouter.HandleFunc("/category/{id:[0-9]+}/translations/{locale}", handlers.SetCategoryTranslationHandler).Methods("PUT")
+	authRouter.HandleFunc("/category/{id:[0-9]+}/translations/{locale}", handlers.DeleteCategoryTranslationHandler).Methods("DELETE")
 
 	// Products
 	authRouter.HandleFunc("/product/create", handlers.CreateProductHandler).Methods("POST")
+	authRouter.HandleFunc("/product/batch", handlers.BatchProductsHandler).Methods("POST")
 	authRouter.HandleFunc("/product/{id:[0-9]+}", handlers.UpdateProductHandler).Methods("PATCH")
 	authRouter.HandleFunc("/product/{id:[0-9]+}", handlers.DeleteProductHandler).Methods("DELETE")
+	authRouter.HandleFunc("/product/{id:[0-9]+}/status", handlers.SetProductStatusHandler).Methods("PUT")
+	authRouter.HandleFunc("/product/{id:[0-9]+}/archive", handlers.ArchiveProductHandler).Methods("POST")
+	authRouter.HandleFunc("/product/{id:[0-9]+}/prices/{currency:[A-Za-z]{3}}", handlers.SetProductPriceHandler).Methods("PUT")
+	authRouter.HandleFunc("/product/{id:[0-9]+}/prices/{currency:[A-Za-z]{3}}", handlers.DeleteProductPriceHandler).Methods("DELETE")
+	authRouter.HandleFunc("/product/{id:[0-9]+}/variants", handlers.CreateVariantHandler).Methods("POST")
+	authRouter.HandleFunc("/product/{id:[0-9]+}/variants/{variantID:[0-9]+}", handlers.UpdateVariantHandler).Methods("PATCH")
+	authRouter.HandleFunc("/product/{id:[0-9]+}/variants/{variantID:[0-9]+}", handlers.DeleteVariantHandler).Methods("DELETE")
+	authRouter.HandleFunc("/product/{id:[0-9]+}/images", handlers.UploadProductImageHandler).Methods("POST")
+	authRouter.HandleFunc("/product/{id:[0-9]+}/images/order", handlers.ReorderProductImagesHandler).Methods("PUT")
+	authRouter.HandleFunc("/product/{id:[0-9]+}/images/{imageID:[0-9]+}/primary", handlers.SetPrimaryImageHandler).Methods("PUT")
+	authRouter.HandleFunc("/product/{id:[0-9]+}/images/{imageID:[0-9]+}", handlers.DeleteProductImageHandler).Methods("DELETE")
+	authRouter.HandleFunc("/product/{id:[0-9]+}/tags", handlers.TagProductHandler).Methods("POST")
+	authRouter.HandleFunc("/product/{id:[0-9]+}/tags/{tag}", handlers.UntagProductHandler).Methods("DELETE")
+	authRouter.HandleFunc("/product/{id:[0-9]+}/translations/{locale}", handlers.SetProductTranslationHandler).Methods("PUT")
+	authRouter.HandleFunc("/product/{id:[0-9]+}/translations/{locale}", handlers.DeleteProductTranslationHandler).Methods("DELETE")
+	authRouter.HandleFunc("/product/{id:[0-9]+}/related/{relatedID:[0-9]+}", handlers.SetProductRelationHandler).Methods("PUT")
+	authRouter.HandleFunc("/product/{id:[0-9]+}/related/{relatedID:[0-9]+}", handlers.DeleteProductRelationHandler).Methods("DELETE")
+
+	// Scheduled changes
+	authRouter.HandleFunc("/product/{id:[0-9]+}/scheduled-changes", handlers.ScheduleProductChangeHandler).Methods("POST")
+	authRouter.HandleFunc("/product/{id:[0-9]+}/scheduled-changes", handlers.GetProductScheduledChangesHandler).Methods("GET")
+	authRouter.HandleFunc("/scheduled-changes/", handlers.GetScheduledChangesHandler).Methods("GET")
+	authRouter.HandleFunc("/scheduled-changes/{id:[0-9]+}", handlers.GetScheduledChangeHandler).Methods("GET")
+	authRouter.HandleFunc("/scheduled-changes/{id:[0-9]+}/cancel", handlers.CancelScheduledChangeHandler).Methods("POST")
+
+	// Reviews
+	authRouter.HandleFunc("/product/{id:[0-9]+}/reviews", handlers.CreateReviewHandler).Methods("POST")
+	authRouter.HandleFunc("/reviews/{id:[0-9]+}", handlers.UpdateReviewHandler).Methods("PUT")
+	authRouter.HandleFunc("/reviews/{id:[0-9]+}", handlers.DeleteReviewHandler).Methods("DELETE")
+	adminRouter.HandleFunc("/reviews/", handlers.GetReviewsHandler).Methods("GET")
+	adminRouter.HandleFunc("/reviews/{id:[0-9]+}/status", handlers.SetReviewStatusHandler).Methods("PUT")
+
+	// Cart and orders
+	authRouter.HandleFunc("/cart", handlers.GetCartHandler).Methods("GET")
+	authRouter.HandleFunc("/cart/items", handlers.AddCartItemHandler).Methods("POST")
+	authRouter.HandleFunc("/cart/items/{id:[0-9]+}", handlers.UpdateCartItemHandler).Methods("PATCH")
+	authRouter.HandleFunc("/cart/items/{id:[0-9]+}", handlers.RemoveCartItemHandler).Methods("DELETE")
+	authRouter.HandleFunc("/cart/checkout", handlers.CheckoutHandler).Methods("POST")
+	authRouter.HandleFunc("/orders/", handlers.GetOrdersHandler).Methods("GET")
+	authRouter.HandleFunc("/orders/{id:[0-9]+}", handlers.GetOrderHandler).Methods("GET")
+	authRouter.HandleFunc("/orders/{id:[0-9]+}/cancel", handlers.CancelOrderHandler).Methods("POST")
+	adminRouter.HandleFunc("/orders/{id:[0-9]+}/status", handlers.SetOrderStatusHandler).Methods("PUT")
+
+	// Promotions
+	adminRouter.HandleFunc("/promotions/", handlers.GetPromotionsHandler).Methods("GET")
+	adminRouter.HandleFunc("/promotions/", handlers.CreatePromotionHandler).Methods("POST")
+	adminRouter.HandleFunc("/promotions/{id:[0-9]+}", handlers.GetPromotionHandler).Methods("GET")
+	adminRouter.HandleFunc("/promotions/{id:[0-9]+}", handlers.UpdatePromotionHandler).Methods("PUT")
+	adminRouter.HandleFunc("/promotions/{id:[0-9]+}", handlers.DeletePromotionHandler).Methods("DELETE")
+
+	// Stock
+	authRouter.HandleFunc("/product/{id:[0-9]+}/stock/adjustments", handlers.AdjustStockHandler).Methods("POST")
+	authRouter.HandleFunc("/product/{id:[0-9]+}/stock/reservations", handlers.ReserveStockHandler).Methods("POST")
+	authRouter.HandleFunc("/stock/reservations/{id:[0-9]+}", handlers.GetReservationHandler).Methods("GET")
+	authRouter.HandleFunc("/stock/reservations/{id:[0-9]+}/commit", handlers.CommitReservationHandler).Methods("POST")
+	authRouter.HandleFunc("/stock/reservations/{id:[0-9]+}", handlers.ReleaseReservationHandler).Methods("DELETE")
+	authRouter.HandleFunc("/stock/low", handlers.GetLowStockHandler).Methods("GET")
+
+	// Exchange rates
+	authRouter.HandleFunc("/exchange-rates/import", handlers.ImportExchangeRatesHandler).Methods("POST")
+	authRouter.HandleFunc("/exchange-rates/{base:[A-Za-z]{3}}/{quote:[A-Za-z]{3}}", handlers.SetExchangeRateHandler).Methods("PUT")
+	authRouter.HandleFunc("/exchange-rates/{base:[A-Za-z]{3}}/{quote:[A-Za-z]{3}}", handlers.DeleteExchangeRateHandler).Methods("DELETE")
+
+	// Bulk export and import
+	authRouter.HandleFunc("/export/products", handlers.ExportProductsHandler).Methods("GET")
+	authRouter.HandleFunc("/export/categories", handlers.ExportCategoriesHandler).Methods("GET")
+	authRouter.HandleFunc("/import/products", handlers.ImportProductsHandler).Methods("POST")
+	authRouter.HandleFunc("/import/categories", handlers.ImportCategoriesHandler).Methods("POST")
+
+	// Metrics
+	adminRouter.Handle("/debug/vars", expvar.Handler()).Methods("GET")
   
   go rabbitmq.ConsumeMessages(rabbitMQChannel, "queue_from_datacollector")
+	go rabbitmq.RunOutboxRelay()
+	go database.RunReservationExpiry()
+	go database.RunScheduler()
 	log.Fatal(http.ListenAndServe(":8080", r))
 }
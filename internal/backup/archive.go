@@ -0,0 +1,689 @@
+// Package backup reads and writes logical catalog archives.
+//
+// An archive is gzip-compressed JSON Lines. The first line is a header with
+// the format version, then come the records of every kind in dependency
+// order, and the last line is a trailer with the count and checksum of every
+// kind. Records keep their original IDs so references inside the archive
+// resolve, but checksums are computed from their content only, so a restore
+// into a database that assigns different IDs verifies against the same
+// trailer. Image files aren't part of the archive, only the image records
+// that point to them.
+package backup
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/say8hi/go-api-test/internal/models"
+	"github.com/say8hi/go-api-test/internal/money"
+)
+
+const (
+	Format  = "go-api-test-catalog"
+	Version = 2
+)
+
+// Kinds of archive lines. Records appear in the order below, so every record
+// only references records that were read before it.
+const (
+	KindHeader          = "header"
+	KindUser            = "user"
+	KindCategory        = "category"
+	KindProduct         = "product"
+	KindExchangeRate    = "exchange_rate"
+	KindRelation        = "product_relation"
+	KindPromotion       = "promotion"
+	KindScheduledChange = "scheduled_change"
+	KindOrder           = "order"
+	KindTrailer         = "trailer"
+)
+
+var recordKinds = []string{KindUser, KindCategory, KindProduct, KindExchangeRate,
+	KindRelation, KindPromotion, KindScheduledChange, KindOrder}
+
+var ErrCorrupt = errors.New("corrupt backup archive")
+
+type Header struct {
+	Format    string    `json:"format"`
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type User struct {
+	ID           int    `json:"id"`
+	Username     string `json:"username"`
+	FullName     string `json:"full_name"`
+	PasswordHash string `json:"password_hash"`
+}
+
+// Category references its parent by archive ID. A parent may come after its
+// children in the archive. Position orders the category among its siblings.
+type Category struct {
+	ID           int                  `json:"id"`
+	Name         string               `json:"name"`
+	Slug         string               `json:"slug,omitempty"`
+	Description  string               `json:"description"`
+	ParentID     *int                 `json:"parent_id,omitempty"`
+	Position     *int                 `json:"position,omitempty"`
+	Attributes   []Attribute          `json:"attributes,omitempty"`
+	Translations []models.Translation `json:"translations,omitempty"`
+}
+
+type Attribute struct {
+	Name          string        `json:"name"`
+	Type          string        `json:"type"`
+	Required      bool          `json:"required"`
+	AllowedValues []interface{} `json:"allowed_values,omitempty"`
+}
+
+// Product references its categories by their archive IDs, and Positions
+// holds its position in those of its categories that were ordered. Stock is
+// the stock on hand of the product itself and is nil when stock isn't
+// tracked, like the Stock of a variant. An empty Status means active.
+type Product struct {
+	ID           int                   `json:"id"`
+	ExternalID   string                `json:"external_id"`
+	Name         string                `json:"name"`
+	Slug         string                `json:"slug,omitempty"`
+	Description  string                `json:"description"`
+	Price        money.Amount          `json:"price"`
+	Currency     string                `json:"currency"`
+	Status       string                `json:"status,omitempty"`
+	Categories   []int                 `json:"categories"`
+	Positions    map[int]int           `json:"positions,omitempty"`
+	Prices       []models.ProductPrice `json:"prices"`
+	Variants     []Variant             `json:"variants,omitempty"`
+	Stock        *int                  `json:"stock,omitempty"`
+	Attributes   models.Attributes     `json:"attributes,omitempty"`
+	Tags         []string              `json:"tags,omitempty"`
+	Translations []models.Translation  `json:"translations,omitempty"`
+	Reviews      []Review              `json:"reviews,omitempty"`
+	Images       []Image               `json:"images,omitempty"`
+}
+
+type Variant struct {
+	SKU       string            `json:"sku"`
+	Options   map[string]string `json:"options"`
+	Price     *money.Amount     `json:"price,omitempty"`
+	Available bool              `json:"available"`
+	Stock     *int              `json:"stock,omitempty"`
+}
+
+// Review references its author by username.
+type Review struct {
+	Username  string    `json:"username"`
+	Rating    int       `json:"rating"`
+	Text      string    `json:"text"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Image is an image record of a product. ObjectKey and ThumbnailKey name the
+// stored files of an uploaded image and are empty for an image linked by URL.
+type Image struct {
+	URL          string    `json:"url"`
+	ThumbnailURL string    `json:"thumbnail_url,omitempty"`
+	ObjectKey    string    `json:"object_key,omitempty"`
+	ThumbnailKey string    `json:"thumbnail_key,omitempty"`
+	ContentType  string    `json:"content_type,omitempty"`
+	Width        int       `json:"width,omitempty"`
+	Height       int       `json:"height,omitempty"`
+	Size         int       `json:"size,omitempty"`
+	Position     int       `json:"position"`
+	Primary      bool      `json:"primary"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type ExchangeRate struct {
+	Base      string     `json:"base"`
+	Quote     string     `json:"quote"`
+	Rate      money.Rate `json:"rate"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// Relation links two products by their archive IDs.
+type Relation struct {
+	ProductID int       `json:"product_id"`
+	RelatedID int       `json:"related_id"`
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Promotion references the category or product in its scope by archive ID.
+type Promotion struct {
+	ID         int          `json:"id"`
+	Name       string       `json:"name"`
+	Kind       string       `json:"kind"`
+	Value      money.Amount `json:"value"`
+	Currency   string       `json:"currency,omitempty"`
+	Scope      string       `json:"scope"`
+	CategoryID *int         `json:"category_id,omitempty"`
+	ProductID  *int         `json:"product_id,omitempty"`
+	StartsAt   *time.Time   `json:"starts_at,omitempty"`
+	EndsAt     *time.Time   `json:"ends_at,omitempty"`
+	Stackable  bool         `json:"stackable"`
+	Priority   int          `json:"priority"`
+	CreatedAt  time.Time    `json:"created_at"`
+}
+
+// ScheduledChange references its product by archive ID and the user who
+// scheduled it by username. CreatedBy is empty once that user is deleted.
+type ScheduledChange struct {
+	ID              int             `json:"id"`
+	ProductID       int             `json:"product_id"`
+	Changes         json.RawMessage `json:"changes"`
+	EffectiveAt     time.Time       `json:"effective_at"`
+	Status          string          `json:"status"`
+	Error           string          `json:"error,omitempty"`
+	CreatedBy       string          `json:"created_by,omitempty"`
+	CreatedAt       time.Time       `json:"created_at"`
+	StatusUpdatedAt time.Time       `json:"status_updated_at"`
+}
+
+// Order references its customer by username.
+type Order struct {
+	ID              int          `json:"id"`
+	Username        string       `json:"username"`
+	Status          string       `json:"status"`
+	Currency        string       `json:"currency"`
+	Total           money.Amount `json:"total"`
+	CreatedAt       time.Time    `json:"created_at"`
+	StatusUpdatedAt time.Time    `json:"status_updated_at"`
+	Items           []OrderItem  `json:"items"`
+}
+
+// OrderItem references its product by archive ID and its variant by the SKU
+// the variant has now; both are empty once deleted. Stocked tells whether
+// the item took stock, which cancelling the order puts back.
+type OrderItem struct {
+	ProductID   *int         `json:"product_id,omitempty"`
+	VariantSKU  string       `json:"variant_sku,omitempty"`
+	ProductName string       `json:"product_name"`
+	SKU         string       `json:"sku,omitempty"`
+	Quantity    int          `json:"quantity"`
+	UnitPrice   money.Amount `json:"unit_price"`
+	Stocked     bool         `json:"stocked,omitempty"`
+}
+
+// Summary is the trailer of an archive: the number of records and the content
+// checksum of every kind.
+type Summary struct {
+	Counts    map[string]int    `json:"counts"`
+	Checksums map[string]string `json:"checksums"`
+}
+
+// Compare returns an error describing every kind whose count or checksum
+// differs from other. Checksums of kinds without records aren't compared, as
+// archives of earlier versions have none for kinds they don't know.
+func (s Summary) Compare(other Summary) error {
+	var mismatches []string
+	for _, kind := range recordKinds {
+		if s.Counts[kind] != other.Counts[kind] {
+			mismatches = append(mismatches, fmt.Sprintf("%s count %d != %d", kind, s.Counts[kind], other.Counts[kind]))
+		} else if s.Counts[kind] > 0 && s.Checksums[kind] != other.Checksums[kind] {
+			mismatches = append(mismatches, fmt.Sprintf("%s checksum differs", kind))
+		}
+	}
+	if len(mismatches) > 0 {
+		return fmt.Errorf("backup mismatch: %v", mismatches)
+	}
+	return nil
+}
+
+type line struct {
+	Kind string          `json:"kind"`
+	Data json.RawMessage `json:"data"`
+}
+
+// Checksum accumulates the counts and content checksums of records.
+// Categories and products are identified by name wherever they are
+// referenced, so the checksum doesn't depend on IDs. Categories are hashed in Summary, once all
+// parents are known. Slugs are left out, as restoring an archive written
+// before slugs existed generates them.
+type Checksum struct {
+	counts          map[string]int
+	hashes          map[string]hash.Hash
+	categories      map[int]string
+	categoryRecords []Category
+	products        map[int]string
+}
+
+func NewChecksum() *Checksum {
+	c := &Checksum{counts: map[string]int{}, hashes: map[string]hash.Hash{}, categories: map[int]string{}, products: map[int]string{}}
+	for _, kind := range recordKinds {
+		c.hashes[kind] = sha256.New()
+	}
+	return c
+}
+
+func (c *Checksum) AddUser(u User) {
+	c.add(KindUser, []interface{}{u.Username, u.FullName, u.PasswordHash})
+}
+
+func (c *Checksum) AddCategory(cat Category) {
+	c.categories[cat.ID] = cat.Name
+	c.categoryRecords = append(c.categoryRecords, cat)
+}
+
+func (c *Checksum) AddProduct(p Product) {
+	c.products[p.ID] = p.Name
+
+	categories := make([]string, 0, len(p.Categories))
+	for _, id := range p.Categories {
+		categories = append(categories, c.categories[id])
+	}
+	sort.Strings(categories)
+
+	prices := make([][]string, 0, len(p.Prices))
+	for _, price := range p.Prices {
+		prices = append(prices, []string{price.Currency, price.Amount.String()})
+	}
+	sort.Slice(prices, func(i, j int) bool { return prices[i][0] < prices[j][0] })
+
+	fields := []interface{}{p.ExternalID, p.Name, p.Description, p.Price.String(), p.Currency, categories, prices}
+	if len(p.Positions) > 0 {
+		positions := make(map[string]int, len(p.Positions))
+		for id, position := range p.Positions {
+			positions[c.categories[id]] = position
+		}
+		fields = append(fields, "positions", positions)
+	}
+	if len(p.Variants) > 0 {
+		variants := make([][]interface{}, 0, len(p.Variants))
+		for _, v := range p.Variants {
+			price := ""
+			if v.Price != nil {
+				price = v.Price.String()
+			}
+			fields := []interface{}{v.SKU, v.Options, price, v.Available}
+			if v.Stock != nil {
+				fields = append(fields, *v.Stock)
+			}
+			variants = append(variants, fields)
+		}
+		sort.Slice(variants, func(i, j int) bool { return variants[i][0].(string) < variants[j][0].(string) })
+		fields = append(fields, variants)
+	}
+	if p.Stock != nil {
+		fields = append(fields, "stock", *p.Stock)
+	}
+	if len(p.Attributes) > 0 {
+		fields = append(fields, "attributes", p.Attributes)
+	}
+	if p.Status != "" && p.Status != models.StatusActive {
+		fields = append(fields, "status", p.Status)
+	}
+	if len(p.Tags) > 0 {
+		tags := append([]string(nil), p.Tags...)
+		sort.Strings(tags)
+		fields = append(fields, "tags", tags)
+	}
+	if len(p.Translations) > 0 {
+		fields = append(fields, "translations", sortedTranslations(p.Translations))
+	}
+	if len(p.Reviews) > 0 {
+		reviews := make([][]interface{}, 0, len(p.Reviews))
+		for _, r := range p.Reviews {
+			reviews = append(reviews, []interface{}{r.Username, r.Rating, r.Text, r.Status,
+				formatTime(r.CreatedAt), formatTime(r.UpdatedAt)})
+		}
+		sort.Slice(reviews, func(i, j int) bool { return reviews[i][0].(string) < reviews[j][0].(string) })
+		fields = append(fields, "reviews", reviews)
+	}
+	if len(p.Images) > 0 {
+		images := make([][]interface{}, 0, len(p.Images))
+		for _, i := range p.Images {
+			images = append(images, []interface{}{i.URL, i.ThumbnailURL, i.ObjectKey, i.ThumbnailKey, i.ContentType,
+				i.Width, i.Height, i.Size, i.Position, i.Primary, formatTime(i.CreatedAt)})
+		}
+		fields = append(fields, "images", images)
+	}
+
+	c.add(KindProduct, fields)
+}
+
+func (c *Checksum) AddExchangeRate(r ExchangeRate) {
+	c.add(KindExchangeRate, []interface{}{r.Base, r.Quote, r.Rate.String(), formatTime(r.UpdatedAt)})
+}
+
+func (c *Checksum) AddRelation(r Relation) {
+	c.add(KindRelation, []interface{}{c.products[r.ProductID], c.products[r.RelatedID], r.Type, formatTime(r.CreatedAt)})
+}
+
+func (c *Checksum) AddPromotion(p Promotion) {
+	var category, product, startsAt, endsAt string
+	if p.CategoryID != nil {
+		category = c.categories[*p.CategoryID]
+	}
+	if p.ProductID != nil {
+		product = c.products[*p.ProductID]
+	}
+	if p.StartsAt != nil {
+		startsAt = formatTime(*p.StartsAt)
+	}
+	if p.EndsAt != nil {
+		endsAt = formatTime(*p.EndsAt)
+	}
+	c.add(KindPromotion, []interface{}{p.Name, p.Kind, p.Value.String(), p.Currency, p.Scope, category, product,
+		startsAt, endsAt, p.Stackable, p.Priority, formatTime(p.CreatedAt)})
+}
+
+func (c *Checksum) AddScheduledChange(s ScheduledChange) {
+	c.add(KindScheduledChange, []interface{}{c.products[s.ProductID], s.Changes, formatTime(s.EffectiveAt), s.Status,
+		s.Error, s.CreatedBy, formatTime(s.CreatedAt), formatTime(s.StatusUpdatedAt)})
+}
+
+func (c *Checksum) AddOrder(o Order) {
+	items := make([][]interface{}, 0, len(o.Items))
+	for _, i := range o.Items {
+		product := ""
+		if i.ProductID != nil {
+			product = c.products[*i.ProductID]
+		}
+		items = append(items, []interface{}{product, i.VariantSKU, i.ProductName, i.SKU, i.Quantity, i.UnitPrice.String(), i.Stocked})
+	}
+	c.add(KindOrder, []interface{}{o.Username, o.Status, o.Currency, o.Total.String(),
+		formatTime(o.CreatedAt), formatTime(o.StatusUpdatedAt), items})
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+func (c *Checksum) add(kind string, fields []interface{}) {
+	writeFields(c.hashes[kind], fields)
+	c.counts[kind]++
+}
+
+func sortedTranslations(translations []models.Translation) []models.Translation {
+	sorted := append([]models.Translation(nil), translations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Locale < sorted[j].Locale })
+	return sorted
+}
+
+func writeFields(h hash.Hash, fields []interface{}) {
+	data, _ := json.Marshal(fields)
+	h.Write(data)
+	h.Write([]byte("\n"))
+}
+
+func (c *Checksum) Summary() Summary {
+	s := Summary{Counts: map[string]int{}, Checksums: map[string]string{}}
+	for _, kind := range recordKinds {
+		s.Counts[kind] = c.counts[kind]
+		s.Checksums[kind] = hex.EncodeToString(c.hashes[kind].Sum(nil))
+	}
+
+	categories := sha256.New()
+	for _, cat := range c.categoryRecords {
+		fields := []interface{}{cat.Name, cat.Description}
+		if cat.ParentID != nil {
+			fields = append(fields, c.categories[*cat.ParentID])
+		}
+		if len(cat.Attributes) > 0 {
+			attributes := append([]Attribute(nil), cat.Attributes...)
+			sort.Slice(attributes, func(i, j int) bool { return attributes[i].Name < attributes[j].Name })
+			fields = append(fields, "attributes", attributes)
+		}
+		if len(cat.Translations) > 0 {
+			fields = append(fields, "translations", sortedTranslations(cat.Translations))
+		}
+		if cat.Position != nil {
+			fields = append(fields, "position", *cat.Position)
+		}
+		writeFields(categories, fields)
+	}
+	s.Counts[KindCategory] = len(c.categoryRecords)
+	s.Checksums[KindCategory] = hex.EncodeToString(categories.Sum(nil))
+	return s
+}
+
+// Writer writes an archive. Records must be written in kind order and Close
+// must be called to write the trailer.
+type Writer struct {
+	gz       *gzip.Writer
+	enc      *json.Encoder
+	checksum *Checksum
+}
+
+func NewWriter(w io.Writer) (*Writer, error) {
+	gz := gzip.NewWriter(w)
+	aw := &Writer{gz: gz, enc: json.NewEncoder(gz), checksum: NewChecksum()}
+	if err := aw.write(KindHeader, Header{Format: Format, Version: Version, CreatedAt: time.Now().UTC()}); err != nil {
+		return nil, err
+	}
+	return aw, nil
+}
+
+func (aw *Writer) WriteUser(u User) error {
+	aw.checksum.AddUser(u)
+	return aw.write(KindUser, u)
+}
+
+func (aw *Writer) WriteCategory(c Category) error {
+	aw.checksum.AddCategory(c)
+	return aw.write(KindCategory, c)
+}
+
+func (aw *Writer) WriteProduct(p Product) error {
+	aw.checksum.AddProduct(p)
+	return aw.write(KindProduct, p)
+}
+
+func (aw *Writer) WriteExchangeRate(r ExchangeRate) error {
+	aw.checksum.AddExchangeRate(r)
+	return aw.write(KindExchangeRate, r)
+}
+
+func (aw *Writer) WriteRelation(r Relation) error {
+	aw.checksum.AddRelation(r)
+	return aw.write(KindRelation, r)
+}
+
+func (aw *Writer) WritePromotion(p Promotion) error {
+	aw.checksum.AddPromotion(p)
+	return aw.write(KindPromotion, p)
+}
+
+func (aw *Writer) WriteScheduledChange(s ScheduledChange) error {
+	aw.checksum.AddScheduledChange(s)
+	return aw.write(KindScheduledChange, s)
+}
+
+func (aw *Writer) WriteOrder(o Order) error {
+	aw.checksum.AddOrder(o)
+	return aw.write(KindOrder, o)
+}
+
+// Close writes the trailer and flushes the archive. It returns the summary
+// that was written.
+func (aw *Writer) Close() (Summary, error) {
+	summary := aw.checksum.Summary()
+	if err := aw.write(KindTrailer, summary); err != nil {
+		return Summary{}, err
+	}
+	return summary, aw.gz.Close()
+}
+
+func (aw *Writer) write(kind string, record interface{}) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return aw.enc.Encode(line{Kind: kind, Data: data})
+}
+
+// Handlers receive the records of an archive in order.
+type Handlers struct {
+	User            func(User) error
+	Category        func(Category) error
+	Product         func(Product) error
+	ExchangeRate    func(ExchangeRate) error
+	Relation        func(Relation) error
+	Promotion       func(Promotion) error
+	ScheduledChange func(ScheduledChange) error
+	Order           func(Order) error
+}
+
+// Handlers returns handlers that add every record to c.
+func (c *Checksum) Handlers() Handlers {
+	return Handlers{
+		User:            func(u User) error { c.AddUser(u); return nil },
+		Category:        func(cat Category) error { c.AddCategory(cat); return nil },
+		Product:         func(p Product) error { c.AddProduct(p); return nil },
+		ExchangeRate:    func(r ExchangeRate) error { c.AddExchangeRate(r); return nil },
+		Relation:        func(r Relation) error { c.AddRelation(r); return nil },
+		Promotion:       func(p Promotion) error { c.AddPromotion(p); return nil },
+		ScheduledChange: func(s ScheduledChange) error { c.AddScheduledChange(s); return nil },
+		Order:           func(o Order) error { c.AddOrder(o); return nil },
+	}
+}
+
+// Read checks the header, passes every record to its handler and verifies the
+// records against the trailer. It returns the trailer. Archives of earlier
+// versions are read too; they hold no records of the kinds added since.
+func Read(r io.Reader, handlers Handlers) (Summary, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return Summary{}, fmt.Errorf("%w: %s", ErrCorrupt, err)
+	}
+	defer gz.Close()
+
+	dec := json.NewDecoder(gz)
+	checksum := NewChecksum()
+
+	var header Header
+	if err := readLine(dec, KindHeader, &header); err != nil {
+		return Summary{}, err
+	}
+	if header.Format != Format {
+		return Summary{}, fmt.Errorf("%w: unknown format %q", ErrCorrupt, header.Format)
+	}
+	if header.Version < 1 || header.Version > Version {
+		return Summary{}, fmt.Errorf("unsupported backup version %d, this build reads versions up to %d", header.Version, Version)
+	}
+
+	order := map[string]int{}
+	for i, kind := range recordKinds {
+		order[kind] = i
+	}
+	current := 0
+
+	for {
+		var l line
+		if err := dec.Decode(&l); err == io.EOF {
+			return Summary{}, fmt.Errorf("%w: missing trailer", ErrCorrupt)
+		} else if err != nil {
+			return Summary{}, fmt.Errorf("%w: %s", ErrCorrupt, err)
+		}
+
+		if l.Kind == KindTrailer {
+			var trailer Summary
+			if err := json.Unmarshal(l.Data, &trailer); err != nil {
+				return Summary{}, fmt.Errorf("%w: trailer: %s", ErrCorrupt, err)
+			}
+			if err := checksum.Summary().Compare(trailer); err != nil {
+				return Summary{}, fmt.Errorf("%w: %s", ErrCorrupt, err)
+			}
+			return trailer, nil
+		}
+
+		position, ok := order[l.Kind]
+		if !ok || position < current {
+			return Summary{}, fmt.Errorf("%w: unexpected %q record", ErrCorrupt, l.Kind)
+		}
+		current = position
+
+		if err := readRecord(l, checksum, handlers); err != nil {
+			return Summary{}, err
+		}
+	}
+}
+
+func readRecord(l line, checksum *Checksum, handlers Handlers) error {
+	switch l.Kind {
+	case KindUser:
+		var u User
+		if err := unmarshal(l, &u); err != nil {
+			return err
+		}
+		checksum.AddUser(u)
+		return handlers.User(u)
+	case KindCategory:
+		var c Category
+		if err := unmarshal(l, &c); err != nil {
+			return err
+		}
+		checksum.AddCategory(c)
+		return handlers.Category(c)
+	case KindProduct:
+		var p Product
+		if err := unmarshal(l, &p); err != nil {
+			return err
+		}
+		checksum.AddProduct(p)
+		return handlers.Product(p)
+	case KindExchangeRate:
+		var r ExchangeRate
+		if err := unmarshal(l, &r); err != nil {
+			return err
+		}
+		checksum.AddExchangeRate(r)
+		return handlers.ExchangeRate(r)
+	case KindRelation:
+		var r Relation
+		if err := unmarshal(l, &r); err != nil {
+			return err
+		}
+		checksum.AddRelation(r)
+		return handlers.Relation(r)
+	case KindPromotion:
+		var p Promotion
+		if err := unmarshal(l, &p); err != nil {
+			return err
+		}
+		checksum.AddPromotion(p)
+		return handlers.Promotion(p)
+	case KindScheduledChange:
+		var s ScheduledChange
+		if err := unmarshal(l, &s); err != nil {
+			return err
+		}
+		checksum.AddScheduledChange(s)
+		return handlers.ScheduledChange(s)
+	default:
+		var o Order
+		if err := unmarshal(l, &o); err != nil {
+			return err
+		}
+		checksum.AddOrder(o)
+		return handlers.Order(o)
+	}
+}
+
+func readLine(dec *json.Decoder, kind string, v interface{}) error {
+	var l line
+	if err := dec.Decode(&l); err != nil {
+		return fmt.Errorf("%w: %s", ErrCorrupt, err)
+	}
+	if l.Kind != kind {
+		return fmt.Errorf("%w: expected %s, got %q", ErrCorrupt, kind, l.Kind)
+	}
+	return unmarshal(l, v)
+}
+
+func unmarshal(l line, v interface{}) error {
+	if err := json.Unmarshal(l.Data, v); err != nil {
+		return fmt.Errorf("%w: %s record: %s", ErrCorrupt, l.Kind, err)
+	}
+	return nil
+}
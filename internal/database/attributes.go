@@ -0,0 +1,330 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/say8hi/go-api-test/internal/models"
+)
+
+var attributeNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// ValidAttributeName reports whether name can name an attribute.
+func ValidAttributeName(name string) bool {
+	return attributeNamePattern.MatchString(name)
+}
+
+// attributeColumns is the column list of category_attributes queries, in the
+// order expected by scanAttribute. Queries must alias category_attributes as a.
+const attributeColumns = `a.id, a.category_id, a.name, a.type, a.required, a.allowed_values`
+
+// attributesConstraint names the errors of product attributes that break the
+// attribute definitions of their categories.
+const attributesConstraint = "products_attributes"
+
+func scanAttribute(row rowScanner) (models.AttributeDefinition, error) {
+	var (
+		attribute     models.AttributeDefinition
+		allowedValues []byte
+	)
+	err := row.Scan(&attribute.ID, &attribute.CategoryID, &attribute.Name, &attribute.Type, &attribute.Required, &allowedValues)
+	if err != nil || allowedValues == nil {
+		return attribute, err
+	}
+	err = json.Unmarshal(allowedValues, &attribute.AllowedValues)
+	return attribute, err
+}
+
+// lineageQuery returns a query selecting the IDs of the categories selected by
+// seed and all their ancestors.
+func lineageQuery(seed string) string {
+	return `
+WITH RECURSIVE lineage AS (
+    SELECT id, parent_id FROM categories WHERE id IN (` + seed + `)
+    UNION
+    SELECT parent.id, parent.parent_id FROM categories parent JOIN lineage ON parent.id = lineage.parent_id
+)
+SELECT id FROM lineage`
+}
+
+// Table Category Attributes
+
+// GetCategoryAttributes returns the attributes of a category including those
+// it inherits from its ancestors, ordered by name.
+func GetCategoryAttributes(categoryID int) ([]models.AttributeDefinition, error) {
+	if err := categoryExists(db, categoryID); err != nil {
+		return nil, err
+	}
+	return queryAttributes(db, `SELECT `+attributeColumns+` FROM category_attributes a
+WHERE a.category_id IN (`+lineageQuery("$1")+`) ORDER BY a.name, a.id`, categoryID)
+}
+
+func CreateAttribute(categoryID int, req models.CreateAttributeRequest) (models.AttributeDefinition, error) {
+	name := strings.ToLower(strings.TrimSpace(req.Name))
+	allowedValues, err := allowedValuesJSON(req.Type, req.AllowedValues)
+	if err != nil {
+		return models.AttributeDefinition{}, err
+	}
+
+	query := `INSERT INTO category_attributes AS a (category_id, name, type, required, allowed_values)
+VALUES ($1, $2, $3, $4, $5::jsonb) RETURNING ` + attributeColumns
+	attribute, err := scanAttribute(db.QueryRow(query, categoryID, name, req.Type, req.Required, allowedValues))
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Constraint == "category_attributes_category_id_fkey" {
+			return models.AttributeDefinition{}, sql.ErrNoRows
+		}
+		return models.AttributeDefinition{}, fmt.Errorf("error creating attribute: %w", constraintError(err))
+	}
+
+	return attribute, nil
+}
+
+// UpdateAttribute changes whether an attribute is required and its allowed
+// values. Products that no longer match are only rejected when they are next
+// changed.
+func UpdateAttribute(categoryID, attributeID int, req models.AttributeUpdateRequest) (models.AttributeDefinition, error) {
+	var attributeType string
+	err := db.QueryRow(`SELECT type FROM category_attributes WHERE category_id = $1 AND id = $2`, categoryID, attributeID).Scan(&attributeType)
+	if err != nil {
+		return models.AttributeDefinition{}, err
+	}
+
+	var setParts []string
+	var args []interface{}
+	set := func(column string, value interface{}) {
+		args = append(args, value)
+		setParts = append(setParts, fmt.Sprintf("%s = $%d", column, len(args)))
+	}
+
+	if req.Required != nil {
+		set("required", *req.Required)
+	}
+	if req.AllowedValues != nil {
+		allowedValues, err := allowedValuesJSON(attributeType, req.AllowedValues)
+		if err != nil {
+			return models.AttributeDefinition{}, err
+		}
+		set("allowed_values", allowedValues)
+	}
+
+	if len(setParts) == 0 {
+		return models.AttributeDefinition{}, fmt.Errorf("no fields to update")
+	}
+
+	args = append(args, categoryID, attributeID)
+	query := fmt.Sprintf("UPDATE category_attributes AS a SET %s WHERE a.category_id = $%d AND a.id = $%d RETURNING %s",
+		strings.Join(setParts, ", "), len(args)-1, len(args), attributeColumns)
+	attribute, err := scanAttribute(db.QueryRow(query, args...))
+	if err == sql.ErrNoRows {
+		return models.AttributeDefinition{}, err
+	} else if err != nil {
+		return models.AttributeDefinition{}, fmt.Errorf("error updating attribute: %w", constraintError(err))
+	}
+
+	return attribute, nil
+}
+
+// DeleteAttribute removes an attribute definition. Values products already
+// have are kept until the product is next changed.
+func DeleteAttribute(categoryID, attributeID int) error {
+	result, err := db.Exec(`DELETE FROM category_attributes WHERE category_id = $1 AND id = $2`, categoryID, attributeID)
+	if err != nil {
+		return fmt.Errorf("error deleting attribute: %w", err)
+	}
+	if deleted, _ := result.RowsAffected(); deleted == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// allowedValuesJSON checks the allowed values of an attribute of the given
+// type and encodes them for the allowed_values column. No values encode as
+// NULL, which allows every value.
+func allowedValuesJSON(attributeType string, values []interface{}) (interface{}, error) {
+	switch attributeType {
+	case models.AttributeString, models.AttributeNumber, models.AttributeBoolean:
+	default:
+		return nil, invalidInput("category_attributes_type_check", errors.New(constraintMessages["category_attributes_type_check"]))
+	}
+	if len(values) == 0 {
+		return nil, nil
+	}
+	if attributeType == models.AttributeBoolean {
+		return nil, invalidInput("category_attributes_allowed_values", errors.New("boolean attributes can't restrict their values"))
+	}
+	for _, value := range values {
+		if !hasAttributeType(value, attributeType) {
+			return nil, invalidInput("category_attributes_allowed_values",
+				fmt.Errorf("allowed values of a %s attribute must be %ss", attributeType, attributeType))
+		}
+	}
+
+	data, err := json.Marshal(values)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// setProductAttributesTx validates attributes against the attribute
+// definitions of the product's categories and their ancestors and stores them.
+// With attributes nil the stored attributes are validated again, e.g. after
+// the categories of the product changed. It returns the stored attributes, nil
+// when there are none.
+func setProductAttributesTx(tx *sql.Tx, productID int, attributes models.Attributes) (models.Attributes, error) {
+	if attributes == nil {
+		var stored []byte
+		if err := tx.QueryRow(`SELECT attributes FROM products WHERE id = $1`, productID).Scan(&stored); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(stored, &attributes); err != nil {
+			return nil, err
+		}
+	}
+
+	definitions, err := queryAttributes(tx, `SELECT `+attributeColumns+` FROM category_attributes a
+WHERE a.category_id IN (`+lineageQuery("SELECT category_id FROM product_category WHERE product_id = $1")+`)
+ORDER BY a.name, a.id`, productID)
+	if err != nil {
+		return nil, err
+	}
+
+	normalized, err := validateAttributes(definitions, attributes)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(normalized)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(`UPDATE products SET attributes = $2::jsonb WHERE id = $1`, productID, string(data)); err != nil {
+		return nil, fmt.Errorf("error storing attributes: %w", err)
+	}
+
+	if len(normalized) == 0 {
+		return nil, nil
+	}
+	return normalized, nil
+}
+
+// validateAttributes checks values against definitions and returns them with
+// lowercase names and without null values. Every value must be defined, have the defined type and be
+// allowed by every definition of its name, and required attributes must be
+// set.
+func validateAttributes(definitions []models.AttributeDefinition, values models.Attributes) (models.Attributes, error) {
+	normalized := make(models.Attributes, len(values))
+	for name, value := range values {
+		if value != nil {
+			normalized[strings.ToLower(strings.TrimSpace(name))] = value
+		}
+	}
+
+	defined := make(map[string]bool)
+	for _, definition := range definitions {
+		defined[definition.Name] = true
+
+		value, ok := normalized[definition.Name]
+		if !ok {
+			if definition.Required {
+				return nil, invalidInput(attributesConstraint, fmt.Errorf("attribute %s is required", definition.Name))
+			}
+			continue
+		}
+		if !hasAttributeType(value, definition.Type) {
+			return nil, invalidInput(attributesConstraint, fmt.Errorf("attribute %s must be a %s", definition.Name, definition.Type))
+		}
+		if len(definition.AllowedValues) > 0 && !containsValue(definition.AllowedValues, value) {
+			allowed := make([]string, len(definition.AllowedValues))
+			for i, allowedValue := range definition.AllowedValues {
+				allowed[i] = fmt.Sprint(allowedValue)
+			}
+			return nil, invalidInput(attributesConstraint,
+				fmt.Errorf("attribute %s must be one of %s", definition.Name, strings.Join(allowed, ", ")))
+		}
+	}
+
+	var unknown []string
+	for name := range normalized {
+		if !defined[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, invalidInput(attributesConstraint,
+			fmt.Errorf("the categories of the product don't define the attributes %s", strings.Join(unknown, ", ")))
+	}
+
+	return normalized, nil
+}
+
+func hasAttributeType(value interface{}, attributeType string) bool {
+	switch value.(type) {
+	case string:
+		return attributeType == models.AttributeString
+	case float64:
+		return attributeType == models.AttributeNumber
+	case bool:
+		return attributeType == models.AttributeBoolean
+	default:
+		return false
+	}
+}
+
+func containsValue(values []interface{}, value interface{}) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// attributeConditions returns a condition per filtered attribute and its
+// arguments, numbered from $next on. Queries must alias products as p.
+func attributeConditions(filter map[string][]string, next int) ([]string, []interface{}) {
+	names := make([]string, 0, len(filter))
+	for name := range filter {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var conditions []string
+	var args []interface{}
+	for _, name := range names {
+		conditions = append(conditions, fmt.Sprintf("p.attributes ->> $%d = ANY($%d)", next, next+1))
+		args = append(args, name, pq.Array(filter[name]))
+		next += 2
+	}
+	return conditions, args
+}
+
+func queryAttributes(q querier, query string, args ...interface{}) ([]models.AttributeDefinition, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying attributes: %w", err)
+	}
+	defer rows.Close()
+
+	attributes := []models.AttributeDefinition{}
+	for rows.Next() {
+		attribute, err := scanAttribute(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning attribute: %w", err)
+		}
+		attributes = append(attributes, attribute)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating attributes: %w", err)
+	}
+
+	return attributes, nil
+}
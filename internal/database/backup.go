@@ -0,0 +1,838 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/lib/pq"
+	"github.com/say8hi/go-api-test/internal/backup"
+	"github.com/say8hi/go-api-test/internal/models"
+)
+
+var ErrDatabaseNotEmpty = errors.New("database is not empty")
+
+// BackupCatalog writes users, categories with their attributes, products with
+// their status, category links, prices, variants, stock on hand, attribute
+// values, tags and image records, exchange rates, product relations,
+// promotions, scheduled changes and orders to w as a backup archive.
+// Everything is read from one snapshot.
+func BackupCatalog(w io.Writer) (backup.Summary, error) {
+	tx, err := db.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return backup.Summary{}, err
+	}
+	defer tx.Rollback()
+
+	archive, err := backup.NewWriter(w)
+	if err != nil {
+		return backup.Summary{}, err
+	}
+
+	err = dumpCatalog(tx, backup.Handlers{
+		User:            archive.WriteUser,
+		Category:        archive.WriteCategory,
+		Product:         archive.WriteProduct,
+		ExchangeRate:    archive.WriteExchangeRate,
+		Relation:        archive.WriteRelation,
+		Promotion:       archive.WritePromotion,
+		ScheduledChange: archive.WriteScheduledChange,
+		Order:           archive.WriteOrder,
+	})
+	if err != nil {
+		return backup.Summary{}, err
+	}
+
+	return archive.Close()
+}
+
+// RestoreCatalog loads a backup archive into an empty database in one
+// transaction. Records get new IDs and references between them are remapped.
+// With verify set the restored data is read back and its counts and checksums
+// are compared with the archive before committing. No catalog events are
+// published for restored records, stock is restored without reservations and
+// image files are expected to be in media storage already.
+func RestoreCatalog(r io.Reader, verify bool) (backup.Summary, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return backup.Summary{}, err
+	}
+	defer tx.Rollback()
+
+	var notEmpty bool
+	err = tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM users) OR EXISTS (SELECT 1 FROM categories)
+        OR EXISTS (SELECT 1 FROM products) OR EXISTS (SELECT 1 FROM exchange_rates)
+        OR EXISTS (SELECT 1 FROM promotions)`).Scan(&notEmpty)
+	if err != nil {
+		return backup.Summary{}, err
+	}
+	if notEmpty {
+		return backup.Summary{}, ErrDatabaseNotEmpty
+	}
+
+	categoryIDs := make(map[int]int)
+	categoryParents := make(map[int]int)
+	productIDs := make(map[int]int)
+	summary, err := backup.Read(r, backup.Handlers{
+		User: func(u backup.User) error {
+			_, err := tx.Exec(`INSERT INTO users (username, full_name, password_hash) VALUES ($1, $2, $3)`,
+				u.Username, u.FullName, u.PasswordHash)
+			if err != nil {
+				return fmt.Errorf("error restoring user %d: %w", u.ID, err)
+			}
+			return nil
+		},
+		Category: func(c backup.Category) error {
+			slug, err := categorySlugs.slugTx(tx, c.Slug, c.Name)
+			if err != nil {
+				return fmt.Errorf("error restoring category %d: %w", c.ID, err)
+			}
+			var id int
+			err = tx.QueryRow(`INSERT INTO categories (name, slug, description, position) VALUES ($1, $2, $3, $4) RETURNING id`,
+				c.Name, slug, c.Description, c.Position).Scan(&id)
+			if err != nil {
+				return fmt.Errorf("error restoring category %d: %w", c.ID, err)
+			}
+			for _, attribute := range c.Attributes {
+				allowedValues, err := allowedValuesJSON(attribute.Type, attribute.AllowedValues)
+				if err != nil {
+					return fmt.Errorf("error restoring attributes of category %d: %w", c.ID, err)
+				}
+				_, err = tx.Exec(`INSERT INTO category_attributes (category_id, name, type, required, allowed_values) VALUES ($1, $2, $3, $4, $5::jsonb)`,
+					id, attribute.Name, attribute.Type, attribute.Required, allowedValues)
+				if err != nil {
+					return fmt.Errorf("error restoring attributes of category %d: %w", c.ID, err)
+				}
+			}
+			for _, translation := range c.Translations {
+				request := models.TranslationRequest{Name: translation.Name, Description: translation.Description}
+				if _, err := categoryTranslations.setTx(tx, id, translation.Locale, request); err != nil {
+					return fmt.Errorf("error restoring translations of category %d: %w", c.ID, err)
+				}
+			}
+			categoryIDs[c.ID] = id
+			if c.ParentID != nil {
+				categoryParents[c.ID] = *c.ParentID
+			}
+			return nil
+		},
+		Product: func(p backup.Product) error {
+			id, err := restoreProductTx(tx, p, categoryIDs)
+			productIDs[p.ID] = id
+			return err
+		},
+		ExchangeRate: func(rate backup.ExchangeRate) error {
+			_, err := tx.Exec(`INSERT INTO exchange_rates (base_currency, quote_currency, rate, updated_at) VALUES ($1, $2, $3, $4)`,
+				rate.Base, rate.Quote, rate.Rate, rate.UpdatedAt)
+			if err != nil {
+				return fmt.Errorf("error restoring exchange rate %s/%s: %w", rate.Base, rate.Quote, err)
+			}
+			return nil
+		},
+		Relation: func(relation backup.Relation) error {
+			productID, ok := productIDs[relation.ProductID]
+			relatedID, relatedOK := productIDs[relation.RelatedID]
+			if !ok || !relatedOK {
+				return fmt.Errorf("%w: relation %d-%d references unknown product", backup.ErrCorrupt, relation.ProductID, relation.RelatedID)
+			}
+			_, err := tx.Exec(`INSERT INTO product_relations (product_id, related_id, type, created_at) VALUES ($1, $2, $3, $4)`,
+				productID, relatedID, relation.Type, relation.CreatedAt)
+			if err != nil {
+				return fmt.Errorf("error restoring relation %d-%d: %w", relation.ProductID, relation.RelatedID, err)
+			}
+			return nil
+		},
+		Promotion: func(p backup.Promotion) error {
+			categoryID, err := remapID(p.CategoryID, categoryIDs)
+			if err != nil {
+				return fmt.Errorf("%w: promotion %d references unknown category %d", backup.ErrCorrupt, p.ID, *p.CategoryID)
+			}
+			productID, err := remapID(p.ProductID, productIDs)
+			if err != nil {
+				return fmt.Errorf("%w: promotion %d references unknown product %d", backup.ErrCorrupt, p.ID, *p.ProductID)
+			}
+			_, err = tx.Exec(`INSERT INTO promotions (name, kind, value, currency, scope, category_id, product_id, starts_at, ends_at, stackable, priority, created_at)
+                VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6, $7, $8, $9, $10, $11, $12)`,
+				p.Name, p.Kind, p.Value, p.Currency, p.Scope, categoryID, productID, p.StartsAt, p.EndsAt, p.Stackable, p.Priority, p.CreatedAt)
+			if err != nil {
+				return fmt.Errorf("error restoring promotion %d: %w", p.ID, err)
+			}
+			return nil
+		},
+		ScheduledChange: func(change backup.ScheduledChange) error {
+			productID, ok := productIDs[change.ProductID]
+			if !ok {
+				return fmt.Errorf("%w: scheduled change %d references unknown product %d", backup.ErrCorrupt, change.ID, change.ProductID)
+			}
+			_, err := tx.Exec(`INSERT INTO scheduled_changes (product_id, changes, effective_at, status, error, created_by, created_at, status_updated_at)
+                VALUES ($1, $2::jsonb, $3, $4, NULLIF($5, ''), (SELECT id FROM users WHERE username = $6), $7, $8)`,
+				productID, string(change.Changes), change.EffectiveAt, change.Status, change.Error, change.CreatedBy,
+				change.CreatedAt, change.StatusUpdatedAt)
+			if err != nil {
+				return fmt.Errorf("error restoring scheduled change %d: %w", change.ID, err)
+			}
+			return nil
+		},
+		Order: func(o backup.Order) error {
+			return restoreOrderTx(tx, o, productIDs)
+		},
+	})
+	if err != nil {
+		return backup.Summary{}, err
+	}
+
+	// Parents are set once all categories exist, as a parent can come after
+	// its children.
+	for oldID, oldParentID := range categoryParents {
+		parentID, ok := categoryIDs[oldParentID]
+		if !ok {
+			return backup.Summary{}, fmt.Errorf("%w: category %d references unknown parent %d", backup.ErrCorrupt, oldID, oldParentID)
+		}
+		if _, err := tx.Exec(`UPDATE categories SET parent_id = $1 WHERE id = $2`, parentID, categoryIDs[oldID]); err != nil {
+			return backup.Summary{}, fmt.Errorf("error restoring parent of category %d: %w", oldID, err)
+		}
+	}
+
+	if verify {
+		checksum := backup.NewChecksum()
+		if err := dumpCatalog(tx, checksum.Handlers()); err != nil {
+			return backup.Summary{}, err
+		}
+		if err := checksum.Summary().Compare(summary); err != nil {
+			return backup.Summary{}, err
+		}
+	}
+
+	return summary, tx.Commit()
+}
+
+// restoreProductTx restores a product and returns its new ID.
+func restoreProductTx(tx *sql.Tx, p backup.Product, categoryIDs map[int]int) (int, error) {
+	var id int
+	attributes, err := json.Marshal(p.Attributes)
+	if err != nil {
+		return 0, err
+	}
+	if p.Attributes == nil {
+		attributes = []byte("{}")
+	}
+	slug, err := productSlugs.slugTx(tx, p.Slug, p.Name)
+	if err != nil {
+		return 0, fmt.Errorf("error restoring product %d: %w", p.ID, err)
+	}
+	err = tx.QueryRow(`INSERT INTO products (external_id, name, slug, description, price, currency, attributes, status)
+        VALUES (NULLIF($1, ''), $2, $3, $4, $5, $6, $7::jsonb, COALESCE(NULLIF($8, ''), 'active')) RETURNING id`,
+		p.ExternalID, p.Name, slug, p.Description, p.Price, p.Currency, string(attributes), p.Status).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("error restoring product %d: %w", p.ID, err)
+	}
+	if err := restoreStockTx(tx, id, nil, p.Stock); err != nil {
+		return 0, fmt.Errorf("error restoring stock of product %d: %w", p.ID, err)
+	}
+	if _, err := tagProductTx(tx, id, p.Tags); err != nil {
+		return 0, fmt.Errorf("error restoring tags of product %d: %w", p.ID, err)
+	}
+	for _, translation := range p.Translations {
+		request := models.TranslationRequest{Name: translation.Name, Description: translation.Description}
+		if _, err := productTranslations.setTx(tx, id, translation.Locale, request); err != nil {
+			return 0, fmt.Errorf("error restoring translations of product %d: %w", p.ID, err)
+		}
+	}
+	for _, review := range p.Reviews {
+		result, err := tx.Exec(`INSERT INTO reviews (product_id, user_id, rating, text, status, created_at, updated_at)
+            SELECT $1, id, $3, $4, $5, $6, $7 FROM users WHERE username = $2`,
+			id, review.Username, review.Rating, review.Text, review.Status, review.CreatedAt, review.UpdatedAt)
+		if err != nil {
+			return 0, fmt.Errorf("error restoring reviews of product %d: %w", p.ID, err)
+		}
+		if restored, _ := result.RowsAffected(); restored == 0 {
+			return 0, fmt.Errorf("%w: review of product %d references unknown user %s", backup.ErrCorrupt, p.ID, review.Username)
+		}
+	}
+
+	for _, oldID := range p.Categories {
+		categoryID, ok := categoryIDs[oldID]
+		if !ok {
+			return 0, fmt.Errorf("%w: product %d references unknown category %d", backup.ErrCorrupt, p.ID, oldID)
+		}
+		var position *int
+		if value, ok := p.Positions[oldID]; ok {
+			position = &value
+		}
+		if _, err := tx.Exec(`INSERT INTO product_category (product_id, category_id, position) VALUES ($1, $2, $3)`,
+			id, categoryID, position); err != nil {
+			return 0, fmt.Errorf("error restoring categories of product %d: %w", p.ID, err)
+		}
+	}
+
+	for _, price := range p.Prices {
+		_, err := tx.Exec(`INSERT INTO product_prices (product_id, currency, amount) VALUES ($1, $2, $3)`,
+			id, price.Currency, price.Amount)
+		if err != nil {
+			return 0, fmt.Errorf("error restoring prices of product %d: %w", p.ID, err)
+		}
+	}
+
+	for _, variant := range p.Variants {
+		options, err := json.Marshal(variant.Options)
+		if err != nil {
+			return 0, err
+		}
+		var variantID int
+		err = tx.QueryRow(`INSERT INTO product_variants (product_id, sku, options, price, available) VALUES ($1, $2, $3::jsonb, $4, $5) RETURNING id`,
+			id, variant.SKU, string(options), variant.Price, variant.Available).Scan(&variantID)
+		if err != nil {
+			return 0, fmt.Errorf("error restoring variants of product %d: %w", p.ID, err)
+		}
+		if err := restoreStockTx(tx, id, &variantID, variant.Stock); err != nil {
+			return 0, fmt.Errorf("error restoring stock of variant %s: %w", variant.SKU, err)
+		}
+	}
+
+	for _, image := range p.Images {
+		_, err := tx.Exec(`INSERT INTO product_images (product_id, url, thumbnail_url, object_key, thumbnail_key, content_type,
+                width, height, size_bytes, position, is_primary, created_at)
+            VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''), NULLIF($5, ''), NULLIF($6, ''), NULLIF($7, 0), NULLIF($8, 0), NULLIF($9, 0), $10, $11, $12)`,
+			id, image.URL, image.ThumbnailURL, image.ObjectKey, image.ThumbnailKey, image.ContentType,
+			image.Width, image.Height, image.Size, image.Position, image.Primary, image.CreatedAt)
+		if err != nil {
+			return 0, fmt.Errorf("error restoring images of product %d: %w", p.ID, err)
+		}
+	}
+
+	return id, nil
+}
+
+// restoreOrderTx restores an order with its items. Variants are found by SKU
+// in the restored product, and items that took stock are linked to its stock
+// item again so that cancelling the order puts the stock back.
+func restoreOrderTx(tx *sql.Tx, o backup.Order, productIDs map[int]int) error {
+	var orderID int
+	err := tx.QueryRow(`INSERT INTO orders (user_id, status, currency, total, created_at, status_updated_at)
+        SELECT id, $2, $3, $4, $5, $6 FROM users WHERE username = $1 RETURNING id`,
+		o.Username, o.Status, o.Currency, o.Total, o.CreatedAt, o.StatusUpdatedAt).Scan(&orderID)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("%w: order %d references unknown user %s", backup.ErrCorrupt, o.ID, o.Username)
+	} else if err != nil {
+		return fmt.Errorf("error restoring order %d: %w", o.ID, err)
+	}
+
+	for _, item := range o.Items {
+		productID, err := remapID(item.ProductID, productIDs)
+		if err != nil {
+			return fmt.Errorf("%w: order %d references unknown product %d", backup.ErrCorrupt, o.ID, *item.ProductID)
+		}
+		var variantID, stockItemID *int
+		if productID != nil && item.VariantSKU != "" {
+			err := tx.QueryRow(`SELECT id FROM product_variants WHERE product_id = $1 AND sku = $2`, *productID, item.VariantSKU).Scan(&variantID)
+			if err == sql.ErrNoRows {
+				return fmt.Errorf("%w: order %d references unknown variant %s", backup.ErrCorrupt, o.ID, item.VariantSKU)
+			} else if err != nil {
+				return fmt.Errorf("error restoring items of order %d: %w", o.ID, err)
+			}
+		}
+		if productID != nil && item.Stocked {
+			err := tx.QueryRow(`SELECT id FROM stock_items WHERE product_id = $1 AND variant_id IS NOT DISTINCT FROM $2`,
+				*productID, variantID).Scan(&stockItemID)
+			if err == sql.ErrNoRows {
+				return fmt.Errorf("%w: order %d references untracked stock of product %d", backup.ErrCorrupt, o.ID, *item.ProductID)
+			} else if err != nil {
+				return fmt.Errorf("error restoring items of order %d: %w", o.ID, err)
+			}
+		}
+		_, err = tx.Exec(`INSERT INTO order_items (order_id, product_id, variant_id, product_name, sku, quantity, unit_price, stock_item_id)
+            VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+			orderID, productID, variantID, item.ProductName, item.SKU, item.Quantity, item.UnitPrice, stockItemID)
+		if err != nil {
+			return fmt.Errorf("error restoring items of order %d: %w", o.ID, err)
+		}
+	}
+	return nil
+}
+
+// remapID returns the new ID of an archive ID, or nil for a nil ID. It fails
+// when the ID isn't known.
+func remapID(oldID *int, ids map[int]int) (*int, error) {
+	if oldID == nil {
+		return nil, nil
+	}
+	id, ok := ids[*oldID]
+	if !ok {
+		return nil, errors.New("unknown archive ID")
+	}
+	return &id, nil
+}
+
+// restoreStockTx starts tracking stock with onHand, recorded as one
+// adjustment. Nothing is tracked when onHand is nil.
+func restoreStockTx(tx *sql.Tx, productID int, variantID *int, onHand *int) error {
+	if onHand == nil {
+		return nil
+	}
+
+	var itemID int
+	err := tx.QueryRow(`INSERT INTO stock_items (product_id, variant_id, on_hand) VALUES ($1, $2, $3) RETURNING id`,
+		productID, variantID, *onHand).Scan(&itemID)
+	if err != nil {
+		return err
+	}
+	if *onHand == 0 {
+		return nil
+	}
+	return recordStockMovementTx(tx, itemID, *onHand, "restored from backup", nil)
+}
+
+// dumpCatalog passes every record to its handler in archive order.
+func dumpCatalog(q querier, handlers backup.Handlers) error {
+	if err := dumpUsers(q, handlers.User); err != nil {
+		return err
+	}
+	if err := dumpCategories(q, handlers.Category); err != nil {
+		return err
+	}
+	if err := dumpProducts(q, handlers.Product); err != nil {
+		return err
+	}
+	if err := dumpExchangeRates(q, handlers.ExchangeRate); err != nil {
+		return err
+	}
+	if err := dumpRelations(q, handlers.Relation); err != nil {
+		return err
+	}
+	if err := dumpPromotions(q, handlers.Promotion); err != nil {
+		return err
+	}
+	if err := dumpScheduledChanges(q, handlers.ScheduledChange); err != nil {
+		return err
+	}
+	return dumpOrders(q, handlers.Order)
+}
+
+func dumpUsers(q querier, handle func(backup.User) error) error {
+	rows, err := q.Query(`SELECT id, username, COALESCE(full_name, ''), password_hash FROM users ORDER BY id`)
+	if err != nil {
+		return fmt.Errorf("error querying users: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var u backup.User
+		if err := rows.Scan(&u.ID, &u.Username, &u.FullName, &u.PasswordHash); err != nil {
+			return fmt.Errorf("error scanning user: %w", err)
+		}
+		if err := handle(u); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func dumpCategories(q querier, handle func(backup.Category) error) error {
+	definitions, err := queryAttributes(q, `SELECT `+attributeColumns+` FROM category_attributes a ORDER BY a.category_id, a.name`)
+	if err != nil {
+		return err
+	}
+	attributes := make(map[int][]backup.Attribute)
+	for _, definition := range definitions {
+		attributes[definition.CategoryID] = append(attributes[definition.CategoryID], backup.Attribute{
+			Name:          definition.Name,
+			Type:          definition.Type,
+			Required:      definition.Required,
+			AllowedValues: definition.AllowedValues,
+		})
+	}
+
+	translations, err := categoryTranslations.load(q, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	rows, err := q.Query(`SELECT id, name, slug, description, parent_id, position FROM categories ORDER BY id`)
+	if err != nil {
+		return fmt.Errorf("error querying categories: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c backup.Category
+		if err := rows.Scan(&c.ID, &c.Name, &c.Slug, &c.Description, &c.ParentID, &c.Position); err != nil {
+			return fmt.Errorf("error scanning category: %w", err)
+		}
+		c.Attributes = attributes[c.ID]
+		c.Translations = byLocale(translations[c.ID])
+		if err := handle(c); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func dumpProducts(q querier, handle func(backup.Product) error) error {
+	query := `SELECT ` + productColumns + ` FROM products p WHERE p.id > $1 ORDER BY p.id LIMIT $2`
+	lastID := 0
+	for {
+		products, err := queryProducts(q, query, lastID, exportPageSize)
+		if err != nil {
+			return err
+		}
+		if len(products) == 0 {
+			return nil
+		}
+
+		ids := make([]int, len(products))
+		for i, product := range products {
+			ids[i] = product.ID
+		}
+		prices, err := loadProductPrices(q, ids)
+		if err != nil {
+			return err
+		}
+		stock, err := loadProductStock(q, ids)
+		if err != nil {
+			return err
+		}
+		translations, err := productTranslations.load(q, ids, nil)
+		if err != nil {
+			return err
+		}
+		reviews, err := loadBackupReviews(q, ids)
+		if err != nil {
+			return err
+		}
+		positions, err := loadCategoryPositions(q, ids)
+		if err != nil {
+			return err
+		}
+		images, err := loadBackupImages(q, ids)
+		if err != nil {
+			return err
+		}
+
+		for _, product := range products {
+			record := backup.Product{
+				ID:           product.ID,
+				ExternalID:   product.ExternalID,
+				Name:         product.Name,
+				Slug:         product.Slug,
+				Description:  product.Description,
+				Price:        product.Price,
+				Currency:     product.Currency,
+				Status:       product.Status,
+				Categories:   []int{},
+				Positions:    positions[product.ID],
+				Prices:       prices[product.ID],
+				Attributes:   product.Attributes,
+				Tags:         product.Tags,
+				Translations: byLocale(translations[product.ID]),
+				Reviews:      reviews[product.ID],
+				Images:       images[product.ID],
+			}
+			for _, category := range product.Categories {
+				record.Categories = append(record.Categories, category.ID)
+			}
+			variantStock := make(map[int]int)
+			for _, level := range stock[product.ID] {
+				onHand := level.OnHand
+				if level.VariantID == nil {
+					record.Stock = &onHand
+				} else {
+					variantStock[*level.VariantID] = onHand
+				}
+			}
+			for _, variant := range product.Variants {
+				v := backup.Variant{
+					SKU:       variant.SKU,
+					Options:   variant.Options,
+					Price:     variant.Price,
+					Available: variant.Available,
+				}
+				if onHand, ok := variantStock[variant.ID]; ok {
+					v.Stock = &onHand
+				}
+				record.Variants = append(record.Variants, v)
+			}
+			if record.Prices == nil {
+				record.Prices = []models.ProductPrice{}
+			}
+			if err := handle(record); err != nil {
+				return err
+			}
+		}
+		lastID = products[len(products)-1].ID
+	}
+}
+
+func loadProductPrices(q querier, productIDs []int) (map[int][]models.ProductPrice, error) {
+	rows, err := q.Query(`SELECT product_id, currency, amount FROM product_prices WHERE product_id = ANY($1) ORDER BY product_id, currency`,
+		pq.Array(productIDs))
+	if err != nil {
+		return nil, fmt.Errorf("error querying product prices: %w", err)
+	}
+	defer rows.Close()
+
+	prices := make(map[int][]models.ProductPrice)
+	for rows.Next() {
+		var (
+			productID int
+			price     models.ProductPrice
+		)
+		if err := rows.Scan(&productID, &price.Currency, &price.Amount); err != nil {
+			return nil, fmt.Errorf("error scanning product price: %w", err)
+		}
+		prices[productID] = append(prices[productID], price)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating product prices: %w", err)
+	}
+
+	return prices, nil
+}
+
+func dumpExchangeRates(q querier, handle func(backup.ExchangeRate) error) error {
+	rows, err := q.Query(`SELECT base_currency, quote_currency, rate, updated_at FROM exchange_rates ORDER BY base_currency, quote_currency`)
+	if err != nil {
+		return fmt.Errorf("error querying exchange rates: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r backup.ExchangeRate
+		if err := rows.Scan(&r.Base, &r.Quote, &r.Rate, &r.UpdatedAt); err != nil {
+			return fmt.Errorf("error scanning exchange rate: %w", err)
+		}
+		if err := handle(r); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// loadBackupReviews returns the reviews of every given product keyed by
+// product ID, in the order they were written.
+func loadBackupReviews(q querier, productIDs []int) (map[int][]backup.Review, error) {
+	rows, err := q.Query(`SELECT r.product_id, u.username, r.rating, r.text, r.status, r.created_at, r.updated_at
+        FROM reviews r JOIN users u ON u.id = r.user_id WHERE r.product_id = ANY($1) ORDER BY r.product_id, r.id`,
+		pq.Array(productIDs))
+	if err != nil {
+		return nil, fmt.Errorf("error fetching reviews for products: %w", err)
+	}
+	defer rows.Close()
+
+	reviews := make(map[int][]backup.Review, len(productIDs))
+	for rows.Next() {
+		var (
+			productID int
+			review    backup.Review
+		)
+		if err := rows.Scan(&productID, &review.Username, &review.Rating, &review.Text, &review.Status,
+			&review.CreatedAt, &review.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning review: %w", err)
+		}
+		reviews[productID] = append(reviews[productID], review)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating reviews: %w", err)
+	}
+
+	return reviews, nil
+}
+
+// loadBackupImages returns the image records of every given product keyed by
+// product ID, in their order.
+func loadBackupImages(q querier, productIDs []int) (map[int][]backup.Image, error) {
+	rows, err := q.Query(`SELECT product_id, url, COALESCE(thumbnail_url, ''), COALESCE(object_key, ''), COALESCE(thumbnail_key, ''),
+        COALESCE(content_type, ''), COALESCE(width, 0), COALESCE(height, 0), COALESCE(size_bytes, 0), position, is_primary, created_at
+        FROM product_images WHERE product_id = ANY($1) ORDER BY product_id, position, id`, pq.Array(productIDs))
+	if err != nil {
+		return nil, fmt.Errorf("error fetching images for products: %w", err)
+	}
+	defer rows.Close()
+
+	images := make(map[int][]backup.Image, len(productIDs))
+	for rows.Next() {
+		var (
+			productID int
+			image     backup.Image
+		)
+		if err := rows.Scan(&productID, &image.URL, &image.ThumbnailURL, &image.ObjectKey, &image.ThumbnailKey,
+			&image.ContentType, &image.Width, &image.Height, &image.Size, &image.Position, &image.Primary, &image.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning image: %w", err)
+		}
+		images[productID] = append(images[productID], image)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating images: %w", err)
+	}
+
+	return images, nil
+}
+
+func dumpRelations(q querier, handle func(backup.Relation) error) error {
+	rows, err := q.Query(`SELECT product_id, related_id, type, created_at FROM product_relations ORDER BY product_id, related_id`)
+	if err != nil {
+		return fmt.Errorf("error querying product relations: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r backup.Relation
+		if err := rows.Scan(&r.ProductID, &r.RelatedID, &r.Type, &r.CreatedAt); err != nil {
+			return fmt.Errorf("error scanning product relation: %w", err)
+		}
+		if err := handle(r); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func dumpPromotions(q querier, handle func(backup.Promotion) error) error {
+	rows, err := q.Query(`SELECT ` + promotionColumns + ` FROM promotions pr ORDER BY pr.id`)
+	if err != nil {
+		return fmt.Errorf("error querying promotions: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		p, err := scanPromotion(rows)
+		if err != nil {
+			return fmt.Errorf("error scanning promotion: %w", err)
+		}
+		err = handle(backup.Promotion{
+			ID:         p.ID,
+			Name:       p.Name,
+			Kind:       p.Kind,
+			Value:      p.Value,
+			Currency:   p.Currency,
+			Scope:      p.Scope,
+			CategoryID: p.CategoryID,
+			ProductID:  p.ProductID,
+			StartsAt:   p.StartsAt,
+			EndsAt:     p.EndsAt,
+			Stackable:  p.Stackable,
+			Priority:   p.Priority,
+			CreatedAt:  p.CreatedAt,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func dumpScheduledChanges(q querier, handle func(backup.ScheduledChange) error) error {
+	rows, err := q.Query(`SELECT sc.id, sc.product_id, sc.changes, sc.effective_at, sc.status, COALESCE(sc.error, ''),
+        COALESCE(u.username, ''), sc.created_at, sc.status_updated_at
+        FROM scheduled_changes sc LEFT JOIN users u ON u.id = sc.created_by ORDER BY sc.id`)
+	if err != nil {
+		return fmt.Errorf("error querying scheduled changes: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			s       backup.ScheduledChange
+			changes []byte
+		)
+		if err := rows.Scan(&s.ID, &s.ProductID, &changes, &s.EffectiveAt, &s.Status, &s.Error,
+			&s.CreatedBy, &s.CreatedAt, &s.StatusUpdatedAt); err != nil {
+			return fmt.Errorf("error scanning scheduled change: %w", err)
+		}
+		s.Changes = changes
+		if err := handle(s); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func dumpOrders(q querier, handle func(backup.Order) error) error {
+	lastID := 0
+	for {
+		orders, err := queryBackupOrders(q, lastID)
+		if err != nil {
+			return err
+		}
+		if len(orders) == 0 {
+			return nil
+		}
+
+		ids := make([]int, len(orders))
+		for i, order := range orders {
+			ids[i] = order.ID
+		}
+		items, err := loadBackupOrderItems(q, ids)
+		if err != nil {
+			return err
+		}
+
+		for _, order := range orders {
+			order.Items = items[order.ID]
+			if order.Items == nil {
+				order.Items = []backup.OrderItem{}
+			}
+			if err := handle(order); err != nil {
+				return err
+			}
+		}
+		lastID = orders[len(orders)-1].ID
+	}
+}
+
+// queryBackupOrders returns the next page of orders after lastID.
+func queryBackupOrders(q querier, lastID int) ([]backup.Order, error) {
+	rows, err := q.Query(`SELECT o.id, u.username, o.status, o.currency, o.total, o.created_at, o.status_updated_at
+        FROM orders o JOIN users u ON u.id = o.user_id WHERE o.id > $1 ORDER BY o.id LIMIT $2`, lastID, exportPageSize)
+	if err != nil {
+		return nil, fmt.Errorf("error querying orders: %w", err)
+	}
+	defer rows.Close()
+
+	var orders []backup.Order
+	for rows.Next() {
+		var o backup.Order
+		if err := rows.Scan(&o.ID, &o.Username, &o.Status, &o.Currency, &o.Total, &o.CreatedAt, &o.StatusUpdatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning order: %w", err)
+		}
+		orders = append(orders, o)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating orders: %w", err)
+	}
+
+	return orders, nil
+}
+
+// loadBackupOrderItems returns the items of every given order keyed by order
+// ID, in the order they were written.
+func loadBackupOrderItems(q querier, orderIDs []int) (map[int][]backup.OrderItem, error) {
+	rows, err := q.Query(`SELECT oi.order_id, oi.product_id, COALESCE(v.sku, ''), oi.product_name, oi.sku, oi.quantity, oi.unit_price,
+        oi.stock_item_id IS NOT NULL
+        FROM order_items oi LEFT JOIN product_variants v ON v.id = oi.variant_id
+        WHERE oi.order_id = ANY($1) ORDER BY oi.order_id, oi.id`, pq.Array(orderIDs))
+	if err != nil {
+		return nil, fmt.Errorf("error fetching items for orders: %w", err)
+	}
+	defer rows.Close()
+
+	items := make(map[int][]backup.OrderItem, len(orderIDs))
+	for rows.Next() {
+		var (
+			orderID int
+			item    backup.OrderItem
+		)
+		if err := rows.Scan(&orderID, &item.ProductID, &item.VariantSKU, &item.ProductName, &item.SKU,
+			&item.Quantity, &item.UnitPrice, &item.Stocked); err != nil {
+			return nil, fmt.Errorf("error scanning order item: %w", err)
+		}
+		items[orderID] = append(items[orderID], item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating order items: %w", err)
+	}
+
+	return items, nil
+}
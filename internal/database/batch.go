@@ -0,0 +1,132 @@
+package database
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/say8hi/go-api-test/internal/media"
+	"github.com/say8hi/go-api-test/internal/models"
+)
+
+// MaxBatchOperations is the most operations one batch may hold.
+const MaxBatchOperations = 1000
+
+// BatchProducts applies product operations in order in one transaction, each
+// the way CreateProduct, UpdateProduct and DeleteProduct would. Every
+// operation runs under its own savepoint, so a failing operation is reported
+// and the next ones still run. An atomic batch is committed only when every
+// operation succeeded; otherwise those that did are reported as rolled back.
+func BatchProducts(request models.BatchRequest) (models.BatchReport, error) {
+	report := models.BatchReport{Atomic: request.Atomic, Results: make([]models.BatchResult, len(request.Operations))}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return report, err
+	}
+	defer tx.Rollback()
+
+	// Files of deleted products are removed once the deletes are committed.
+	var imageKeys []string
+	for i, operation := range request.Operations {
+		if _, err := tx.Exec(`SAVEPOINT batch_operation`); err != nil {
+			return report, err
+		}
+
+		result, keys, err := batchOperationTx(tx, operation)
+		result.Index, result.Op = i, operation.Op
+		if err != nil {
+			if _, rollbackErr := tx.Exec(`ROLLBACK TO SAVEPOINT batch_operation`); rollbackErr != nil {
+				return report, rollbackErr
+			}
+			result.Status = models.BatchFailed
+			result.Error = batchErrorMessage(err)
+			report.Failed++
+		} else if _, err := tx.Exec(`RELEASE SAVEPOINT batch_operation`); err != nil {
+			return report, err
+		} else {
+			imageKeys = append(imageKeys, keys...)
+			report.Succeeded++
+		}
+		report.Results[i] = result
+	}
+
+	if request.Atomic && report.Failed > 0 {
+		for i := range report.Results {
+			if report.Results[i].Status != models.BatchFailed {
+				report.Results[i].Status = models.BatchRolledBack
+			}
+		}
+		report.Succeeded = 0
+		return report, nil
+	}
+
+	if err := tx.Commit(); err != nil {
+		return report, err
+	}
+	report.Committed = true
+	media.Delete(imageKeys...)
+	return report, nil
+}
+
+// batchOperationTx applies one operation inside tx and returns its result and,
+// for deletes, the keys of the image files to remove.
+func batchOperationTx(tx *sql.Tx, operation models.BatchOperation) (models.BatchResult, []string, error) {
+	result := models.BatchResult{ID: operation.ID}
+	switch operation.Op {
+	case models.BatchCreate:
+		var request models.CreateProductRequest
+		if err := decodeBatchProduct(operation.Product, &request); err != nil {
+			return result, nil, err
+		}
+		product, err := createProductTx(tx, request)
+		result.ID, result.Status = product.ID, models.BatchCreated
+		return result, nil, err
+
+	case models.BatchUpdate:
+		if operation.ID == 0 {
+			return result, nil, errors.New("id is required")
+		}
+		var request models.ProductUpdateRequest
+		if err := decodeBatchProduct(operation.Product, &request); err != nil {
+			return result, nil, err
+		}
+		result.Status = models.BatchUpdated
+		return result, nil, updateProductTx(tx, operation.ID, request)
+
+	case models.BatchDelete:
+		if operation.ID == 0 {
+			return result, nil, errors.New("id is required")
+		}
+		if err := productExists(tx, operation.ID); err != nil {
+			return result, nil, err
+		}
+		keys, err := productImageKeysTx(tx, operation.ID)
+		if err != nil {
+			return result, nil, err
+		}
+		result.Status = models.BatchDeleted
+		return result, keys, deleteProductTx(tx, operation.ID)
+	}
+
+	return result, nil, fmt.Errorf("unknown op %q, use create, update or delete", operation.Op)
+}
+
+func decodeBatchProduct(product json.RawMessage, request interface{}) error {
+	if len(bytes.TrimSpace(product)) == 0 {
+		return errors.New("product is required")
+	}
+	if err := json.Unmarshal(product, request); err != nil {
+		return fmt.Errorf("invalid product: %w", err)
+	}
+	return nil
+}
+
+func batchErrorMessage(err error) string {
+	if err == sql.ErrNoRows {
+		return "product not found"
+	}
+	return importErrorMessage(err)
+}
@@ -0,0 +1,261 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/say8hi/go-api-test/internal/models"
+)
+
+const exportPageSize = 500
+
+const (
+	MatchByName       = "name"
+	MatchByExternalID = "external_id"
+)
+
+// ExportProducts passes all products to write in ID order, one page at a time.
+// All pages come from the same snapshot, so concurrent writes don't produce
+// duplicates or gaps.
+func ExportProducts(write func([]models.Product) error) error {
+	tx, err := db.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `SELECT ` + productColumns + ` FROM products p WHERE p.id > $1 ORDER BY p.id LIMIT $2`
+	lastID := 0
+	for {
+		products, err := queryProducts(tx, query, lastID, exportPageSize)
+		if err != nil {
+			return err
+		}
+		if len(products) == 0 {
+			return nil
+		}
+
+		if err := write(products); err != nil {
+			return err
+		}
+		lastID = products[len(products)-1].ID
+	}
+}
+
+func ExportCategories(write func([]models.Category) error) error {
+	tx, err := db.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	lastID := 0
+	for {
+		rows, err := tx.Query(`SELECT `+categoryColumns+` FROM categories c WHERE id > $1 ORDER BY id LIMIT $2`, lastID, exportPageSize)
+		if err != nil {
+			return fmt.Errorf("error querying categories: %w", err)
+		}
+
+		var categories []models.Category
+		for rows.Next() {
+			c, err := scanCategory(rows)
+			if err != nil {
+				rows.Close()
+				return fmt.Errorf("error scanning category: %w", err)
+			}
+			categories = append(categories, c)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("error iterating categories: %w", err)
+		}
+		if len(categories) == 0 {
+			return nil
+		}
+
+		if err := write(categories); err != nil {
+			return err
+		}
+		lastID = categories[len(categories)-1].ID
+	}
+}
+
+// ImportProducts creates or updates each record, matching existing products
+// by name or external ID, in one transaction. Every record runs under its own
+// savepoint, so a failing record is reported without affecting the others.
+// Categories that don't exist yet are created.
+func ImportProducts(records []models.ProductRecord, matchBy string) ([]models.ImportRowResult, error) {
+	return importRecords(len(records), func(tx *sql.Tx, i int) (models.ImportRowResult, error) {
+		return importProductTx(tx, records[i], matchBy)
+	})
+}
+
+// ImportCategories creates or updates each record, matching existing
+// categories by name, like ImportProducts.
+func ImportCategories(records []models.CategoryRecord) ([]models.ImportRowResult, error) {
+	return importRecords(len(records), func(tx *sql.Tx, i int) (models.ImportRowResult, error) {
+		return importCategoryTx(tx, records[i])
+	})
+}
+
+func importRecords(count int, importOne func(tx *sql.Tx, i int) (models.ImportRowResult, error)) ([]models.ImportRowResult, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	results := make([]models.ImportRowResult, count)
+	for i := 0; i < count; i++ {
+		if _, err := tx.Exec(`SAVEPOINT import_record`); err != nil {
+			return nil, err
+		}
+
+		result, err := importOne(tx, i)
+		if err != nil {
+			if _, rollbackErr := tx.Exec(`ROLLBACK TO SAVEPOINT import_record`); rollbackErr != nil {
+				return nil, rollbackErr
+			}
+			result.Status = models.ImportFailed
+			result.ID = 0
+			result.Error = importErrorMessage(err)
+		} else if _, err := tx.Exec(`RELEASE SAVEPOINT import_record`); err != nil {
+			return nil, err
+		}
+		results[i] = result
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+func importProductTx(tx *sql.Tx, record models.ProductRecord, matchBy string) (models.ImportRowResult, error) {
+	result := models.ImportRowResult{Row: record.Row}
+	if strings.TrimSpace(record.Name) == "" {
+		return result, errors.New("name is required")
+	}
+
+	for _, name := range record.Categories {
+		if _, err := ensureCategoryTx(tx, name, ""); err != nil {
+			return result, err
+		}
+	}
+
+	var err error
+	switch matchBy {
+	case MatchByExternalID:
+		if record.ExternalID == "" {
+			return result, errors.New("external_id is required")
+		}
+		err = tx.QueryRow(`SELECT id FROM products WHERE external_id = $1`, record.ExternalID).Scan(&result.ID)
+	default:
+		err = tx.QueryRow(`SELECT id FROM products WHERE lower(name) = lower($1)`, record.Name).Scan(&result.ID)
+	}
+
+	if err == sql.ErrNoRows {
+		if !hasField(record.Fields, "price") {
+			return result, errors.New("price is required for new products")
+		}
+		product, err := createProductTx(tx, models.CreateProductRequest{
+			ExternalID:  record.ExternalID,
+			Name:        record.Name,
+			Description: record.Description,
+			Price:       record.Price,
+			Currency:    record.Currency,
+			Categories:  record.Categories,
+			Attributes:  record.Attributes,
+		})
+		result.ID = product.ID
+		result.Status = models.ImportCreated
+		return result, err
+	} else if err != nil {
+		return result, err
+	}
+
+	// Fields the record leaves out keep their values.
+	update := models.ProductUpdateRequest{Name: &record.Name, Attributes: record.Attributes}
+	if hasField(record.Fields, "description") {
+		update.Description = &record.Description
+	}
+	if hasField(record.Fields, "price") {
+		update.Price = &record.Price
+	}
+	if hasField(record.Fields, "categories") {
+		update.Categories = record.Categories
+	}
+	if record.ExternalID != "" {
+		update.ExternalID = &record.ExternalID
+	}
+	if record.Currency != "" {
+		update.Currency = &record.Currency
+	}
+
+	result.Status = models.ImportUpdated
+	return result, updateProductTx(tx, result.ID, update)
+}
+
+func importCategoryTx(tx *sql.Tx, record models.CategoryRecord) (models.ImportRowResult, error) {
+	result := models.ImportRowResult{Row: record.Row}
+	if strings.TrimSpace(record.Name) == "" {
+		return result, errors.New("name is required")
+	}
+
+	err := tx.QueryRow(`SELECT id FROM categories WHERE lower(name) = lower($1)`, record.Name).Scan(&result.ID)
+	if err == sql.ErrNoRows {
+		category, err := createCategoryTx(tx, models.CreateCategoryRequest{Name: record.Name, Description: record.Description})
+		result.ID = category.ID
+		result.Status = models.ImportCreated
+		return result, err
+	} else if err != nil {
+		return result, err
+	}
+
+	update := models.CategoryUpdateRequest{Name: &record.Name}
+	if hasField(record.Fields, "description") {
+		update.Description = &record.Description
+	}
+
+	result.Status = models.ImportUpdated
+	return result, updateCategoryTx(tx, result.ID, update)
+}
+
+// hasField reports whether an imported record has field. Records without a
+// field list, such as those built in code, have every field.
+func hasField(fields map[string]bool, field string) bool {
+	return fields == nil || fields[field]
+}
+
+// ensureCategoryTx returns the ID of the category called name, creating it
+// when it doesn't exist.
+func ensureCategoryTx(tx *sql.Tx, name, description string) (int, error) {
+	slug, err := categorySlugs.slugTx(tx, "", name)
+	if err != nil {
+		return 0, err
+	}
+
+	var categoryID int
+	err = tx.QueryRow("INSERT INTO categories (name, slug, description) VALUES ($1, $2, $3) ON CONFLICT ((lower(name))) DO NOTHING RETURNING id",
+		name, slug, description).Scan(&categoryID)
+	if err == nil {
+		return categoryID, enqueueCategoryEvent(tx, categoryID, models.EventCategoryCreated)
+	} else if err != sql.ErrNoRows {
+		return 0, fmt.Errorf("error inserting category: %w", constraintError(err))
+	}
+
+	err = tx.QueryRow(`SELECT id FROM categories WHERE lower(name) = lower($1)`, name).Scan(&categoryID)
+	return categoryID, err
+}
+
+func importErrorMessage(err error) string {
+	var constraintErr *ConstraintError
+	if errors.As(err, &constraintErr) {
+		return constraintErr.Message
+	}
+	return err.Error()
+}
@@ -0,0 +1,175 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/say8hi/go-api-test/internal/models"
+)
+
+// categoryTreeLock is the advisory lock key held while a category is moved,
+// so two concurrent moves can't combine into a cycle.
+const categoryTreeLock = 727003
+
+var ErrParentCategoryNotFound = errors.New("parent category doesn't exist")
+var ErrCategoryCycle = errors.New("a category can't be moved into its own subtree")
+
+// subtreeQuery selects categoryColumns of category $1 and all its descendants,
+// siblings in their order.
+const subtreeQuery = `
+WITH RECURSIVE subtree AS (
+    SELECT id FROM categories WHERE id = $1
+    UNION
+    SELECT child.id FROM categories child JOIN subtree ON child.parent_id = subtree.id
+)
+SELECT ` + categoryColumns + ` FROM categories c JOIN subtree ON subtree.id = c.id ORDER BY c.position NULLS LAST, c.id`
+
+// GetCategoryTree returns all top-level categories with their subcategories.
+func GetCategoryTree() ([]*models.CategoryNode, error) {
+	categories, err := GetAllCategories()
+	if err != nil {
+		return nil, err
+	}
+
+	roots, _ := buildCategoryTree(categories)
+	return roots, nil
+}
+
+// GetCategorySubtree returns the category with its subcategories.
+func GetCategorySubtree(categoryID int) (*models.CategoryNode, error) {
+	categories, err := queryCategories(db, subtreeQuery, categoryID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying category subtree: %w", err)
+	}
+
+	_, nodes := buildCategoryTree(categories)
+	node, ok := nodes[categoryID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return node, nil
+}
+
+// GetCategoryPath returns the breadcrumb of a category: its ancestors from the
+// top level down, followed by the category itself.
+func GetCategoryPath(categoryID int) ([]models.Category, error) {
+	query := `
+WITH RECURSIVE path AS (
+    SELECT id, parent_id, 0 AS depth FROM categories WHERE id = $1
+    UNION ALL
+    SELECT parent.id, parent.parent_id, path.depth + 1 FROM categories parent JOIN path ON parent.id = path.parent_id
+)
+SELECT ` + categoryColumns + ` FROM categories c JOIN path ON path.id = c.id ORDER BY path.depth DESC`
+	categories, err := queryCategories(db, query, categoryID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying category path: %w", err)
+	}
+	if len(categories) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return categories, nil
+}
+
+// MoveCategory puts a category with its subtree under parentID, or at the top
+// level when parentID is nil.
+func MoveCategory(categoryID int, parentID *int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock($1)`, categoryTreeLock); err != nil {
+		return err
+	}
+
+	if err := categoryExists(tx, categoryID); err != nil {
+		return err
+	}
+
+	if parentID != nil {
+		if err := categoryExists(tx, *parentID); err == sql.ErrNoRows {
+			return invalidInput("categories_parent_id", ErrParentCategoryNotFound)
+		} else if err != nil {
+			return err
+		}
+
+		var cycle bool
+		err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM (`+subtreeQuery+`) c WHERE c.id = $2)`, categoryID, *parentID).Scan(&cycle)
+		if err != nil {
+			return err
+		}
+		if cycle {
+			return invalidInput("categories_parent_cycle", ErrCategoryCycle)
+		}
+	}
+
+	// A moved category goes after its new siblings.
+	if _, err := tx.Exec(`UPDATE categories SET parent_id = $1, position = NULL WHERE id = $2 AND parent_id IS DISTINCT FROM $1`,
+		parentID, categoryID); err != nil {
+		return fmt.Errorf("error moving category: %w", constraintError(err))
+	}
+
+	if err := enqueueCategoryEvent(tx, categoryID, models.EventCategoryUpdated); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// buildCategoryTree links categories to their parents. Categories whose parent
+// isn't in the list are returned as roots. It also returns every node by ID.
+func buildCategoryTree(categories []models.Category) ([]*models.CategoryNode, map[int]*models.CategoryNode) {
+	nodes := make(map[int]*models.CategoryNode, len(categories))
+	for _, category := range categories {
+		nodes[category.ID] = &models.CategoryNode{Category: category, Children: []*models.CategoryNode{}}
+	}
+
+	roots := []*models.CategoryNode{}
+	for _, category := range categories {
+		node := nodes[category.ID]
+		if category.ParentID != nil {
+			if parent, ok := nodes[*category.ParentID]; ok {
+				parent.Children = append(parent.Children, node)
+				continue
+			}
+		}
+		roots = append(roots, node)
+	}
+	return roots, nodes
+}
+
+func queryCategories(q querier, query string, args ...interface{}) ([]models.Category, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	categories := []models.Category{}
+	for rows.Next() {
+		category, err := scanCategory(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning category: %w", err)
+		}
+		categories = append(categories, category)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating categories: %w", err)
+	}
+
+	return categories, nil
+}
+
+func categoryExists(q querier, categoryID int) error {
+	var exists bool
+	err := q.QueryRow(`SELECT EXISTS (SELECT 1 FROM categories WHERE id = $1)`, categoryID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return sql.ErrNoRows
+	}
+	return nil
+}
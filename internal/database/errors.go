@@ -0,0 +1,129 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// ConstraintError is returned when a write violates a catalog constraint,
+// either enforced by Postgres or checked before the write. Conflict is set for
+// unique and foreign key violations; everything else is invalid input.
+type ConstraintError struct {
+	Constraint string
+	Conflict   bool
+	Message    string
+}
+
+func (e *ConstraintError) Error() string {
+	return e.Message
+}
+
+var constraintMessages = map[string]string{
+	"users_username_key":          "This username is already taken.",
+	"products_name_lower_key":     "A product with this name already exists.",
+	"products_name_not_blank":     "Product name must not be empty.",
+	"products_price_non_negative": "Product price must not be negative.",
+	"products_external_id_key":    "A product with this external ID already exists.",
+	"categories_name_lower_key":   "A category with this name already exists.",
+	"categories_name_not_blank":   "Category name must not be empty.",
+	"categories_parent_id_fkey":   "The category still has subcategories or its parent doesn't exist.",
+	"categories_parent_not_self":  "A category can't be its own parent.",
+
+	"product_prices_amount_non_negative": "Price must not be negative.",
+	"exchange_rates_rate_positive":       "Exchange rate must be positive.",
+	"exchange_rates_distinct_currencies": "An exchange rate needs two different currencies.",
+
+	"product_variants_sku_key":            "A variant with this SKU already exists.",
+	"product_variants_sku_not_blank":      "Variant SKU must not be empty.",
+	"product_variants_options_key":        "The product already has a variant with these options.",
+	"product_variants_price_non_negative": "Variant price must not be negative.",
+
+	"stock_items_on_hand_non_negative":     "Stock on hand must not be negative.",
+	"stock_items_reserved_within_on_hand":  "Stock can't drop below the reserved quantity.",
+	"stock_reservations_quantity_positive": "Reserved quantity must be positive.",
+	"stock_movements_reason_not_blank":     "A reason is required for stock adjustments.",
+
+	"product_images_url_key": "The product already has this image.",
+
+	"category_attributes_name_key":    "The category already has an attribute with this name.",
+	"category_attributes_name_format": "Attribute names must start with a letter and contain only lowercase letters, digits and underscores.",
+	"category_attributes_type_check":  "Attribute type must be string, number or boolean.",
+
+	"tags_name_format": "Tags must not be empty or longer than 64 characters.",
+
+	"products_status_check": "Product status must be draft, active or archived.",
+
+	"products_slug_key":      "Another product has or had this slug.",
+	"products_slug_format":   "Slugs must consist of lowercase letters and digits separated by single hyphens, at most 100 characters.",
+	"categories_slug_key":    "Another category has or had this slug.",
+	"categories_slug_format": "Slugs must consist of lowercase letters and digits separated by single hyphens, at most 100 characters.",
+
+	"translations_locale_unsupported":      "Translations are only kept for the supported locales other than the default one.",
+	"product_translations_name_not_blank":  "Translated name must not be empty.",
+	"category_translations_name_not_blank": "Translated name must not be empty.",
+
+	"reviews_rating_range":     "Rating must be between 1 and 5.",
+	"reviews_status_check":     "Review status must be pending, approved or rejected.",
+	"reviews_product_user_key": "You have already reviewed this product.",
+
+	"cart_items_quantity_positive": "Quantity must be positive.",
+	"cart_items_variant_available": "The variant is not available.",
+	"cart_items_currency":          "All items of a cart must be priced in the same currency.",
+	"cart_empty":                   "The cart is empty.",
+	"orders_status_check":          "Order status must be placed, paid, shipped, delivered or cancelled.",
+
+	"promotions_name_not_blank":    "Promotion name must not be empty.",
+	"promotions_kind_check":        "Promotion kind must be percentage or fixed.",
+	"promotions_value_range":       "Promotion value must be positive, and at most 100 for percentages.",
+	"promotions_currency_required": "Fixed promotions need a currency; percentage promotions have none.",
+	"promotions_scope_check":       "Promotion scope must be catalog, category or product.",
+	"promotions_scope_target":      "Category promotions need a category_id and product promotions a product_id, and nothing else.",
+	"promotions_period":            "A promotion must end after it starts.",
+	"promotions_category_id_fkey":  "The category doesn't exist.",
+	"promotions_product_id_fkey":   "The product doesn't exist.",
+
+	"product_relations_type_check": "Relation type must be accessory, similar or replacement.",
+	"product_relations_not_self":   "A product can't be related to itself.",
+
+	"scheduled_changes_effective_at": "Changes must be scheduled for a time in the future.",
+	"scheduled_changes_status_check": "Scheduled change status must be pending, applied, failed or cancelled.",
+}
+
+func invalidInput(constraint string, err error) *ConstraintError {
+	return &ConstraintError{Constraint: constraint, Message: err.Error()}
+}
+
+// constraintError converts constraint violations into a *ConstraintError and
+// returns every other error unchanged.
+func constraintError(err error) error {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return err
+	}
+
+	constraintErr := &ConstraintError{Constraint: pqErr.Constraint}
+	switch pqErr.Code {
+	case "23505":
+		constraintErr.Conflict = true
+		constraintErr.Message = "A record with the same value already exists."
+	case "23503":
+		constraintErr.Conflict = true
+		constraintErr.Message = "The record is referenced by or references a missing record."
+	case "23514":
+		constraintErr.Message = "A value is out of the allowed range."
+	case "23502":
+		constraintErr.Message = fmt.Sprintf("Field %s is required.", pqErr.Column)
+	case "22001", "22003":
+		constraintErr.Message = "A value is too long or too large."
+	default:
+		return err
+	}
+
+	if message, ok := constraintMessages[pqErr.Constraint]; ok {
+		constraintErr.Message = message
+	}
+
+	return constraintErr
+}
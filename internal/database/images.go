@@ -0,0 +1,266 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/lib/pq"
+	"github.com/say8hi/go-api-test/internal/media"
+	"github.com/say8hi/go-api-test/internal/models"
+)
+
+// imageColumns is the column list of product_images queries, in the order
+// expected by scanImage. Queries must alias product_images as i.
+const imageColumns = `i.id, i.product_id, i.url, COALESCE(i.thumbnail_url, ''), COALESCE(i.content_type, ''),
+COALESCE(i.width, 0), COALESCE(i.height, 0), COALESCE(i.size_bytes, 0), i.position, i.is_primary`
+
+func scanImage(row rowScanner) (models.ProductImage, error) {
+	var image models.ProductImage
+	err := row.Scan(&image.ID, &image.ProductID, &image.URL, &image.ThumbnailURL, &image.ContentType,
+		&image.Width, &image.Height, &image.Size, &image.Position, &image.Primary)
+	return image, err
+}
+
+// Table Product Images
+func GetProductImages(productID int) ([]models.ProductImage, error) {
+	if err := productExists(db, productID); err != nil {
+		return nil, err
+	}
+
+	images, err := loadProductImages(db, []int{productID})
+	if err != nil {
+		return nil, err
+	}
+	if images[productID] == nil {
+		return []models.ProductImage{}, nil
+	}
+	return images[productID], nil
+}
+
+// AddProductImage adds a stored image after the other images of the product.
+// The first image of a product becomes its primary image.
+func AddProductImage(productID int, stored media.StoredImage) (models.ProductImage, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return models.ProductImage{}, err
+	}
+	defer tx.Rollback()
+
+	if err := lockProductTx(tx, productID); err != nil {
+		return models.ProductImage{}, err
+	}
+
+	query := `
+INSERT INTO product_images AS i (product_id, url, thumbnail_url, object_key, thumbnail_key, content_type, width, height, size_bytes, position, is_primary)
+SELECT $1, $2, $3, $4, $5, $6, $7, $8, $9, COALESCE(MAX(position), 0) + 1, COUNT(*) = 0
+FROM product_images WHERE product_id = $1
+RETURNING ` + imageColumns
+	image, err := scanImage(tx.QueryRow(query, productID, stored.URL, stored.ThumbnailURL, stored.Key, stored.ThumbnailKey,
+		stored.ContentType, stored.Width, stored.Height, stored.Size))
+	if err != nil {
+		return models.ProductImage{}, fmt.Errorf("error adding image: %w", constraintError(err))
+	}
+
+	if err := enqueueProductEvent(tx, productID, models.EventProductUpdated); err != nil {
+		return models.ProductImage{}, err
+	}
+
+	return image, tx.Commit()
+}
+
+// DeleteProductImage removes an image and, once it is gone, its stored files.
+// When the primary image is removed the next image becomes primary.
+func DeleteProductImage(productID, imageID int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := lockProductTx(tx, productID); err != nil {
+		return err
+	}
+
+	var (
+		primary           bool
+		key, thumbnailKey sql.NullString
+	)
+	err = tx.QueryRow(`DELETE FROM product_images WHERE product_id = $1 AND id = $2 RETURNING is_primary, object_key, thumbnail_key`,
+		productID, imageID).Scan(&primary, &key, &thumbnailKey)
+	if err != nil {
+		return err
+	}
+
+	if primary {
+		_, err := tx.Exec(`UPDATE product_images SET is_primary = true
+            WHERE id = (SELECT id FROM product_images WHERE product_id = $1 ORDER BY position, id LIMIT 1)`, productID)
+		if err != nil {
+			return fmt.Errorf("error choosing primary image: %w", err)
+		}
+	}
+
+	if err := enqueueProductEvent(tx, productID, models.EventProductUpdated); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	for _, k := range []sql.NullString{key, thumbnailKey} {
+		if k.Valid {
+			media.Delete(k.String)
+		}
+	}
+	return nil
+}
+
+// SetPrimaryImage makes an image the primary image of its product.
+func SetPrimaryImage(productID, imageID int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := lockProductTx(tx, productID); err != nil {
+		return err
+	}
+
+	var exists bool
+	err = tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM product_images WHERE product_id = $1 AND id = $2)`, productID, imageID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return sql.ErrNoRows
+	}
+
+	// The old primary image is cleared first, as only one image of a product
+	// may be primary at any time.
+	if _, err := tx.Exec(`UPDATE product_images SET is_primary = false WHERE product_id = $1 AND is_primary`, productID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE product_images SET is_primary = true WHERE id = $1`, imageID); err != nil {
+		return err
+	}
+
+	if err := enqueueProductEvent(tx, productID, models.EventProductUpdated); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ReorderProductImages puts the images of a product in the given order, which
+// must list each of them exactly once.
+func ReorderProductImages(productID int, imageIDs []int) ([]models.ProductImage, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := lockProductTx(tx, productID); err != nil {
+		return nil, err
+	}
+
+	var current []int64
+	if err := tx.QueryRow(`SELECT COALESCE(array_agg(id ORDER BY id), '{}') FROM product_images WHERE product_id = $1`,
+		productID).Scan(pq.Array(&current)); err != nil {
+		return nil, err
+	}
+	if !sameIDs(current, imageIDs) {
+		return nil, invalidInput("product_images_order", errors.New("image_ids must list every image of the product once"))
+	}
+
+	_, err = tx.Exec(`UPDATE product_images i SET position = o.position
+        FROM unnest($2::int[]) WITH ORDINALITY AS o(id, position)
+        WHERE i.product_id = $1 AND i.id = o.id`, productID, pq.Array(imageIDs))
+	if err != nil {
+		return nil, fmt.Errorf("error reordering images: %w", err)
+	}
+
+	if err := enqueueProductEvent(tx, productID, models.EventProductUpdated); err != nil {
+		return nil, err
+	}
+
+	images, err := loadProductImages(tx, []int{productID})
+	if err != nil {
+		return nil, err
+	}
+	if images[productID] == nil {
+		images[productID] = []models.ProductImage{}
+	}
+
+	return images[productID], tx.Commit()
+}
+
+// linkIngestedImagesTx adds images hosted by the source to a product by URL.
+// Images the product already has and URLs that aren't http(s) are skipped. It
+// returns the number of images added.
+func linkIngestedImagesTx(tx *sql.Tx, productID int, urls []string) (int64, error) {
+	var added int64
+	for _, imageURL := range urls {
+		parsed, err := url.Parse(imageURL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			continue
+		}
+
+		result, err := tx.Exec(`
+INSERT INTO product_images (product_id, url, position, is_primary)
+SELECT $1, $2, COALESCE(MAX(position), 0) + 1, COUNT(*) = 0 FROM product_images WHERE product_id = $1
+ON CONFLICT (product_id, url) DO NOTHING`, productID, imageURL)
+		if err != nil {
+			return 0, fmt.Errorf("error adding image: %w", err)
+		}
+		inserted, _ := result.RowsAffected()
+		added += inserted
+	}
+	return added, nil
+}
+
+// productImageKeysTx returns the keys of the stored files of a product's
+// images.
+func productImageKeysTx(tx *sql.Tx, productID int) ([]string, error) {
+	var keys []string
+	err := tx.QueryRow(`
+SELECT COALESCE(array_agg(key), '{}') FROM product_images, unnest(ARRAY[object_key, thumbnail_key]) AS key
+WHERE product_id = $1 AND key IS NOT NULL`, productID).Scan(pq.Array(&keys))
+	if err != nil {
+		return nil, fmt.Errorf("error querying product images: %w", err)
+	}
+	return keys, nil
+}
+
+// lockProductTx locks a product, so changes to its images are serialized.
+func lockProductTx(tx *sql.Tx, productID int) error {
+	var id int
+	return tx.QueryRow(`SELECT id FROM products WHERE id = $1 FOR UPDATE`, productID).Scan(&id)
+}
+
+// loadProductImages returns the images of every given product keyed by
+// product ID, in their order.
+func loadProductImages(q querier, productIDs []int) (map[int][]models.ProductImage, error) {
+	query := `SELECT ` + imageColumns + ` FROM product_images i WHERE i.product_id = ANY($1) ORDER BY i.product_id, i.position, i.id`
+	rows, err := q.Query(query, pq.Array(productIDs))
+	if err != nil {
+		return nil, fmt.Errorf("error fetching images for products: %w", err)
+	}
+	defer rows.Close()
+
+	images := make(map[int][]models.ProductImage, len(productIDs))
+	for rows.Next() {
+		image, err := scanImage(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning image: %w", err)
+		}
+		images[image.ProductID] = append(images[image.ProductID], image)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating images: %w", err)
+	}
+
+	return images, nil
+}
@@ -0,0 +1,244 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/say8hi/go-api-test/internal/models"
+	"github.com/say8hi/go-api-test/internal/money"
+)
+
+// IngestPolicy decides whether the datacollector may overwrite a field of an
+// existing product.
+type IngestPolicy string
+
+const (
+	// PolicySourceWins always takes the value from the datacollector.
+	PolicySourceWins IngestPolicy = "source"
+	// PolicyAPIWins keeps the catalog value once the product exists.
+	PolicyAPIWins IngestPolicy = "api"
+	// PolicyNewest takes the value observed last, comparing the time of the
+	// datacollector batch with the last change of the field.
+	PolicyNewest IngestPolicy = "newest"
+)
+
+type ingestPolicies struct {
+	description IngestPolicy
+	price       IngestPolicy
+	status      IngestPolicy
+}
+
+// loadIngestPolicies reads INGEST_DESCRIPTION_POLICY, INGEST_PRICE_POLICY and
+// INGEST_STATUS_POLICY. The price policy also covers the currency.
+func loadIngestPolicies() ingestPolicies {
+	return ingestPolicies{
+		description: ingestPolicy("INGEST_DESCRIPTION_POLICY"),
+		price:       ingestPolicy("INGEST_PRICE_POLICY"),
+		status:      ingestPolicy("INGEST_STATUS_POLICY"),
+	}
+}
+
+func ingestPolicy(env string) IngestPolicy {
+	switch policy := IngestPolicy(os.Getenv(env)); policy {
+	case PolicySourceWins, PolicyAPIWins, PolicyNewest:
+		return policy
+	case "":
+	default:
+		log.Printf("Unknown %s %q, using %s", env, policy, PolicyNewest)
+	}
+	return PolicyNewest
+}
+
+func (p IngestPolicy) sourceWins(observedAt, fieldUpdatedAt time.Time) bool {
+	switch p {
+	case PolicySourceWins:
+		return true
+	case PolicyAPIWins:
+		return false
+	default:
+		return observedAt.After(fieldUpdatedAt)
+	}
+}
+
+// ingestProductTx inserts or updates one product and links its categories,
+// images and tags.
+func ingestProductTx(tx *sql.Tx, product models.IngestProduct, observedAt time.Time, policies ingestPolicies) (string, error) {
+	if strings.TrimSpace(product.Name) == "" {
+		return models.IngestSkipped, nil
+	}
+
+	var description string
+	if product.Description != nil {
+		description = *product.Description
+	}
+	var price money.Amount
+	if product.Price != nil {
+		price = *product.Price
+	}
+	currency := product.Currency
+	if currency == "" {
+		currency = money.DefaultCurrency()
+	}
+	if err := money.Validate(price, currency); err != nil {
+		log.Printf("Skipping product %q: %s", product.Name, err)
+		return models.IngestSkipped, nil
+	}
+	if product.Status != "" && !ValidStatus(product.Status) {
+		log.Printf("Ignoring unknown status %q of product %q", product.Status, product.Name)
+		product.Status = ""
+	}
+	status := product.Status
+	if status == "" {
+		status = models.StatusActive
+	}
+
+	slug, err := productSlugs.slugTx(tx, "", product.Name)
+	if err != nil {
+		return "", err
+	}
+
+	var productID int
+	err = tx.QueryRow(`
+INSERT INTO products (name, slug, description, price, currency, status, description_updated_at, price_updated_at, status_updated_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $7, $7)
+ON CONFLICT ((lower(name))) DO NOTHING RETURNING id`,
+		product.Name, slug, description, price, currency, status, observedAt).Scan(&productID)
+	if err == nil {
+		if _, err := linkIngestedCategoriesTx(tx, productID, product.Categories); err != nil {
+			return "", err
+		}
+		if _, err := linkIngestedImagesTx(tx, productID, product.Images); err != nil {
+			return "", err
+		}
+		if _, err := linkIngestedTagsTx(tx, productID, product.Tags); err != nil {
+			return "", err
+		}
+		return models.IngestInserted, enqueueProductEvent(tx, productID, models.EventProductCreated)
+	} else if err != sql.ErrNoRows {
+		return "", fmt.Errorf("error inserting product: %w", err)
+	}
+
+	return updateIngestedProductTx(tx, product, observedAt, policies)
+}
+
+func updateIngestedProductTx(tx *sql.Tx, product models.IngestProduct, observedAt time.Time, policies ingestPolicies) (string, error) {
+	var (
+		productID            int
+		description          string
+		price                money.Amount
+		currency             string
+		status               string
+		descriptionUpdatedAt time.Time
+		priceUpdatedAt       time.Time
+		statusUpdatedAt      time.Time
+	)
+	err := tx.QueryRow(`
+SELECT id, description, price, currency, status, description_updated_at, price_updated_at, status_updated_at
+FROM products WHERE lower(name) = lower($1) FOR UPDATE`, product.Name).
+		Scan(&productID, &description, &price, &currency, &status, &descriptionUpdatedAt, &priceUpdatedAt, &statusUpdatedAt)
+	if err != nil {
+		return "", fmt.Errorf("error loading product: %w", err)
+	}
+
+	var setParts []string
+	var args []interface{}
+	set := func(column string, value interface{}) {
+		args = append(args, value)
+		setParts = append(setParts, fmt.Sprintf("%s = $%d", column, len(args)))
+	}
+
+	if product.Description != nil && *product.Description != description &&
+		policies.description.sourceWins(observedAt, descriptionUpdatedAt) {
+		set("description", *product.Description)
+		set("description_updated_at", observedAt)
+	}
+
+	if product.Price != nil {
+		newCurrency := product.Currency
+		if newCurrency == "" {
+			newCurrency = currency
+		}
+		if (*product.Price != price || newCurrency != currency) &&
+			policies.price.sourceWins(observedAt, priceUpdatedAt) {
+			if err := money.Validate(*product.Price, newCurrency); err != nil {
+				log.Printf("Skipping product %q: %s", product.Name, err)
+				return models.IngestSkipped, nil
+			}
+			set("price", *product.Price)
+			set("currency", newCurrency)
+			set("price_updated_at", observedAt)
+		}
+	}
+
+	// Transitions the API doesn't allow are ignored, like an active product
+	// the source reports as a draft.
+	if product.Status != "" && product.Status != status && canTransition(status, product.Status) &&
+		policies.status.sourceWins(observedAt, statusUpdatedAt) {
+		set("status", product.Status)
+		set("status_updated_at", observedAt)
+	}
+
+	if len(setParts) > 0 {
+		args = append(args, productID)
+		query := fmt.Sprintf("UPDATE products SET %s WHERE id = $%d", strings.Join(setParts, ", "), len(args))
+		if _, err := tx.Exec(query, args...); err != nil {
+			return "", fmt.Errorf("error updating product: %w", constraintError(err))
+		}
+	}
+
+	linked, err := linkIngestedCategoriesTx(tx, productID, product.Categories)
+	if err != nil {
+		return "", err
+	}
+	images, err := linkIngestedImagesTx(tx, productID, product.Images)
+	if err != nil {
+		return "", err
+	}
+	tags, err := linkIngestedTagsTx(tx, productID, product.Tags)
+	if err != nil {
+		return "", err
+	}
+
+	if len(setParts) == 0 && linked == 0 && images == 0 && tags == 0 {
+		return models.IngestUnchanged, nil
+	}
+	return models.IngestUpdated, enqueueProductEvent(tx, productID, models.EventProductUpdated)
+}
+
+// linkIngestedCategoriesTx adds the product to its categories, creating
+// missing ones, and checks its attributes against them when links were added.
+// Existing links are kept. It returns the number of new links.
+func linkIngestedCategoriesTx(tx *sql.Tx, productID int, categories []models.Category) (int64, error) {
+	var linked int64
+	for _, category := range categories {
+		if strings.TrimSpace(category.Name) == "" {
+			continue
+		}
+
+		categoryID, err := ensureCategoryTx(tx, category.Name, category.Description)
+		if err != nil {
+			return 0, err
+		}
+
+		result, err := tx.Exec(`INSERT INTO product_category (product_id, category_id) VALUES ($1, $2) ON CONFLICT (product_id, category_id) DO NOTHING`,
+			productID, categoryID)
+		if err != nil {
+			return 0, fmt.Errorf("error inserting product_category relationship: %w", err)
+		}
+		added, _ := result.RowsAffected()
+		linked += added
+	}
+
+	// The source has no attributes, so new categories must not require any
+	// the product lacks.
+	if linked > 0 {
+		if _, err := setProductAttributesTx(tx, productID, nil); err != nil {
+			return 0, err
+		}
+	}
+	return linked, nil
+}
@@ -0,0 +1,339 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"expvar"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	packagePrefix           = "github.com/say8hi/go-api-test/internal/database."
+	defaultSlowQuery        = 200 * time.Millisecond
+	explainIntervalPerQuery = time.Minute
+)
+
+var (
+	slowQueryThreshold = defaultSlowQuery
+	explainSlowQueries bool
+)
+
+// queryStats are the metrics of one statement, published through expvar as
+// db_queries keyed by its SQL.
+type queryStats struct {
+	Count   int64   `json:"count"`
+	Errors  int64   `json:"errors"`
+	Rows    int64   `json:"rows"`
+	Slow    int64   `json:"slow"`
+	TotalMs float64 `json:"total_ms"`
+	MaxMs   float64 `json:"max_ms"`
+}
+
+var (
+	statsMu        sync.Mutex
+	statsByQuery   = map[string]*queryStats{}
+	lastExplainsMu sync.Mutex
+	lastExplains   = map[string]time.Time{}
+)
+
+func init() {
+	expvar.Publish("db_queries", expvar.Func(func() interface{} {
+		statsMu.Lock()
+		defer statsMu.Unlock()
+
+		// Statements that differ only in whitespace are reported together.
+		snapshot := make(map[string]queryStats, len(statsByQuery))
+		for query, stats := range statsByQuery {
+			key := compactSQL(query)
+			merged := snapshot[key]
+			merged.Count += stats.Count
+			merged.Errors += stats.Errors
+			merged.Rows += stats.Rows
+			merged.Slow += stats.Slow
+			merged.TotalMs += stats.TotalMs
+			if stats.MaxMs > merged.MaxMs {
+				merged.MaxMs = stats.MaxMs
+			}
+			snapshot[key] = merged
+		}
+		return snapshot
+	}))
+}
+
+// configureInstrumentation reads DB_SLOW_QUERY_MS, the duration above which a
+// statement is logged (0 turns the log off), and DB_EXPLAIN_SLOW_QUERIES.
+func configureInstrumentation() {
+	if value := os.Getenv("DB_SLOW_QUERY_MS"); value != "" {
+		ms, err := strconv.Atoi(value)
+		if err != nil || ms < 0 {
+			log.Printf("Invalid DB_SLOW_QUERY_MS %q, using %s", value, defaultSlowQuery)
+		} else {
+			slowQueryThreshold = time.Duration(ms) * time.Millisecond
+		}
+	}
+	explainSlowQueries, _ = strconv.ParseBool(os.Getenv("DB_EXPLAIN_SLOW_QUERIES"))
+}
+
+// instrumentedConnector wraps the connections of the pool, so every statement
+// run through db or a transaction is measured. Slow statements are logged
+// with the names of the functions of this package that ran them; the call
+// stack is only walked for those.
+type instrumentedConnector struct {
+	driver.Connector
+}
+
+func (c instrumentedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedConn{Conn: conn}, nil
+}
+
+type instrumentedConn struct {
+	driver.Conn
+}
+
+func (c *instrumentedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	start := time.Now()
+	rows, err := c.Conn.(driver.QueryerContext).QueryContext(ctx, query, args)
+	duration := time.Since(start)
+	name := slowStatementName(duration)
+	if err != nil {
+		recordQuery(name, query, args, duration, 0, err)
+		return nil, err
+	}
+	return &instrumentedRows{Rows: rows, name: name, query: query, args: args, duration: duration}, nil
+}
+
+func (c *instrumentedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	start := time.Now()
+	result, err := c.Conn.(driver.ExecerContext).ExecContext(ctx, query, args)
+	duration := time.Since(start)
+	name := slowStatementName(duration)
+
+	var affected int64
+	if err == nil {
+		affected, _ = result.RowsAffected()
+	}
+	recordQuery(name, query, args, duration, affected, err)
+	return result, err
+}
+
+func (c *instrumentedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	return c.Conn.(driver.ConnBeginTx).BeginTx(ctx, opts)
+}
+
+func (c *instrumentedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	return c.Conn.(driver.ConnPrepareContext).PrepareContext(ctx, query)
+}
+
+func (c *instrumentedConn) Ping(ctx context.Context) error {
+	return c.Conn.(driver.Pinger).Ping(ctx)
+}
+
+func (c *instrumentedConn) ResetSession(ctx context.Context) error {
+	return c.Conn.(driver.SessionResetter).ResetSession(ctx)
+}
+
+func (c *instrumentedConn) IsValid() bool {
+	return c.Conn.(driver.Validator).IsValid()
+}
+
+// instrumentedRows counts the rows read and records the query when closed.
+// The duration is the time until the first response, not including the time
+// the caller spends reading.
+type instrumentedRows struct {
+	driver.Rows
+	name     string
+	query    string
+	args     []driver.NamedValue
+	duration time.Duration
+	rows     int64
+	err      error
+	closed   bool
+}
+
+func (r *instrumentedRows) Next(dest []driver.Value) error {
+	err := r.Rows.Next(dest)
+	if err == nil {
+		r.rows++
+	} else if err != io.EOF {
+		r.err = err
+	}
+	return err
+}
+
+func (r *instrumentedRows) Close() error {
+	if !r.closed {
+		r.closed = true
+		recordQuery(r.name, r.query, r.args, r.duration, r.rows, r.err)
+	}
+	return r.Rows.Close()
+}
+
+// recordQuery adds a statement to the metrics and logs it when it was slow.
+// name is only set for slow statements.
+func recordQuery(name, query string, args []driver.NamedValue, duration time.Duration, rows int64, err error) {
+	ms := float64(duration) / float64(time.Millisecond)
+	slow := isSlow(duration)
+
+	statsMu.Lock()
+	stats, ok := statsByQuery[query]
+	if !ok {
+		stats = &queryStats{}
+		statsByQuery[query] = stats
+	}
+	stats.Count++
+	stats.Rows += rows
+	stats.TotalMs += ms
+	if ms > stats.MaxMs {
+		stats.MaxMs = ms
+	}
+	if err != nil {
+		stats.Errors++
+	}
+	if slow {
+		stats.Slow++
+	}
+	statsMu.Unlock()
+
+	if !slow {
+		return
+	}
+
+	log.Printf("Slow query %s took %s, %d rows: %s [%s]", name, duration, rows, compactSQL(query), redactArgs(args))
+	if explainSlowQueries && explainable(query) && claimExplain(name) {
+		go explainQuery(name, query, args)
+	}
+}
+
+func isSlow(duration time.Duration) bool {
+	return slowQueryThreshold > 0 && duration >= slowQueryThreshold
+}
+
+// slowStatementName returns the name of a slow statement and an empty string
+// for the others, which don't need one.
+func slowStatementName(duration time.Duration) string {
+	if !isSlow(duration) {
+		return ""
+	}
+	return statementName()
+}
+
+// statementName names a statement after the outermost and innermost functions
+// of this package on the call stack, e.g. "GetProduct/queryProducts". It must
+// be called from slowStatementName.
+func statementName() string {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(4, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	var inner, outer string
+	for {
+		frame, more := frames.Next()
+		if name, ok := strings.CutPrefix(frame.Function, packagePrefix); ok && !strings.HasPrefix(name, "(*instrumented") {
+			if inner == "" {
+				inner = name
+			}
+			outer = name
+		}
+		if !more {
+			break
+		}
+	}
+
+	switch {
+	case inner == "":
+		return "unknown"
+	case inner == outer:
+		return inner
+	default:
+		return outer + "/" + inner
+	}
+}
+
+// redactArgs describes arguments by type and size only, so logs never carry
+// user data or password hashes.
+func redactArgs(args []driver.NamedValue) string {
+	parts := make([]string, len(args))
+	for i, arg := range args {
+		var description string
+		switch value := arg.Value.(type) {
+		case nil:
+			description = "NULL"
+		case string:
+			description = fmt.Sprintf("string(%d)", len(value))
+		case []byte:
+			description = fmt.Sprintf("bytes(%d)", len(value))
+		default:
+			description = fmt.Sprintf("%T", value)
+		}
+		parts[i] = fmt.Sprintf("$%d=%s", arg.Ordinal, description)
+	}
+	return strings.Join(parts, " ")
+}
+
+func compactSQL(query string) string {
+	return strings.Join(strings.Fields(query), " ")
+}
+
+func explainable(query string) bool {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return false
+	}
+	switch strings.ToUpper(fields[0]) {
+	case "SELECT", "WITH", "INSERT", "UPDATE", "DELETE":
+		return true
+	}
+	return false
+}
+
+// claimExplain limits plans to one per statement name and interval, so a
+// statement that is always slow doesn't double the load.
+func claimExplain(name string) bool {
+	lastExplainsMu.Lock()
+	defer lastExplainsMu.Unlock()
+
+	if time.Since(lastExplains[name]) < explainIntervalPerQuery {
+		return false
+	}
+	lastExplains[name] = time.Now()
+	return true
+}
+
+// explainQuery logs the plan of a slow statement. It runs EXPLAIN without
+// ANALYZE, so the statement itself is never executed again.
+func explainQuery(name, query string, args []driver.NamedValue) {
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+
+	rows, err := db.Query("EXPLAIN "+query, values...)
+	if err != nil {
+		log.Printf("Couldn't explain slow query %s: %s", name, err)
+		return
+	}
+	defer rows.Close()
+
+	var plan []string
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			log.Printf("Couldn't explain slow query %s: %s", name, err)
+			return
+		}
+		plan = append(plan, line)
+	}
+	log.Printf("Plan of slow query %s:\n%s", name, strings.Join(plan, "\n"))
+}
@@ -0,0 +1,213 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/lib/pq"
+	"github.com/say8hi/go-api-test/internal/models"
+)
+
+// productColumns is the column list every products query selects, in the order
+// expected by scanProduct. Queries must alias products as p.
+const productColumns = `p.id, COALESCE(p.external_id, ''), p.name, p.slug, p.description, p.price, p.currency, p.status, p.attributes`
+
+// categoryColumns is the column list of categories queries, in the order
+// expected by scanCategory. Queries must alias categories as c.
+const categoryColumns = `c.id, c.name, c.slug, c.description, c.parent_id`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// querier is implemented by both *sql.DB and *sql.Tx, so loaders can read
+// rows written by a transaction that is not committed yet.
+type querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+func scanProduct(row rowScanner) (models.Product, error) {
+	var (
+		product    models.Product
+		attributes []byte
+	)
+	err := row.Scan(&product.ID, &product.ExternalID, &product.Name, &product.Slug, &product.Description, &product.Price, &product.Currency, &product.Status, &attributes)
+	if err != nil {
+		return product, err
+	}
+	if err := json.Unmarshal(attributes, &product.Attributes); err != nil {
+		return product, err
+	}
+	if len(product.Attributes) == 0 {
+		product.Attributes = nil
+	}
+	return product, nil
+}
+
+func scanCategory(row rowScanner) (models.Category, error) {
+	var category models.Category
+	err := row.Scan(&category.ID, &category.Name, &category.Slug, &category.Description, &category.ParentID)
+	return category, err
+}
+
+// variantColumns is the column list of product_variants queries, in the order
+// expected by scanVariant. Queries must alias product_variants as v.
+const variantColumns = `v.id, v.product_id, v.sku, v.options, v.price, v.available`
+
+func scanVariant(row rowScanner) (models.ProductVariant, error) {
+	var (
+		variant models.ProductVariant
+		options []byte
+	)
+	err := row.Scan(&variant.ID, &variant.ProductID, &variant.SKU, &options, &variant.Price, &variant.Available)
+	if err != nil {
+		return variant, err
+	}
+	err = json.Unmarshal(options, &variant.Options)
+	return variant, err
+}
+
+// queryProducts runs a query selecting productColumns and loads the related
+// rows of the result in batches. The row order of the query is kept.
+func queryProducts(q querier, query string, args ...interface{}) ([]models.Product, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying products: %w", err)
+	}
+	defer rows.Close()
+
+	products := []models.Product{}
+	for rows.Next() {
+		product, err := scanProduct(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning product: %w", err)
+		}
+		products = append(products, product)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating products: %w", err)
+	}
+
+	if err := hydrateProducts(q, products); err != nil {
+		return nil, err
+	}
+
+	return products, nil
+}
+
+// hydrateProducts attaches related rows to products with one query per
+// relation, no matter how many products are passed.
+func hydrateProducts(q querier, products []models.Product) error {
+	if len(products) == 0 {
+		return nil
+	}
+
+	productIDs := make([]int, len(products))
+	for i, product := range products {
+		productIDs[i] = product.ID
+	}
+
+	categories, err := loadProductCategories(q, productIDs)
+	if err != nil {
+		return err
+	}
+	variants, err := loadProductVariants(q, productIDs)
+	if err != nil {
+		return err
+	}
+	stock, err := loadProductStock(q, productIDs)
+	if err != nil {
+		return err
+	}
+	images, err := loadProductImages(q, productIDs)
+	if err != nil {
+		return err
+	}
+	tags, err := loadProductTags(q, productIDs)
+	if err != nil {
+		return err
+	}
+	ratings, err := loadProductRatings(q, productIDs)
+	if err != nil {
+		return err
+	}
+
+	for i := range products {
+		products[i].Categories = categories[products[i].ID]
+		if products[i].Categories == nil {
+			products[i].Categories = []models.Category{}
+		}
+		products[i].Variants = variants[products[i].ID]
+		attachStock(&products[i], stock[products[i].ID])
+		products[i].Images = images[products[i].ID]
+		products[i].Tags = tags[products[i].ID]
+		if rating, ok := ratings[products[i].ID]; ok {
+			products[i].Rating = &rating.average
+			products[i].ReviewCount = rating.count
+		}
+	}
+
+	return nil
+}
+
+// loadProductCategories returns the categories of every given product keyed by
+// product ID. Categories of a product are ordered by ID.
+func loadProductCategories(q querier, productIDs []int) (map[int][]models.Category, error) {
+	query := `
+SELECT pc.product_id, ` + categoryColumns + `
+FROM product_category pc
+JOIN categories c ON c.id = pc.category_id
+WHERE pc.product_id = ANY($1)
+ORDER BY pc.product_id, c.id
+`
+	rows, err := q.Query(query, pq.Array(productIDs))
+	if err != nil {
+		return nil, fmt.Errorf("error fetching categories for products: %w", err)
+	}
+	defer rows.Close()
+
+	categories := make(map[int][]models.Category, len(productIDs))
+	for rows.Next() {
+		var (
+			productID int
+			category  models.Category
+		)
+		if err := rows.Scan(&productID, &category.ID, &category.Name, &category.Slug, &category.Description, &category.ParentID); err != nil {
+			return nil, fmt.Errorf("error scanning category: %w", err)
+		}
+		categories[productID] = append(categories[productID], category)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating categories: %w", err)
+	}
+
+	return categories, nil
+}
+
+// loadProductVariants returns the variants of every given product keyed by
+// product ID. Variants of a product are ordered by ID.
+func loadProductVariants(q querier, productIDs []int) (map[int][]models.ProductVariant, error) {
+	query := `SELECT ` + variantColumns + ` FROM product_variants v WHERE v.product_id = ANY($1) ORDER BY v.product_id, v.id`
+	rows, err := q.Query(query, pq.Array(productIDs))
+	if err != nil {
+		return nil, fmt.Errorf("error fetching variants for products: %w", err)
+	}
+	defer rows.Close()
+
+	variants := make(map[int][]models.ProductVariant, len(productIDs))
+	for rows.Next() {
+		variant, err := scanVariant(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning variant: %w", err)
+		}
+		variants[variant.ProductID] = append(variants[variant.ProductID], variant)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating variants: %w", err)
+	}
+
+	return variants, nil
+}
@@ -0,0 +1,479 @@
+package database
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/say8hi/go-api-test/internal/money"
+)
+
+// migrationLock is the advisory lock key held while a migration is applied,
+// so replicas starting at the same time don't apply it twice.
+const migrationLock = 727002
+
+type migration struct {
+	version    int
+	name       string
+	statements []string
+}
+
+// migrations change the schema created by CreateTables. Append new entries
+// with the next version; never edit one that has been released.
+var migrations = []migration{
+	{
+		version: 1,
+		name:    "integrity constraints",
+		statements: []string{
+			`UPDATE products SET name = 'product-' || id WHERE name IS NULL OR btrim(name) = ''`,
+			`UPDATE products SET description = '' WHERE description IS NULL`,
+			`UPDATE products SET price = 0 WHERE price IS NULL OR price < 0`,
+			`UPDATE products p SET name = p.name || ' (' || p.id || ')'
+             WHERE EXISTS (SELECT 1 FROM products d WHERE lower(d.name) = lower(p.name) AND d.id < p.id)`,
+			`ALTER TABLE products
+                 DROP CONSTRAINT IF EXISTS products_name_key,
+                 ALTER COLUMN name SET NOT NULL,
+                 ALTER COLUMN description SET DEFAULT '',
+                 ALTER COLUMN description SET NOT NULL,
+                 ALTER COLUMN price SET NOT NULL,
+                 ADD CONSTRAINT products_name_not_blank CHECK (btrim(name) <> ''),
+                 ADD CONSTRAINT products_price_non_negative CHECK (price >= 0)`,
+			`CREATE UNIQUE INDEX products_name_lower_key ON products (lower(name))`,
+
+			`UPDATE categories SET name = 'category-' || id WHERE name IS NULL OR btrim(name) = ''`,
+			`UPDATE categories SET description = '' WHERE description IS NULL`,
+			`UPDATE categories c SET name = c.name || ' (' || c.id || ')'
+             WHERE EXISTS (SELECT 1 FROM categories d WHERE lower(d.name) = lower(c.name) AND d.id < c.id)`,
+			`ALTER TABLE categories
+                 DROP CONSTRAINT IF EXISTS categories_name_key,
+                 ALTER COLUMN name SET NOT NULL,
+                 ALTER COLUMN description SET DEFAULT '',
+                 ALTER COLUMN description SET NOT NULL,
+                 ADD CONSTRAINT categories_name_not_blank CHECK (btrim(name) <> '')`,
+			`CREATE UNIQUE INDEX categories_name_lower_key ON categories (lower(name))`,
+
+			`ALTER TABLE product_category
+                 DROP CONSTRAINT IF EXISTS product_category_product_id_fkey,
+                 ADD CONSTRAINT product_category_product_id_fkey
+                     FOREIGN KEY (product_id) REFERENCES products(id) ON DELETE CASCADE`,
+		},
+	},
+	{
+		version: 2,
+		name:    "exact prices with currency",
+		statements: []string{
+			`ALTER TABLE products
+                 ALTER COLUMN price TYPE NUMERIC(19,4),
+                 ADD COLUMN currency TEXT NOT NULL DEFAULT '` + money.DefaultCurrency() + `',
+                 ADD CONSTRAINT products_currency_format CHECK (currency ~ '^[A-Z]{3}$')`,
+			`ALTER TABLE products ALTER COLUMN currency DROP DEFAULT`,
+		},
+	},
+	{
+		version: 3,
+		name:    "price lists and exchange rates",
+		statements: []string{
+			`CREATE TABLE product_prices (
+                 product_id INT NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+                 currency TEXT NOT NULL CHECK (currency ~ '^[A-Z]{3}$'),
+                 amount NUMERIC(19,4) NOT NULL CONSTRAINT product_prices_amount_non_negative CHECK (amount >= 0),
+                 PRIMARY KEY (product_id, currency)
+             )`,
+			`CREATE TABLE exchange_rates (
+                 base_currency TEXT NOT NULL CHECK (base_currency ~ '^[A-Z]{3}$'),
+                 quote_currency TEXT NOT NULL CHECK (quote_currency ~ '^[A-Z]{3}$'),
+                 rate NUMERIC(24,10) NOT NULL CONSTRAINT exchange_rates_rate_positive CHECK (rate > 0),
+                 updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+                 PRIMARY KEY (base_currency, quote_currency),
+                 CONSTRAINT exchange_rates_distinct_currencies CHECK (base_currency <> quote_currency)
+             )`,
+		},
+	},
+	{
+		version: 4,
+		name:    "product external ids",
+		statements: []string{
+			`ALTER TABLE products ADD COLUMN external_id TEXT`,
+			`CREATE UNIQUE INDEX products_external_id_key ON products (external_id) WHERE external_id IS NOT NULL`,
+		},
+	},
+	{
+		version: 5,
+		name:    "field timestamps for ingestion",
+		statements: []string{
+			`ALTER TABLE products
+                 ADD COLUMN description_updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+                 ADD COLUMN price_updated_at TIMESTAMPTZ NOT NULL DEFAULT now()`,
+		},
+	},
+	{
+		version: 6,
+		name:    "category tree",
+		statements: []string{
+			`ALTER TABLE categories
+                 ADD COLUMN parent_id INT CONSTRAINT categories_parent_id_fkey REFERENCES categories(id),
+                 ADD CONSTRAINT categories_parent_not_self CHECK (parent_id <> id)`,
+			`CREATE INDEX categories_parent_id_idx ON categories (parent_id)`,
+		},
+	},
+	{
+		version: 7,
+		name:    "product variants",
+		statements: []string{
+			`CREATE TABLE product_variants (
+                 id SERIAL PRIMARY KEY,
+                 product_id INT NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+                 sku TEXT NOT NULL CONSTRAINT product_variants_sku_not_blank CHECK (btrim(sku) <> ''),
+                 options JSONB NOT NULL DEFAULT '{}',
+                 price NUMERIC(19,4) CONSTRAINT product_variants_price_non_negative CHECK (price >= 0),
+                 available BOOLEAN NOT NULL DEFAULT true,
+                 CONSTRAINT product_variants_sku_key UNIQUE (sku),
+                 CONSTRAINT product_variants_options_key UNIQUE (product_id, options)
+             )`,
+		},
+	},
+	{
+		version: 8,
+		name:    "stock levels and reservations",
+		statements: []string{
+			`CREATE TABLE stock_items (
+                 id SERIAL PRIMARY KEY,
+                 product_id INT NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+                 variant_id INT REFERENCES product_variants(id) ON DELETE CASCADE,
+                 on_hand INT NOT NULL DEFAULT 0 CONSTRAINT stock_items_on_hand_non_negative CHECK (on_hand >= 0),
+                 reserved INT NOT NULL DEFAULT 0 CONSTRAINT stock_items_reserved_within_on_hand CHECK (reserved >= 0 AND reserved <= on_hand),
+                 updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+             )`,
+			`CREATE UNIQUE INDEX stock_items_product_variant_key ON stock_items (product_id, (COALESCE(variant_id, 0)))`,
+			`CREATE TABLE stock_reservations (
+                 id SERIAL PRIMARY KEY,
+                 stock_item_id INT NOT NULL REFERENCES stock_items(id) ON DELETE CASCADE,
+                 quantity INT NOT NULL CONSTRAINT stock_reservations_quantity_positive CHECK (quantity > 0),
+                 status TEXT NOT NULL DEFAULT 'active',
+                 expires_at TIMESTAMPTZ NOT NULL,
+                 created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+             )`,
+			`CREATE INDEX stock_reservations_active_expiry_idx ON stock_reservations (expires_at) WHERE status = 'active'`,
+			`CREATE TABLE stock_movements (
+                 id BIGSERIAL PRIMARY KEY,
+                 stock_item_id INT NOT NULL REFERENCES stock_items(id) ON DELETE CASCADE,
+                 delta INT NOT NULL,
+                 reason TEXT NOT NULL CONSTRAINT stock_movements_reason_not_blank CHECK (btrim(reason) <> ''),
+                 reservation_id INT REFERENCES stock_reservations(id) ON DELETE SET NULL,
+                 created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+             )`,
+			`CREATE INDEX stock_movements_stock_item_id_idx ON stock_movements (stock_item_id)`,
+		},
+	},
+	{
+		version: 9,
+		name:    "product images",
+		statements: []string{
+			`CREATE TABLE product_images (
+                 id SERIAL PRIMARY KEY,
+                 product_id INT NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+                 url TEXT NOT NULL,
+                 thumbnail_url TEXT,
+                 object_key TEXT,
+                 thumbnail_key TEXT,
+                 content_type TEXT,
+                 width INT,
+                 height INT,
+                 size_bytes INT,
+                 position INT NOT NULL,
+                 is_primary BOOLEAN NOT NULL DEFAULT false,
+                 created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+                 CONSTRAINT product_images_url_key UNIQUE (product_id, url)
+             )`,
+			`CREATE UNIQUE INDEX product_images_one_primary ON product_images (product_id) WHERE is_primary`,
+		},
+	},
+	{
+		version: 10,
+		name:    "category attributes",
+		statements: []string{
+			`CREATE TABLE category_attributes (
+                 id SERIAL PRIMARY KEY,
+                 category_id INT NOT NULL REFERENCES categories(id) ON DELETE CASCADE,
+                 name TEXT NOT NULL CONSTRAINT category_attributes_name_format CHECK (name ~ '^[a-z][a-z0-9_]*$'),
+                 type TEXT NOT NULL CONSTRAINT category_attributes_type_check CHECK (type IN ('string', 'number', 'boolean')),
+                 required BOOLEAN NOT NULL DEFAULT false,
+                 allowed_values JSONB,
+                 CONSTRAINT category_attributes_name_key UNIQUE (category_id, name)
+             )`,
+			`ALTER TABLE products ADD COLUMN attributes JSONB NOT NULL DEFAULT '{}'`,
+			`CREATE INDEX products_attributes_idx ON products USING GIN (attributes)`,
+		},
+	},
+	{
+		version: 11,
+		name:    "product tags",
+		statements: []string{
+			`CREATE TABLE tags (
+                 id SERIAL PRIMARY KEY,
+                 name TEXT NOT NULL CONSTRAINT tags_name_format CHECK (name = lower(btrim(name)) AND name <> '' AND length(name) <= 64),
+                 CONSTRAINT tags_name_key UNIQUE (name)
+             )`,
+			`CREATE TABLE product_tags (
+                 product_id INT NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+                 tag_id INT NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+                 PRIMARY KEY (product_id, tag_id)
+             )`,
+			`CREATE INDEX product_tags_tag_id_idx ON product_tags (tag_id)`,
+		},
+	},
+	{
+		version: 12,
+		name:    "product status",
+		statements: []string{
+			`ALTER TABLE products
+                 ADD COLUMN status TEXT NOT NULL DEFAULT 'active' CONSTRAINT products_status_check CHECK (status IN ('draft', 'active', 'archived')),
+                 ADD COLUMN status_updated_at TIMESTAMPTZ NOT NULL DEFAULT now()`,
+			`CREATE INDEX products_status_idx ON products (status)`,
+		},
+	},
+	{
+		version: 13,
+		name:    "slugs",
+		statements: []string{
+			`ALTER TABLE products ADD COLUMN slug TEXT`,
+			`ALTER TABLE categories ADD COLUMN slug TEXT`,
+			// The same slugs as Slugify, with the ID appended to duplicates.
+			`UPDATE products t SET slug = s.slug FROM (
+                 SELECT id, CASE WHEN row_number() OVER (PARTITION BY base ORDER BY id) = 1 THEN base ELSE base || '-' || id END AS slug
+                 FROM (SELECT id, COALESCE(NULLIF(btrim(left(regexp_replace(lower(name), '[^a-z0-9]+', '-', 'g'), 80), '-'), ''), 'product') AS base FROM products) b
+             ) s WHERE s.id = t.id`,
+			`UPDATE categories t SET slug = s.slug FROM (
+                 SELECT id, CASE WHEN row_number() OVER (PARTITION BY base ORDER BY id) = 1 THEN base ELSE base || '-' || id END AS slug
+                 FROM (SELECT id, COALESCE(NULLIF(btrim(left(regexp_replace(lower(name), '[^a-z0-9]+', '-', 'g'), 80), '-'), ''), 'category') AS base FROM categories) b
+             ) s WHERE s.id = t.id`,
+			`ALTER TABLE products ALTER COLUMN slug SET NOT NULL,
+                 ADD CONSTRAINT products_slug_key UNIQUE (slug),
+                 ADD CONSTRAINT products_slug_format CHECK (slug ~ '^[a-z0-9]+(-[a-z0-9]+)*$' AND length(slug) <= 100)`,
+			`CREATE TABLE product_slug_history (
+                 slug TEXT PRIMARY KEY,
+                 product_id INT NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+                 replaced_at TIMESTAMPTZ NOT NULL DEFAULT now()
+             )`,
+			`ALTER TABLE categories ALTER COLUMN slug SET NOT NULL,
+                 ADD CONSTRAINT categories_slug_key UNIQUE (slug),
+                 ADD CONSTRAINT categories_slug_format CHECK (slug ~ '^[a-z0-9]+(-[a-z0-9]+)*$' AND length(slug) <= 100)`,
+			`CREATE TABLE category_slug_history (
+                 slug TEXT PRIMARY KEY,
+                 category_id INT NOT NULL REFERENCES categories(id) ON DELETE CASCADE,
+                 replaced_at TIMESTAMPTZ NOT NULL DEFAULT now()
+             )`,
+		},
+	},
+	{
+		version: 14,
+		name:    "translations",
+		statements: []string{
+			`CREATE TABLE product_translations (
+                 product_id INT NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+                 locale TEXT NOT NULL CONSTRAINT product_translations_locale_format CHECK (locale ~ '^[a-z]{2,3}(-[a-z0-9]{2,8})*$'),
+                 name TEXT NOT NULL CONSTRAINT product_translations_name_not_blank CHECK (btrim(name) <> ''),
+                 description TEXT,
+                 PRIMARY KEY (product_id, locale)
+             )`,
+			`CREATE TABLE category_translations (
+                 category_id INT NOT NULL REFERENCES categories(id) ON DELETE CASCADE,
+                 locale TEXT NOT NULL CONSTRAINT category_translations_locale_format CHECK (locale ~ '^[a-z]{2,3}(-[a-z0-9]{2,8})*$'),
+                 name TEXT NOT NULL CONSTRAINT category_translations_name_not_blank CHECK (btrim(name) <> ''),
+                 description TEXT,
+                 PRIMARY KEY (category_id, locale)
+             )`,
+		},
+	},
+	{
+		version: 15,
+		name:    "reviews",
+		statements: []string{
+			`CREATE TABLE reviews (
+                 id SERIAL PRIMARY KEY,
+                 product_id INT NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+                 user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                 rating SMALLINT NOT NULL CONSTRAINT reviews_rating_range CHECK (rating BETWEEN 1 AND 5),
+                 text TEXT NOT NULL DEFAULT '',
+                 status TEXT NOT NULL DEFAULT 'pending' CONSTRAINT reviews_status_check CHECK (status IN ('pending', 'approved', 'rejected')),
+                 created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+                 updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+                 CONSTRAINT reviews_product_user_key UNIQUE (product_id, user_id)
+             )`,
+			`CREATE INDEX reviews_status_idx ON reviews (status, product_id)`,
+		},
+	},
+	{
+		version: 16,
+		name:    "carts and orders",
+		statements: []string{
+			`CREATE TABLE cart_items (
+                 id SERIAL PRIMARY KEY,
+                 user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                 product_id INT NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+                 variant_id INT REFERENCES product_variants(id) ON DELETE CASCADE,
+                 quantity INT NOT NULL CONSTRAINT cart_items_quantity_positive CHECK (quantity > 0),
+                 unit_price NUMERIC(19,4) NOT NULL,
+                 currency CHAR(3) NOT NULL,
+                 added_at TIMESTAMPTZ NOT NULL DEFAULT now()
+             )`,
+			`CREATE UNIQUE INDEX cart_items_line_key ON cart_items (user_id, product_id, (COALESCE(variant_id, 0)))`,
+			`CREATE TABLE orders (
+                 id SERIAL PRIMARY KEY,
+                 user_id INT NOT NULL REFERENCES users(id),
+                 status TEXT NOT NULL DEFAULT 'placed' CONSTRAINT orders_status_check CHECK (status IN ('placed', 'paid', 'shipped', 'delivered', 'cancelled')),
+                 currency CHAR(3) NOT NULL,
+                 total NUMERIC(19,4) NOT NULL,
+                 created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+                 status_updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+             )`,
+			`CREATE INDEX orders_user_id_idx ON orders (user_id, id)`,
+			// Items keep a copy of the product as it was sold, so they
+			// outlive later changes and the deletion of the product.
+			`CREATE TABLE order_items (
+                 id SERIAL PRIMARY KEY,
+                 order_id INT NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+                 product_id INT REFERENCES products(id) ON DELETE SET NULL,
+                 variant_id INT REFERENCES product_variants(id) ON DELETE SET NULL,
+                 product_name TEXT NOT NULL,
+                 sku TEXT NOT NULL DEFAULT '',
+                 quantity INT NOT NULL CONSTRAINT order_items_quantity_positive CHECK (quantity > 0),
+                 unit_price NUMERIC(19,4) NOT NULL,
+                 stock_item_id INT REFERENCES stock_items(id) ON DELETE SET NULL
+             )`,
+			`CREATE INDEX order_items_order_id_idx ON order_items (order_id)`,
+		},
+	},
+	{
+		version: 17,
+		name:    "promotions",
+		statements: []string{
+			`CREATE TABLE promotions (
+                 id SERIAL PRIMARY KEY,
+                 name TEXT NOT NULL CONSTRAINT promotions_name_not_blank CHECK (btrim(name) <> ''),
+                 kind TEXT NOT NULL CONSTRAINT promotions_kind_check CHECK (kind IN ('percentage', 'fixed')),
+                 value NUMERIC(19,4) NOT NULL,
+                 currency CHAR(3),
+                 scope TEXT NOT NULL CONSTRAINT promotions_scope_check CHECK (scope IN ('catalog', 'category', 'product')),
+                 category_id INT REFERENCES categories(id) ON DELETE CASCADE,
+                 product_id INT REFERENCES products(id) ON DELETE CASCADE,
+                 starts_at TIMESTAMPTZ,
+                 ends_at TIMESTAMPTZ,
+                 stackable BOOLEAN NOT NULL DEFAULT false,
+                 priority INT NOT NULL DEFAULT 0,
+                 created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+                 CONSTRAINT promotions_value_range CHECK (value > 0 AND (kind <> 'percentage' OR value <= 100)),
+                 CONSTRAINT promotions_currency_required CHECK ((kind = 'fixed') = (currency IS NOT NULL)),
+                 CONSTRAINT promotions_scope_target CHECK (
+                     (scope = 'catalog' AND category_id IS NULL AND product_id IS NULL)
+                     OR (scope = 'category' AND category_id IS NOT NULL AND product_id IS NULL)
+                     OR (scope = 'product' AND product_id IS NOT NULL AND category_id IS NULL)),
+                 CONSTRAINT promotions_period CHECK (starts_at IS NULL OR ends_at IS NULL OR ends_at > starts_at)
+             )`,
+		},
+	},
+	{
+		version: 18,
+		name:    "manual ordering",
+		statements: []string{
+			`ALTER TABLE categories ADD COLUMN position INT`,
+			`ALTER TABLE product_category ADD COLUMN position INT`,
+		},
+	},
+	{
+		version: 19,
+		name:    "product relations",
+		statements: []string{
+			`CREATE TABLE product_relations (
+                 product_id INT NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+                 related_id INT NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+                 type TEXT NOT NULL CONSTRAINT product_relations_type_check CHECK (type IN ('accessory', 'similar', 'replacement')),
+                 created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+                 PRIMARY KEY (product_id, related_id),
+                 CONSTRAINT product_relations_not_self CHECK (related_id <> product_id)
+             )`,
+			`CREATE INDEX product_relations_related_id_idx ON product_relations (related_id)`,
+		},
+	},
+	{
+		version: 20,
+		name:    "scheduled changes",
+		statements: []string{
+			`CREATE TABLE scheduled_changes (
+                 id SERIAL PRIMARY KEY,
+                 product_id INT NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+                 changes JSONB NOT NULL,
+                 effective_at TIMESTAMPTZ NOT NULL,
+                 status TEXT NOT NULL DEFAULT 'pending' CONSTRAINT scheduled_changes_status_check CHECK (status IN ('pending', 'applied', 'failed', 'cancelled')),
+                 error TEXT,
+                 created_by INT REFERENCES users(id) ON DELETE SET NULL,
+                 created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+                 status_updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+             )`,
+			`CREATE INDEX scheduled_changes_product_id_idx ON scheduled_changes (product_id, effective_at)`,
+			`CREATE INDEX scheduled_changes_due_idx ON scheduled_changes (effective_at, id) WHERE status = 'pending'`,
+		},
+	},
+	{
+		version: 21,
+		name:    "outbox retention",
+		statements: []string{
+			`CREATE INDEX outbox_published_at_idx ON outbox (published_at) WHERE published_at IS NOT NULL`,
+		},
+	},
+}
+
+// Migrate applies the pending migrations in order, each one in its own
+// transaction.
+func Migrate() {
+	_, err := db.Exec(`
+        CREATE TABLE IF NOT EXISTS schema_migrations (
+            version INT PRIMARY KEY,
+            name TEXT NOT NULL,
+            applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+        );
+    `)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for _, m := range migrations {
+		applied, err := applyMigration(m)
+		if err != nil {
+			log.Fatalf("Migration %d (%s) failed: %s", m.version, m.name, err)
+		}
+		if applied {
+			fmt.Printf("Applied migration %d: %s\n", m.version, m.name)
+		}
+	}
+}
+
+func applyMigration(m migration) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock($1)`, migrationLock); err != nil {
+		return false, err
+	}
+
+	var applied bool
+	err = tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)`, m.version).Scan(&applied)
+	if err != nil || applied {
+		return false, err
+	}
+
+	for _, statement := range m.statements {
+		if _, err := tx.Exec(statement); err != nil {
+			return false, err
+		}
+	}
+
+	_, err = tx.Exec(`INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, m.version, m.name)
+	if err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
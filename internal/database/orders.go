@@ -0,0 +1,501 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+	"github.com/say8hi/go-api-test/internal/models"
+	"github.com/say8hi/go-api-test/internal/money"
+	"github.com/say8hi/go-api-test/internal/pricing"
+)
+
+// orderTransitions lists the statuses an order may move to from each status.
+// Delivered and cancelled orders are final.
+var orderTransitions = map[string][]string{
+	models.OrderPlaced:    {models.OrderPaid, models.OrderCancelled},
+	models.OrderPaid:      {models.OrderShipped, models.OrderCancelled},
+	models.OrderShipped:   {models.OrderDelivered},
+	models.OrderDelivered: nil,
+	models.OrderCancelled: nil,
+}
+
+// ValidOrderStatus reports whether status is an order status.
+func ValidOrderStatus(status string) bool {
+	_, ok := orderTransitions[status]
+	return ok
+}
+
+func canTransitionOrder(from, to string) bool {
+	for _, status := range orderTransitions[from] {
+		if status == to {
+			return true
+		}
+	}
+	return false
+}
+
+// cartItemColumns is the column list of cart queries, in the order expected by
+// scanCartItem. Queries must alias cart_items as ci, join products as p and
+// left join product_variants as v.
+const cartItemColumns = `ci.id, ci.product_id, ci.variant_id, p.name, COALESCE(v.sku, ''), ci.quantity, ci.unit_price, ci.currency, ci.added_at`
+
+func scanCartItem(row rowScanner) (models.CartItem, string, error) {
+	var item models.CartItem
+	var currency string
+	err := row.Scan(&item.ID, &item.ProductID, &item.VariantID, &item.ProductName, &item.SKU, &item.Quantity,
+		&item.UnitPrice, &currency, &item.AddedAt)
+	item.LineTotal = item.UnitPrice * money.Amount(item.Quantity)
+	return item, currency, err
+}
+
+// GetCart returns the cart of a user, which may be empty.
+func GetCart(userID int) (models.Cart, error) {
+	return getCartTx(db, userID, false)
+}
+
+func getCartTx(q querier, userID int, lock bool) (models.Cart, error) {
+	query := `SELECT ` + cartItemColumns + ` FROM cart_items ci
+JOIN products p ON p.id = ci.product_id
+LEFT JOIN product_variants v ON v.id = ci.variant_id
+WHERE ci.user_id = $1 ORDER BY ci.id`
+	if lock {
+		query += ` FOR UPDATE OF ci`
+	}
+	rows, err := q.Query(query, userID)
+	if err != nil {
+		return models.Cart{}, fmt.Errorf("error querying cart: %w", err)
+	}
+	defer rows.Close()
+
+	cart := models.Cart{Items: []models.CartItem{}}
+	for rows.Next() {
+		item, currency, err := scanCartItem(rows)
+		if err != nil {
+			return models.Cart{}, fmt.Errorf("error scanning cart item: %w", err)
+		}
+		cart.Items = append(cart.Items, item)
+		cart.Currency = currency
+		cart.Total += item.LineTotal
+	}
+	if err := rows.Err(); err != nil {
+		return models.Cart{}, fmt.Errorf("error iterating cart: %w", err)
+	}
+
+	return cart, nil
+}
+
+// AddCartItem adds an active product, or one of its available variants, to
+// the cart of a user at its current effective price and returns the cart.
+// Adding an item again adds up the quantities and takes the current price.
+func AddCartItem(userID int, req models.AddCartItemRequest) (models.Cart, error) {
+	if req.Quantity <= 0 {
+		return models.Cart{}, invalidInput("cart_items_quantity_positive", errors.New(constraintMessages["cart_items_quantity_positive"]))
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return models.Cart{}, err
+	}
+	defer tx.Rollback()
+
+	var (
+		price    money.Amount
+		currency string
+	)
+	err = tx.QueryRow(`SELECT price, currency FROM products WHERE id = $1 AND status = 'active'`, req.ProductID).Scan(&price, &currency)
+	if err != nil {
+		return models.Cart{}, err
+	}
+	if req.VariantID != nil {
+		var (
+			variantPrice *money.Amount
+			available    bool
+		)
+		err := tx.QueryRow(`SELECT price, available FROM product_variants WHERE id = $1 AND product_id = $2`,
+			*req.VariantID, req.ProductID).Scan(&variantPrice, &available)
+		if err == sql.ErrNoRows {
+			return models.Cart{}, invalidInput("cart_items_variant_id", ErrVariantNotFound)
+		} else if err != nil {
+			return models.Cart{}, err
+		}
+		if !available {
+			return models.Cart{}, invalidInput("cart_items_variant_available", errors.New(constraintMessages["cart_items_variant_available"]))
+		}
+		if variantPrice != nil {
+			price = *variantPrice
+		}
+	}
+
+	promotions, err := loadProductPromotions(tx, []int{req.ProductID})
+	if err != nil {
+		return models.Cart{}, err
+	}
+	price, _ = pricing.EffectivePrice(price, currency, promotions[req.ProductID])
+
+	var mixed bool
+	err = tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM cart_items WHERE user_id = $1 AND currency <> $2
+        AND NOT (product_id = $3 AND variant_id IS NOT DISTINCT FROM $4))`,
+		userID, currency, req.ProductID, req.VariantID).Scan(&mixed)
+	if err != nil {
+		return models.Cart{}, err
+	}
+	if mixed {
+		return models.Cart{}, invalidInput("cart_items_currency", errors.New(constraintMessages["cart_items_currency"]))
+	}
+
+	_, err = tx.Exec(`INSERT INTO cart_items (user_id, product_id, variant_id, quantity, unit_price, currency)
+VALUES ($1, $2, $3, $4, $5, $6)
+ON CONFLICT (user_id, product_id, (COALESCE(variant_id, 0))) DO UPDATE SET
+    quantity = cart_items.quantity + EXCLUDED.quantity, unit_price = EXCLUDED.unit_price,
+    currency = EXCLUDED.currency, added_at = now()`,
+		userID, req.ProductID, req.VariantID, req.Quantity, price, currency)
+	if err != nil {
+		return models.Cart{}, fmt.Errorf("error adding cart item: %w", constraintError(err))
+	}
+
+	cart, err := getCartTx(tx, userID, false)
+	if err != nil {
+		return models.Cart{}, err
+	}
+	return cart, tx.Commit()
+}
+
+// UpdateCartItem changes the quantity of an item in the cart of a user and
+// returns the cart. The price of the item stays the same.
+func UpdateCartItem(userID, itemID, quantity int) (models.Cart, error) {
+	if quantity <= 0 {
+		return models.Cart{}, invalidInput("cart_items_quantity_positive", errors.New(constraintMessages["cart_items_quantity_positive"]))
+	}
+
+	result, err := db.Exec(`UPDATE cart_items SET quantity = $3 WHERE id = $1 AND user_id = $2`, itemID, userID, quantity)
+	if err != nil {
+		return models.Cart{}, fmt.Errorf("error updating cart item: %w", constraintError(err))
+	}
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		return models.Cart{}, sql.ErrNoRows
+	}
+
+	return GetCart(userID)
+}
+
+// RemoveCartItem removes an item from the cart of a user.
+func RemoveCartItem(userID, itemID int) error {
+	result, err := db.Exec(`DELETE FROM cart_items WHERE id = $1 AND user_id = $2`, itemID, userID)
+	if err != nil {
+		return fmt.Errorf("error removing cart item: %w", err)
+	}
+	if removed, _ := result.RowsAffected(); removed == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// Checkout turns the cart of a user into an order in one transaction. Items
+// keep the prices they were added at. Stock of tracked products is taken off
+// hand; the whole checkout fails when a product is no longer active or
+// there's not enough stock. The cart is emptied.
+func Checkout(userID int) (models.Order, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return models.Order{}, err
+	}
+	defer tx.Rollback()
+
+	cart, err := getCartTx(tx, userID, true)
+	if err != nil {
+		return models.Order{}, err
+	}
+	if len(cart.Items) == 0 {
+		return models.Order{}, invalidInput("cart_empty", errors.New(constraintMessages["cart_empty"]))
+	}
+
+	var orderID int
+	err = tx.QueryRow(`INSERT INTO orders (user_id, currency, total) VALUES ($1, $2, $3) RETURNING id`,
+		userID, cart.Currency, cart.Total).Scan(&orderID)
+	if err != nil {
+		return models.Order{}, fmt.Errorf("error creating order: %w", constraintError(err))
+	}
+
+	for _, item := range cart.Items {
+		var active bool
+		if err := tx.QueryRow(`SELECT status = 'active' FROM products WHERE id = $1`, item.ProductID).Scan(&active); err != nil {
+			return models.Order{}, err
+		}
+		if !active {
+			return models.Order{}, &ConstraintError{
+				Constraint: "order_items_product_active",
+				Conflict:   true,
+				Message:    fmt.Sprintf("%s is no longer available.", item.ProductName),
+			}
+		}
+
+		stockItemID, err := takeOrderStockTx(tx, orderID, item)
+		if err != nil {
+			return models.Order{}, err
+		}
+
+		_, err = tx.Exec(`INSERT INTO order_items (order_id, product_id, variant_id, product_name, sku, quantity, unit_price, stock_item_id)
+            VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+			orderID, item.ProductID, item.VariantID, item.ProductName, item.SKU, item.Quantity, item.UnitPrice, stockItemID)
+		if err != nil {
+			return models.Order{}, fmt.Errorf("error creating order item: %w", constraintError(err))
+		}
+	}
+
+	// Items added since the cart was read stay in the cart.
+	itemIDs := make([]int, len(cart.Items))
+	for i, item := range cart.Items {
+		itemIDs[i] = item.ID
+	}
+	if _, err := tx.Exec(`DELETE FROM cart_items WHERE user_id = $1 AND id = ANY($2)`, userID, pq.Array(itemIDs)); err != nil {
+		return models.Order{}, fmt.Errorf("error emptying cart: %w", err)
+	}
+
+	order, err := getOrder(tx, orderID)
+	if err != nil {
+		return models.Order{}, err
+	}
+	return order, tx.Commit()
+}
+
+// takeOrderStockTx takes the stock of a cart item off hand for an order and
+// returns the stock item it was taken from, or nil when stock isn't tracked.
+func takeOrderStockTx(tx *sql.Tx, orderID int, item models.CartItem) (*int, error) {
+	itemID, err := stockItemTx(tx, item.ProductID, item.VariantID, false)
+	if err == errStockNotTracked {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := expireReservations(tx, &itemID); err != nil {
+		return nil, err
+	}
+
+	result, err := tx.Exec(`UPDATE stock_items SET on_hand = on_hand - $2, updated_at = now()
+        WHERE id = $1 AND on_hand - reserved >= $2`, itemID, item.Quantity)
+	if err != nil {
+		return nil, fmt.Errorf("error taking stock: %w", constraintError(err))
+	}
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		return nil, &ConstraintError{
+			Constraint: "stock_items_available",
+			Conflict:   true,
+			Message:    fmt.Sprintf("Not enough stock available of %s.", item.ProductName),
+		}
+	}
+
+	if err := recordStockMovementTx(tx, itemID, -item.Quantity, fmt.Sprintf("order %d placed", orderID), nil); err != nil {
+		return nil, err
+	}
+	if err := enqueueProductEvent(tx, item.ProductID, models.EventProductUpdated); err != nil {
+		return nil, err
+	}
+	return &itemID, nil
+}
+
+// GetOrders returns the orders of a user, the newest first.
+func GetOrders(userID int) ([]models.Order, error) {
+	return queryOrders(db, `SELECT `+orderColumns+` FROM orders o WHERE o.user_id = $1 ORDER BY o.id DESC`, userID)
+}
+
+// GetOrder returns an order. Unless asked by an admin, only orders of userID
+// are found.
+func GetOrder(orderID, userID int, admin bool) (models.Order, error) {
+	order, err := getOrder(db, orderID)
+	if err != nil {
+		return models.Order{}, err
+	}
+	if order.UserID != userID && !admin {
+		return models.Order{}, sql.ErrNoRows
+	}
+	return order, nil
+}
+
+// orderColumns is the column list of orders queries, in the order expected by
+// queryOrders. Queries must alias orders as o.
+const orderColumns = `o.id, o.user_id, o.status, o.currency, o.total, o.created_at, o.status_updated_at`
+
+func getOrder(q querier, orderID int) (models.Order, error) {
+	orders, err := queryOrders(q, `SELECT `+orderColumns+` FROM orders o WHERE o.id = $1`, orderID)
+	if err != nil {
+		return models.Order{}, err
+	}
+	if len(orders) == 0 {
+		return models.Order{}, sql.ErrNoRows
+	}
+	return orders[0], nil
+}
+
+// queryOrders runs a query selecting orderColumns and attaches the items of
+// the orders.
+func queryOrders(q querier, query string, args ...interface{}) ([]models.Order, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying orders: %w", err)
+	}
+	defer rows.Close()
+
+	orders := []models.Order{}
+	for rows.Next() {
+		var order models.Order
+		if err := rows.Scan(&order.ID, &order.UserID, &order.Status, &order.Currency, &order.Total,
+			&order.CreatedAt, &order.StatusUpdatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning order: %w", err)
+		}
+		orders = append(orders, order)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating orders: %w", err)
+	}
+	if len(orders) == 0 {
+		return orders, nil
+	}
+
+	orderIDs := make([]int, len(orders))
+	for i, order := range orders {
+		orderIDs[i] = order.ID
+	}
+	items, err := loadOrderItems(q, orderIDs)
+	if err != nil {
+		return nil, err
+	}
+	for i := range orders {
+		orders[i].Items = items[orders[i].ID]
+		if orders[i].Items == nil {
+			orders[i].Items = []models.OrderItem{}
+		}
+	}
+
+	return orders, nil
+}
+
+// loadOrderItems returns the items of every given order keyed by order ID.
+func loadOrderItems(q querier, orderIDs []int) (map[int][]models.OrderItem, error) {
+	rows, err := q.Query(`SELECT order_id, product_id, variant_id, product_name, sku, quantity, unit_price
+        FROM order_items WHERE order_id = ANY($1) ORDER BY order_id, id`, pq.Array(orderIDs))
+	if err != nil {
+		return nil, fmt.Errorf("error fetching items for orders: %w", err)
+	}
+	defer rows.Close()
+
+	items := make(map[int][]models.OrderItem, len(orderIDs))
+	for rows.Next() {
+		var (
+			orderID int
+			item    models.OrderItem
+		)
+		if err := rows.Scan(&orderID, &item.ProductID, &item.VariantID, &item.ProductName, &item.SKU,
+			&item.Quantity, &item.UnitPrice); err != nil {
+			return nil, fmt.Errorf("error scanning order item: %w", err)
+		}
+		item.LineTotal = item.UnitPrice * money.Amount(item.Quantity)
+		items[orderID] = append(items[orderID], item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating order items: %w", err)
+	}
+
+	return items, nil
+}
+
+// SetOrderStatus moves an order to status if the transition is allowed.
+// Cancelling an order puts its stock back on hand.
+func SetOrderStatus(orderID int, status string) (models.Order, error) {
+	return setOrderStatus(orderID, status, func(models.Order) bool { return true })
+}
+
+// CancelOrder cancels an order of userID that hasn't shipped yet.
+func CancelOrder(orderID, userID int) (models.Order, error) {
+	return setOrderStatus(orderID, models.OrderCancelled, func(order models.Order) bool { return order.UserID == userID })
+}
+
+// setOrderStatus moves an order for which allowed returns true to status.
+// Other orders are reported as missing.
+func setOrderStatus(orderID int, status string, allowed func(models.Order) bool) (models.Order, error) {
+	if !ValidOrderStatus(status) {
+		return models.Order{}, invalidInput("orders_status_check", errors.New(constraintMessages["orders_status_check"]))
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return models.Order{}, err
+	}
+	defer tx.Rollback()
+
+	var id int
+	if err := tx.QueryRow(`SELECT id FROM orders WHERE id = $1 FOR UPDATE`, orderID).Scan(&id); err != nil {
+		return models.Order{}, err
+	}
+	order, err := getOrder(tx, orderID)
+	if err != nil {
+		return models.Order{}, err
+	}
+	if !allowed(order) {
+		return models.Order{}, sql.ErrNoRows
+	}
+
+	if order.Status != status {
+		if !canTransitionOrder(order.Status, status) {
+			return models.Order{}, &ConstraintError{
+				Constraint: "orders_status_transition",
+				Conflict:   true,
+				Message:    fmt.Sprintf("A %s order can't become %s.", order.Status, status),
+			}
+		}
+
+		if _, err := tx.Exec(`UPDATE orders SET status = $2, status_updated_at = now() WHERE id = $1`, orderID, status); err != nil {
+			return models.Order{}, fmt.Errorf("error updating order status: %w", constraintError(err))
+		}
+		if status == models.OrderCancelled {
+			if err := restockOrderTx(tx, orderID); err != nil {
+				return models.Order{}, err
+			}
+		}
+	}
+
+	order, err = getOrder(tx, orderID)
+	if err != nil {
+		return models.Order{}, err
+	}
+	return order, tx.Commit()
+}
+
+// restockOrderTx puts the stock taken for an order back on hand.
+func restockOrderTx(tx *sql.Tx, orderID int) error {
+	rows, err := tx.Query(`SELECT oi.stock_item_id, oi.quantity, s.product_id FROM order_items oi
+        JOIN stock_items s ON s.id = oi.stock_item_id WHERE oi.order_id = $1`, orderID)
+	if err != nil {
+		return fmt.Errorf("error querying order stock: %w", err)
+	}
+	type taken struct{ itemID, quantity, productID int }
+	var items []taken
+	for rows.Next() {
+		var item taken
+		if err := rows.Scan(&item.itemID, &item.quantity, &item.productID); err != nil {
+			rows.Close()
+			return fmt.Errorf("error scanning order stock: %w", err)
+		}
+		items = append(items, item)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating order stock: %w", err)
+	}
+
+	reason := fmt.Sprintf("order %d cancelled", orderID)
+	for _, item := range items {
+		if _, err := tx.Exec(`UPDATE stock_items SET on_hand = on_hand + $2, updated_at = now() WHERE id = $1`,
+			item.itemID, item.quantity); err != nil {
+			return fmt.Errorf("error returning stock: %w", constraintError(err))
+		}
+		if err := recordStockMovementTx(tx, item.itemID, item.quantity, reason, nil); err != nil {
+			return err
+		}
+		if err := enqueueProductEvent(tx, item.productID, models.EventProductUpdated); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/say8hi/go-api-test/internal/models"
+)
+
+// outboxRelayLock is the advisory lock key that makes sure only one relay
+// publishes at a time, which keeps events of an aggregate in order.
+const outboxRelayLock = 727001
+
+const maxOutboxBackoff = 5 * time.Minute
+
+// enqueueEvent stores a domain event in the outbox as part of tx, so the event
+// is published only if tx commits.
+func enqueueEvent(tx *sql.Tx, aggregateType string, aggregateID int, eventType string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("error encoding %s event: %w", eventType, err)
+	}
+
+	_, err = tx.Exec(`INSERT INTO outbox (aggregate_type, aggregate_id, event_type, payload) VALUES ($1, $2, $3, $4)`,
+		aggregateType, aggregateID, eventType, body)
+	if err != nil {
+		return fmt.Errorf("error writing %s event to outbox: %w", eventType, err)
+	}
+
+	return nil
+}
+
+func enqueueProductEvent(tx *sql.Tx, productID int, eventType string) error {
+	if eventType == models.EventProductDeleted {
+		return enqueueEvent(tx, models.AggregateProduct, productID, eventType, models.DeletedEntity{ID: productID})
+	}
+
+	products, err := queryProducts(tx, `SELECT `+productColumns+` FROM products p WHERE p.id = $1`, productID)
+	if err != nil {
+		return err
+	}
+	if len(products) == 0 {
+		return sql.ErrNoRows
+	}
+
+	return enqueueEvent(tx, models.AggregateProduct, productID, eventType, products[0])
+}
+
+func enqueueCategoryEvent(tx *sql.Tx, categoryID int, eventType string) error {
+	if eventType == models.EventCategoryDeleted {
+		return enqueueEvent(tx, models.AggregateCategory, categoryID, eventType, models.DeletedEntity{ID: categoryID})
+	}
+
+	category, err := scanCategory(tx.QueryRow(`SELECT `+categoryColumns+` FROM categories c WHERE id = $1`, categoryID))
+	if err != nil {
+		return err
+	}
+
+	return enqueueEvent(tx, models.AggregateCategory, categoryID, eventType, category)
+}
+
+// RelayOutbox hands up to batchSize due events to publish in ID order and marks
+// the published ones. It stops at the first failed event, which is retried
+// with exponential backoff; later events of the same aggregate wait for it.
+// Delivery is at least once: if the final commit fails, the events are
+// published again on the next run.
+func RelayOutbox(batchSize int, publish func(models.OutboxEvent) error) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var locked bool
+	if err := tx.QueryRow(`SELECT pg_try_advisory_xact_lock($1)`, outboxRelayLock).Scan(&locked); err != nil {
+		return 0, fmt.Errorf("error acquiring outbox lock: %w", err)
+	}
+	if !locked {
+		return 0, nil
+	}
+
+	query := `
+SELECT o.id, o.aggregate_type, o.aggregate_id, o.event_type, o.payload, o.attempts, o.created_at
+FROM outbox o
+WHERE o.published_at IS NULL
+  AND o.next_attempt_at <= now()
+  AND NOT EXISTS (
+      SELECT 1 FROM outbox e
+      WHERE e.published_at IS NULL
+        AND e.aggregate_type = o.aggregate_type
+        AND e.aggregate_id = o.aggregate_id
+        AND e.id < o.id
+        AND e.next_attempt_at > now()
+  )
+ORDER BY o.id
+LIMIT $1
+`
+	rows, err := tx.Query(query, batchSize)
+	if err != nil {
+		return 0, fmt.Errorf("error fetching outbox events: %w", err)
+	}
+
+	var events []models.OutboxEvent
+	for rows.Next() {
+		var event models.OutboxEvent
+		if err := rows.Scan(&event.ID, &event.AggregateType, &event.AggregateID, &event.EventType,
+			&event.Payload, &event.Attempts, &event.CreatedAt); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("error scanning outbox event: %w", err)
+		}
+		events = append(events, event)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("error iterating outbox events: %w", err)
+	}
+
+	var published []int64
+	var publishErr error
+	for _, event := range events {
+		if publishErr = publish(event); publishErr != nil {
+			backoff := time.Second << event.Attempts
+			if event.Attempts >= 9 || backoff > maxOutboxBackoff {
+				backoff = maxOutboxBackoff
+			}
+			_, err := tx.Exec(`
+UPDATE outbox
+SET attempts = attempts + 1, last_error = $2, next_attempt_at = now() + $3 * interval '1 millisecond'
+WHERE id = $1`, event.ID, publishErr.Error(), backoff.Milliseconds())
+			if err != nil {
+				return 0, fmt.Errorf("error recording outbox failure: %w", err)
+			}
+			break
+		}
+		published = append(published, event.ID)
+	}
+
+	if len(published) > 0 {
+		_, err = tx.Exec(`UPDATE outbox SET published_at = now(), last_error = NULL WHERE id = ANY($1)`, pq.Array(published))
+		if err != nil {
+			return 0, fmt.Errorf("error marking outbox events published: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return len(published), publishErr
+}
+
+// PruneOutbox deletes up to limit events published more than retention ago,
+// the oldest first, and returns how many it deleted. Unpublished events are
+// always kept.
+func PruneOutbox(retention time.Duration, limit int) (int64, error) {
+	result, err := db.Exec(`
+DELETE FROM outbox WHERE id IN (
+    SELECT id FROM outbox
+    WHERE published_at < now() - $1 * interval '1 millisecond'
+    ORDER BY id
+    LIMIT $2
+)`, retention.Milliseconds(), limit)
+	if err != nil {
+		return 0, fmt.Errorf("error pruning outbox: %w", err)
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,151 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/lib/pq"
+	"github.com/say8hi/go-api-test/internal/models"
+)
+
+// categoryOrderQuery selects categoryColumns of all categories depth first:
+// every category is followed by its subcategories, and siblings are ordered by
+// position. Categories without a position, which were never reordered or were
+// added since, follow their positioned siblings by ID.
+const categoryOrderQuery = `
+WITH RECURSIVE ordered AS (
+    SELECT id, ARRAY[COALESCE(position, 2147483647), id] AS sort_key FROM categories WHERE parent_id IS NULL
+    UNION ALL
+    SELECT child.id, ordered.sort_key || ARRAY[COALESCE(child.position, 2147483647), child.id]
+    FROM categories child JOIN ordered ON child.parent_id = ordered.id
+)
+SELECT ` + categoryColumns + ` FROM categories c JOIN ordered ON ordered.id = c.id ORDER BY ordered.sort_key`
+
+// categoryProductOrder orders products by their position in category $1.
+// Products without one, including those of subcategories, follow by ID.
+const categoryProductOrder = `(SELECT pc.position FROM product_category pc WHERE pc.product_id = p.id AND pc.category_id = $1) NULLS LAST, p.id`
+
+// ReorderCategories orders the subcategories of parentID, or the top-level
+// categories when parentID is nil, as listed in categoryIDs and returns them
+// in that order. Every one of them must be listed once.
+func ReorderCategories(parentID *int, categoryIDs []int) ([]models.Category, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Moves change the children of a category, so they must wait.
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock($1)`, categoryTreeLock); err != nil {
+		return nil, err
+	}
+	if parentID != nil {
+		if err := categoryExists(tx, *parentID); err != nil {
+			return nil, err
+		}
+	}
+
+	var current []int64
+	if err := tx.QueryRow(`SELECT COALESCE(array_agg(id ORDER BY id), '{}') FROM categories WHERE parent_id IS NOT DISTINCT FROM $1`,
+		parentID).Scan(pq.Array(&current)); err != nil {
+		return nil, err
+	}
+	if !sameIDs(current, categoryIDs) {
+		return nil, invalidInput("categories_order", errors.New("category_ids must list every subcategory of the parent once"))
+	}
+
+	_, err = tx.Exec(`UPDATE categories c SET position = o.position
+        FROM unnest($1::int[]) WITH ORDINALITY AS o(id, position)
+        WHERE c.id = o.id`, pq.Array(categoryIDs))
+	if err != nil {
+		return nil, fmt.Errorf("error reordering categories: %w", err)
+	}
+
+	categories, err := queryCategories(tx, `SELECT `+categoryColumns+` FROM categories c
+WHERE c.parent_id IS NOT DISTINCT FROM $1 ORDER BY c.position NULLS LAST, c.id`, parentID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying categories: %w", err)
+	}
+
+	return categories, tx.Commit()
+}
+
+// ReorderCategoryProducts orders the products of a category as listed in
+// productIDs. Every product linked to the category must be listed once;
+// products of its subcategories keep their own order.
+func ReorderCategoryProducts(categoryID int, productIDs []int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var id int
+	if err := tx.QueryRow(`SELECT id FROM categories WHERE id = $1 FOR UPDATE`, categoryID).Scan(&id); err != nil {
+		return err
+	}
+
+	var current []int64
+	if err := tx.QueryRow(`SELECT COALESCE(array_agg(product_id ORDER BY product_id), '{}') FROM product_category WHERE category_id = $1`,
+		categoryID).Scan(pq.Array(&current)); err != nil {
+		return err
+	}
+	if !sameIDs(current, productIDs) {
+		return invalidInput("product_category_order", errors.New("product_ids must list every product of the category once"))
+	}
+
+	_, err = tx.Exec(`UPDATE product_category pc SET position = o.position
+        FROM unnest($2::int[]) WITH ORDINALITY AS o(id, position)
+        WHERE pc.category_id = $1 AND pc.product_id = o.id`, categoryID, pq.Array(productIDs))
+	if err != nil {
+		return fmt.Errorf("error reordering products: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// sameIDs reports whether requested holds exactly the IDs of current, which
+// is sorted, in any order.
+func sameIDs(current []int64, requested []int) bool {
+	sorted := append([]int(nil), requested...)
+	sort.Ints(sorted)
+	if len(sorted) != len(current) {
+		return false
+	}
+	for i := range sorted {
+		if int64(sorted[i]) != current[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// loadCategoryPositions returns the positions of every given product in its
+// categories, keyed by product ID and category ID. Links without a position
+// are left out.
+func loadCategoryPositions(q querier, productIDs []int) (map[int]map[int]int, error) {
+	rows, err := q.Query(`SELECT product_id, category_id, position FROM product_category
+WHERE product_id = ANY($1) AND position IS NOT NULL`, pq.Array(productIDs))
+	if err != nil {
+		return nil, fmt.Errorf("error fetching category positions: %w", err)
+	}
+	defer rows.Close()
+
+	positions := make(map[int]map[int]int)
+	for rows.Next() {
+		var productID, categoryID, position int
+		if err := rows.Scan(&productID, &categoryID, &position); err != nil {
+			return nil, fmt.Errorf("error scanning category position: %w", err)
+		}
+		if positions[productID] == nil {
+			positions[productID] = make(map[int]int)
+		}
+		positions[productID][categoryID] = position
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating category positions: %w", err)
+	}
+
+	return positions, nil
+}
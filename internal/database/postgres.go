@@ -6,11 +6,14 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"sort"
 	"strings"
 	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
+	"github.com/say8hi/go-api-test/internal/media"
 	"github.com/say8hi/go-api-test/internal/models"
+	"github.com/say8hi/go-api-test/internal/money"
 )
 
 var db *sql.DB
@@ -28,11 +31,12 @@ func Init() {
 		os.Getenv("DB_NAME"),
 	)
 
-	var err error
-	db, err = sql.Open("postgres", dbURL)
+	connector, err := pq.NewConnector(dbURL)
 	if err != nil {
 		log.Fatal(err)
 	}
+	configureInstrumentation()
+	db = sql.OpenDB(instrumentedConnector{connector})
 
 	for i := 0; i < 10; i++ {
 		err = db.Ping()
@@ -56,7 +60,7 @@ func CloseConnection() {
 }
 
 func CreateTables() {
-	tables := [4]string{
+	tables := [5]string{
 		`
         CREATE TABLE IF NOT EXISTS users (
             id SERIAL PRIMARY KEY,
@@ -88,6 +92,21 @@ func CreateTables() {
             FOREIGN KEY (category_id) REFERENCES categories(id) ON DELETE CASCADE,
             PRIMARY KEY (product_id, category_id)
         );
+    `,
+		`
+        CREATE TABLE IF NOT EXISTS outbox (
+            id BIGSERIAL PRIMARY KEY,
+            aggregate_type TEXT NOT NULL,
+            aggregate_id INT NOT NULL,
+            event_type TEXT NOT NULL,
+            payload JSONB NOT NULL,
+            created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+            attempts INT NOT NULL DEFAULT 0,
+            next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+            last_error TEXT,
+            published_at TIMESTAMPTZ
+        );
+        CREATE INDEX IF NOT EXISTS outbox_unpublished_idx ON outbox (id) WHERE published_at IS NULL;
     `,
 	}
 
@@ -106,7 +125,7 @@ func CreateUser(request_user models.CreateUserRequest) (models.UserInDatabase, e
 		request_user.Username, request_user.FullName, request_user.Password).Scan(&user.ID, &user.Username, &user.FullName, &user.PasswordHash)
 
 	if err != nil {
-		return models.UserInDatabase{}, err
+		return models.UserInDatabase{}, constraintError(err)
 	}
 
 	return user, nil
@@ -140,41 +159,74 @@ func GetUserByPasswordHash(password string) (models.UserInDatabase, error) {
 
 // Table Categories
 func CreateCategory(createCategory models.CreateCategoryRequest) (models.Category, error) {
-	var category models.Category
+	tx, err := db.Begin()
+	if err != nil {
+		return models.Category{}, err
+	}
+	defer tx.Rollback()
 
-	query := `INSERT INTO categories (name, description) VALUES ($1, $2) RETURNING id, name, description`
-	err := db.QueryRow(query, &createCategory.Name, &createCategory.Description).Scan(&category.ID, &category.Name, &category.Description)
+	category, err := createCategoryTx(tx, createCategory)
 	if err != nil {
-		return models.Category{}, fmt.Errorf("error creating category: %v", err)
+		return models.Category{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.Category{}, err
 	}
 
 	return category, nil
 }
 
-func GetCategoryByID(category_id int) (models.Category, error) {
-	var category models.Category
+func createCategoryTx(tx *sql.Tx, createCategory models.CreateCategoryRequest) (models.Category, error) {
+	if createCategory.ParentID != nil {
+		if err := categoryExists(tx, *createCategory.ParentID); err == sql.ErrNoRows {
+			return models.Category{}, invalidInput("categories_parent_id", ErrParentCategoryNotFound)
+		} else if err != nil {
+			return models.Category{}, err
+		}
+	}
 
-	query := `SELECT * FROM categories WHERE id=$1`
-	err := db.QueryRow(query, category_id).Scan(&category.ID, &category.Name, &category.Description)
+	slug, err := categorySlugs.slugTx(tx, createCategory.Slug, createCategory.Name)
 	if err != nil {
 		return models.Category{}, err
 	}
 
+	query := `INSERT INTO categories AS c (name, slug, description, parent_id) VALUES ($1, $2, $3, $4) RETURNING ` + categoryColumns
+	category, err := scanCategory(tx.QueryRow(query, createCategory.Name, slug, createCategory.Description, createCategory.ParentID))
+	if err != nil {
+		return models.Category{}, fmt.Errorf("error creating category: %w", constraintError(err))
+	}
+
+	if err := enqueueEvent(tx, models.AggregateCategory, category.ID, models.EventCategoryCreated, category); err != nil {
+		return models.Category{}, err
+	}
+
 	return category, nil
 }
 
+func GetCategoryByID(category_id int) (models.Category, error) {
+	query := `SELECT ` + categoryColumns + ` FROM categories c WHERE id=$1`
+	category, err := scanCategory(db.QueryRow(query, category_id))
+	if err != nil {
+		return models.Category{}, err
+	}
+
+	return category, nil
+}
+
+// GetAllCategories returns all categories depth first, every category followed
+// by its subcategories in their order.
 func GetAllCategories() ([]models.Category, error) {
 	categories := []models.Category{}
-	query := `SELECT * FROM categories ORDER BY id`
-	rows, err := db.Query(query)
+	rows, err := db.Query(categoryOrderQuery)
 	if err != nil {
 		return nil, fmt.Errorf("error creating category: %v", err)
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		var c models.Category
-		if err := rows.Scan(&c.ID, &c.Name, &c.Description); err != nil {
+		c, err := scanCategory(rows)
+		if err != nil {
 			return nil, fmt.Errorf("error scanning category: %w", err)
 		}
 		categories = append(categories, c)
@@ -188,6 +240,20 @@ func GetAllCategories() ([]models.Category, error) {
 }
 
 func UpdateCategory(categoryID int, updateReq models.CategoryUpdateRequest) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := updateCategoryTx(tx, categoryID, updateReq); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func updateCategoryTx(tx *sql.Tx, categoryID int, updateReq models.CategoryUpdateRequest) error {
 	var setParts []string
 	var args []interface{}
 	var argIndex int = 1
@@ -203,172 +269,229 @@ func UpdateCategory(categoryID int, updateReq models.CategoryUpdateRequest) erro
 		argIndex++
 	}
 
-	if len(setParts) == 0 {
+	if len(setParts) == 0 && updateReq.Slug == nil {
 		return fmt.Errorf("no fields to update")
 	}
 
-	setClause := strings.Join(setParts, ", ")
-	queryString := fmt.Sprintf("UPDATE categories SET %s WHERE id = $%d", setClause, argIndex)
-	args = append(args, categoryID)
+	if len(setParts) > 0 {
+		setClause := strings.Join(setParts, ", ")
+		queryString := fmt.Sprintf("UPDATE categories SET %s WHERE id = $%d", setClause, argIndex)
+		args = append(args, categoryID)
 
-	_, err := db.Exec(queryString, args...)
-	if err != nil {
-		return fmt.Errorf("error updating category: %w", err)
+		result, err := tx.Exec(queryString, args...)
+		if err != nil {
+			return fmt.Errorf("error updating category: %w", constraintError(err))
+		}
+		if updated, _ := result.RowsAffected(); updated == 0 {
+			return sql.ErrNoRows
+		}
 	}
 
-	return nil
+	if updateReq.Slug != nil {
+		if _, err := categorySlugs.changeTx(tx, categoryID, *updateReq.Slug); err != nil {
+			return err
+		}
+	}
+
+	return enqueueCategoryEvent(tx, categoryID, models.EventCategoryUpdated)
 }
 
 func DeleteCategory(categoryID int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	queryString := "DELETE FROM categories WHERE id = $1"
-	_, err := db.Exec(queryString, categoryID)
+	result, err := tx.Exec(queryString, categoryID)
 	if err != nil {
-		return fmt.Errorf("error deleting category: %w", err)
+		return fmt.Errorf("error deleting category: %w", constraintError(err))
 	}
 
-	return nil
+	if deleted, _ := result.RowsAffected(); deleted > 0 {
+		if err := enqueueCategoryEvent(tx, categoryID, models.EventCategoryDeleted); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
 }
 
 // Table Products
 func CreateProduct(productRequest models.CreateProductRequest) (models.Product, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return models.Product{}, err
+	}
+	defer tx.Rollback()
+
+	product, err := createProductTx(tx, productRequest)
+	if err != nil {
+		return models.Product{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.Product{}, err
+	}
+
+	return product, nil
+}
+
+// createProductTx creates a product with its category links and tags inside tx. Every
+// other way of creating products goes through it.
+func createProductTx(tx *sql.Tx, productRequest models.CreateProductRequest) (models.Product, error) {
 	var product models.Product
 
-	tx, err := db.Begin()
+	currency := productRequest.Currency
+	if currency == "" {
+		currency = money.DefaultCurrency()
+	}
+	if err := money.Validate(productRequest.Price, currency); err != nil {
+		return models.Product{}, invalidInput("products_price", err)
+	}
+	status := productRequest.Status
+	if status == "" {
+		status = models.StatusActive
+	}
+	if !ValidStatus(status) {
+		return models.Product{}, invalidInput("products_status_check", errors.New(constraintMessages["products_status_check"]))
+	}
+	slug, err := productSlugs.slugTx(tx, productRequest.Slug, productRequest.Name)
 	if err != nil {
 		return models.Product{}, err
 	}
 
-	productQuery := `INSERT INTO products (name, description, price) VALUES ($1, $2, $3) RETURNING id`
-	err = tx.QueryRow(productQuery, productRequest.Name, productRequest.Description, productRequest.Price).Scan(&product.ID)
+	productQuery := `INSERT INTO products (name, slug, description, price, currency, external_id, status) VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7) RETURNING id`
+	err = tx.QueryRow(productQuery, productRequest.Name, slug, productRequest.Description, productRequest.Price, currency,
+		productRequest.ExternalID, status).Scan(&product.ID)
 	if err != nil {
-		tx.Rollback()
+		if constraintErr, ok := constraintError(err).(*ConstraintError); ok {
+			return models.Product{}, constraintErr
+		}
 		return models.Product{}, ErrCreatingProduct
 	}
 
 	var categories []models.Category
 	for _, categoryName := range productRequest.Categories {
-		var category models.Category
-		categoryQuery := `SELECT id, name, description FROM categories WHERE name = $1`
-		err := tx.QueryRow(categoryQuery, categoryName).Scan(&category.ID, &category.Name, &category.Description)
+		categoryQuery := `SELECT ` + categoryColumns + ` FROM categories c WHERE lower(c.name) = lower($1)`
+		category, err := scanCategory(tx.QueryRow(categoryQuery, categoryName))
 		if err != nil {
-			tx.Rollback()
 			return models.Product{}, ErrCategoryDoesntExists
 		}
 
 		_, err = tx.Exec(`INSERT INTO product_category (product_id, category_id) VALUES ($1, $2)`, product.ID, category.ID)
 		if err != nil {
-			tx.Rollback()
 			return models.Product{}, ErrCreatingProduct
 		}
 		categories = append(categories, category)
 	}
 
-	if err := tx.Commit(); err != nil {
+	attributes := productRequest.Attributes
+	if attributes == nil {
+		attributes = models.Attributes{}
+	}
+	product.Attributes, err = setProductAttributesTx(tx, product.ID, attributes)
+	if err != nil {
+		return models.Product{}, err
+	}
+
+	if len(productRequest.Tags) > 0 {
+		if product.Tags, err = normalizeTags(productRequest.Tags); err != nil {
+			return models.Product{}, err
+		}
+		if _, err := tagProductTx(tx, product.ID, product.Tags); err != nil {
+			return models.Product{}, err
+		}
+		sort.Strings(product.Tags)
+	}
+
+	if err := enqueueProductEvent(tx, product.ID, models.EventProductCreated); err != nil {
 		return models.Product{}, err
 	}
 
 	product.Name = productRequest.Name
+	product.Slug = slug
 	product.Description = productRequest.Description
 	product.Price = productRequest.Price
+	product.Currency = currency
+	product.Status = status
+	product.ExternalID = productRequest.ExternalID
 	product.Categories = categories
 
 	return product, nil
 }
 
-func GetProduct(productId int) (models.Product, error) {
-	var product models.Product
-
-	productQuery := `SELECT id, name, description, price FROM products WHERE id = $1`
-	err := db.QueryRow(productQuery, productId).Scan(&product.ID, &product.Name, &product.Description, &product.Price)
+// GetProduct returns a product if it has one of statuses. With no statuses
+// products of every status are returned.
+func GetProduct(productId int, statuses []string) (models.Product, error) {
+	conditions, args := statusConditions(statuses, 2)
+	query := `SELECT ` + productColumns + ` FROM products p WHERE ` + strings.Join(append([]string{`p.id = $1`}, conditions...), " AND ")
+	products, err := queryProducts(db, query, append([]interface{}{productId}, args...)...)
 	if err != nil {
 		return models.Product{}, err
 	}
-
-	categoriesQuery := `
-SELECT c.id, c.name, c.description
-FROM categories c
-INNER JOIN product_category pc ON c.id = pc.category_id
-WHERE pc.product_id = $1 ORDER BY c.id ASC
-`
-	rows, err := db.Query(categoriesQuery, productId)
-	if err == sql.ErrNoRows {
-		return product, nil
-	} else if err != nil {
-		return product, fmt.Errorf("error fetching categories for product: %v", err)
-	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var category models.Category
-		if err := rows.Scan(&category.ID, &category.Name, &category.Description); err != nil {
-			return models.Product{}, fmt.Errorf("error scanning category: %v", err)
-		}
-		product.Categories = append(product.Categories, category)
-	}
-	if err := rows.Err(); err != nil {
-		return models.Product{}, fmt.Errorf("error iterating categories: %v", err)
+	if len(products) == 0 {
+		return models.Product{}, sql.ErrNoRows
 	}
 
-	return product, nil
+	return products[0], nil
 }
 
-func GetProductsByCategory(categoryID int) ([]models.Product, error) {
+// GetProductsByIDs returns the existing products among productIDs in the order
+// the IDs were given.
+func GetProductsByIDs(productIDs []int) ([]models.Product, error) {
 	query := `
-SELECT p.id, p.name, p.description, p.price, c.id, c.name, c.description
+SELECT ` + productColumns + `
 FROM products p
-JOIN product_category pc ON p.id = pc.product_id
-JOIN categories c ON pc.category_id = c.id
-WHERE pc.category_id = $1
-ORDER BY p.id, c.id
+WHERE p.id = ANY($1::int[])
+ORDER BY array_position($1::int[], p.id)
 `
-	rows, err := db.Query(query, categoryID)
-	if err != nil {
-		return nil, fmt.Errorf("error querying products by category: %v", err)
-	}
-	defer rows.Close()
-
-	productsMap := make(map[int]*models.Product)
-	for rows.Next() {
-		var (
-			prodID, catID             int
-			prodName, prodDescription string
-			prodPrice                 float64
-			catName, catDescription   string
-		)
-		if err := rows.Scan(&prodID, &prodName, &prodDescription, &prodPrice, &catID, &catName, &catDescription); err != nil {
-			return nil, fmt.Errorf("error scanning product and category: %v", err)
-		}
-
-		if _, exists := productsMap[prodID]; !exists {
-			productsMap[prodID] = &models.Product{
-				ID:          prodID,
-				Name:        prodName,
-				Description: prodDescription,
-				Price:       prodPrice,
-				Categories:  []models.Category{},
-			}
-		}
+	return queryProducts(db, query, pq.Array(productIDs))
+}
 
-		productsMap[prodID].Categories = append(productsMap[prodID].Categories, models.Category{
-			ID:          catID,
-			Name:        catName,
-			Description: catDescription,
-		})
+// GetProductsByCategory returns the products of a category that match filter.
+// With filter.IncludeDescendants products of all its subcategories are
+// included.
+func GetProductsByCategory(categoryID int, filter models.ProductFilter) ([]models.Product, error) {
+	categories := `pc.category_id = $1`
+	if filter.IncludeDescendants {
+		categories = `pc.category_id IN (SELECT c.id FROM (` + subtreeQuery + `) c)`
 	}
-
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating products and categories: %v", err)
+	conditions := []string{
+		`EXISTS (SELECT 1 FROM product_category pc WHERE pc.product_id = p.id AND ` + categories + `)`,
 	}
+	args := []interface{}{categoryID}
+	filterConds, filterArgs := productFilterConditions(filter, len(args)+1)
+	conditions = append(conditions, filterConds...)
+	args = append(args, filterArgs...)
 
-	products := make([]models.Product, 0, len(productsMap))
-	for _, product := range productsMap {
-		products = append(products, *product)
+	query := `SELECT ` + productColumns + ` FROM products p WHERE ` + strings.Join(conditions, " AND ") + ` ORDER BY ` + categoryProductOrder
+	products, err := queryProducts(db, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying products by category: %w", err)
 	}
 
 	return products, nil
 }
 
 func UpdateProduct(productID int, updateReq models.ProductUpdateRequest) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := updateProductTx(tx, productID, updateReq); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// updateProductTx applies a partial update inside tx. Categories are replaced
+// only when updateReq.Categories is set; an empty list removes them all.
+func updateProductTx(tx *sql.Tx, productID int, updateReq models.ProductUpdateRequest) error {
 	var setParts []string
 	var args []interface{}
 	var argIndex int = 1
@@ -388,117 +511,177 @@ func UpdateProduct(productID int, updateReq models.ProductUpdateRequest) error {
 		args = append(args, *updateReq.Price)
 		argIndex++
 	}
+	if updateReq.Currency != nil {
+		setParts = append(setParts, fmt.Sprintf("currency = $%d", argIndex))
+		args = append(args, *updateReq.Currency)
+		argIndex++
+	}
+	if updateReq.ExternalID != nil {
+		setParts = append(setParts, fmt.Sprintf("external_id = NULLIF($%d, '')", argIndex))
+		args = append(args, *updateReq.ExternalID)
+		argIndex++
+	}
 
-	if len(setParts) == 0 {
+	if len(setParts) == 0 && updateReq.Categories == nil && updateReq.Attributes == nil && updateReq.Slug == nil {
 		return fmt.Errorf("no fields to update")
 	}
 
-	setClause := strings.Join(setParts, ", ")
-	queryString := fmt.Sprintf("UPDATE products SET %s WHERE id = $%d", setClause, argIndex)
-	args = append(args, productID)
+	// The ingestion policy "newest" compares against these.
+	if updateReq.Description != nil {
+		setParts = append(setParts, "description_updated_at = now()")
+	}
+	if updateReq.Price != nil || updateReq.Currency != nil {
+		setParts = append(setParts, "price_updated_at = now()")
+	}
 
-	tx, err := db.Begin()
+	var price money.Amount
+	var currency string
+	err := tx.QueryRow(`SELECT price, currency FROM products WHERE id = $1 FOR UPDATE`, productID).Scan(&price, &currency)
 	if err != nil {
 		return err
 	}
 
-	_, err = tx.Exec(queryString, args...)
-	if err != nil {
-		tx.Rollback()
-		return fmt.Errorf("error updating product: %w", err)
+	if updateReq.Price != nil || updateReq.Currency != nil {
+		if updateReq.Price != nil {
+			price = *updateReq.Price
+		}
+		if updateReq.Currency != nil {
+			currency = *updateReq.Currency
+		}
+		if err := money.Validate(price, currency); err != nil {
+			return invalidInput("products_price", err)
+		}
 	}
 
-	_, err = tx.Exec(`DELETE FROM product_category WHERE product_id = $1`, productID)
-	if err != nil {
-		tx.Rollback()
-		return ErrRollback
-	}
+	if len(setParts) > 0 {
+		setClause := strings.Join(setParts, ", ")
+		queryString := fmt.Sprintf("UPDATE products SET %s WHERE id = $%d", setClause, argIndex)
+		args = append(args, productID)
 
-	for _, categoryName := range updateReq.Categories {
-		var categoryID int
-		err := tx.QueryRow(`SELECT id FROM categories WHERE name = $1`, categoryName).Scan(&categoryID)
+		_, err = tx.Exec(queryString, args...)
 		if err != nil {
-			tx.Rollback()
-			return ErrCategoryDoesntExists
+			return fmt.Errorf("error updating product: %w", constraintError(err))
+		}
+	}
+
+	if updateReq.Slug != nil {
+		if _, err := productSlugs.changeTx(tx, productID, *updateReq.Slug); err != nil {
+			return err
+		}
+	}
+
+	if updateReq.Categories != nil {
+		// Links the product keeps hold on to their positions.
+		categoryIDs := make([]int, 0, len(updateReq.Categories))
+		for _, categoryName := range updateReq.Categories {
+			var categoryID int
+			err := tx.QueryRow(`SELECT id FROM categories WHERE lower(name) = lower($1)`, categoryName).Scan(&categoryID)
+			if err != nil {
+				return ErrCategoryDoesntExists
+			}
+			categoryIDs = append(categoryIDs, categoryID)
 		}
 
-		_, err = tx.Exec(`INSERT INTO product_category (product_id, category_id) VALUES ($1, $2)`, productID, categoryID)
+		_, err = tx.Exec(`DELETE FROM product_category WHERE product_id = $1 AND category_id <> ALL($2)`, productID, pq.Array(categoryIDs))
 		if err != nil {
-			tx.Rollback()
-			return ErrCreatingProduct
+			return ErrRollback
+		}
+
+		for _, categoryID := range categoryIDs {
+			_, err = tx.Exec(`INSERT INTO product_category (product_id, category_id) VALUES ($1, $2) ON CONFLICT (product_id, category_id) DO NOTHING`,
+				productID, categoryID)
+			if err != nil {
+				return ErrCreatingProduct
+			}
 		}
 	}
 
-	if err := tx.Commit(); err != nil {
-		tx.Rollback()
-		return err
+	if updateReq.Attributes != nil || updateReq.Categories != nil {
+		if _, err := setProductAttributesTx(tx, productID, updateReq.Attributes); err != nil {
+			return err
+		}
 	}
 
-	return nil
+	return enqueueProductEvent(tx, productID, models.EventProductUpdated)
 }
 
 func DeleteProduct(productID int) error {
 	tx, err := db.Begin()
-
-	_, err = tx.Exec(`DELETE FROM product_category WHERE product_id = $1`, productID)
 	if err != nil {
-		tx.Rollback()
-		return ErrRollback
+		return err
 	}
+	defer tx.Rollback()
 
-	_, err = tx.Exec("DELETE FROM products WHERE id = $1", productID)
+	keys, err := productImageKeysTx(tx, productID)
 	if err != nil {
-		return fmt.Errorf("error deleting product: %w", err)
+		return err
+	}
+
+	if err := deleteProductTx(tx, productID); err != nil {
+		return err
 	}
 
 	if err := tx.Commit(); err != nil {
-		tx.Rollback()
 		return err
 	}
+	media.Delete(keys...)
+	return nil
+}
+
+func deleteProductTx(tx *sql.Tx, productID int) error {
+	result, err := tx.Exec("DELETE FROM products WHERE id = $1", productID)
+	if err != nil {
+		return fmt.Errorf("error deleting product: %w", constraintError(err))
+	}
+
+	if deleted, _ := result.RowsAffected(); deleted > 0 {
+		return enqueueProductEvent(tx, productID, models.EventProductDeleted)
+	}
 
 	return nil
 }
 
-func ProcessProducts(products []models.Product) error {
+// ProcessProducts upserts a batch from the datacollector observed at
+// observedAt. Products are matched by name; fields of existing products are
+// overwritten according to the ingestion policies and unchanged products are
+// left alone. Every product runs under its own savepoint, so one that lacks
+// attributes its new categories require is skipped without failing the batch.
+func ProcessProducts(products []models.IngestProduct, observedAt time.Time) (models.IngestReport, error) {
+	var report models.IngestReport
+	policies := loadIngestPolicies()
+
 	tx, err := db.Begin()
 	if err != nil {
-		return fmt.Errorf("error starting transaction: %w", err)
+		return report, fmt.Errorf("error starting transaction: %w", err)
 	}
-
-	defer func() {
-		if err != nil {
-			tx.Rollback()
-		}
-	}()
+	defer tx.Rollback()
 
 	for _, product := range products {
-		_, err = tx.Exec("INSERT INTO products (name, description, price) VALUES ($1, $2, $3) ON CONFLICT (name) DO NOTHING", product.Name, product.Description, product.Price)
-		if err != nil {
-			return fmt.Errorf("error inserting product: %w", err)
+		if _, err := tx.Exec(`SAVEPOINT ingest_product`); err != nil {
+			return models.IngestReport{}, err
 		}
 
-		for _, category := range product.Categories {
-			_, err = tx.Exec("INSERT INTO categories (name, description) VALUES ($1, $2) ON CONFLICT (name) DO NOTHING", category.Name, category.Description)
-			if err != nil {
-				return fmt.Errorf("error inserting category: %w", err)
+		outcome, err := ingestProductTx(tx, product, observedAt, policies)
+		var constraintErr *ConstraintError
+		if errors.As(err, &constraintErr) && constraintErr.Constraint == attributesConstraint {
+			log.Printf("Skipping product %q: %s", product.Name, err)
+			if _, err := tx.Exec(`ROLLBACK TO SAVEPOINT ingest_product`); err != nil {
+				return models.IngestReport{}, err
 			}
+			outcome = models.IngestSkipped
+		} else if err != nil {
+			return models.IngestReport{}, err
+		}
 
-			_, err = tx.Exec(`
-          INSERT INTO product_category (product_id, category_id) 
-          VALUES (
-              (SELECT id FROM products WHERE name = $1), 
-              (SELECT id FROM categories WHERE name = $2)
-          ) ON CONFLICT (product_id, category_id) DO NOTHING`,
-				product.Name, category.Name)
-			if err != nil {
-				return fmt.Errorf("error inserting product_category relationship: %w", err)
-			}
+		if _, err := tx.Exec(`RELEASE SAVEPOINT ingest_product`); err != nil {
+			return models.IngestReport{}, err
 		}
+		report.Add(outcome)
 	}
 
-	if err = tx.Commit(); err != nil {
-		return fmt.Errorf("error committing transaction: %w", err)
+	if err := tx.Commit(); err != nil {
+		return models.IngestReport{}, fmt.Errorf("error committing transaction: %w", err)
 	}
 
-	return nil
+	return report, nil
 }
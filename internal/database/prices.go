@@ -0,0 +1,300 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+	"github.com/say8hi/go-api-test/internal/models"
+	"github.com/say8hi/go-api-test/internal/money"
+)
+
+var ErrNoExchangeRate = errors.New("no exchange rate")
+
+// Table Product Prices
+func GetProductPrices(productID int) ([]models.ProductPrice, error) {
+	if err := productExists(db, productID); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`SELECT currency, amount FROM product_prices WHERE product_id = $1 ORDER BY currency`, productID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying product prices: %w", err)
+	}
+	defer rows.Close()
+
+	prices := []models.ProductPrice{}
+	for rows.Next() {
+		var price models.ProductPrice
+		if err := rows.Scan(&price.Currency, &price.Amount); err != nil {
+			return nil, fmt.Errorf("error scanning product price: %w", err)
+		}
+		prices = append(prices, price)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating product prices: %w", err)
+	}
+
+	return prices, nil
+}
+
+func SetProductPrice(productID int, price models.ProductPrice) error {
+	if err := money.Validate(price.Amount, price.Currency); err != nil {
+		return invalidInput("product_prices_amount", err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := productExists(tx, productID); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+INSERT INTO product_prices (product_id, currency, amount) VALUES ($1, $2, $3)
+ON CONFLICT (product_id, currency) DO UPDATE SET amount = EXCLUDED.amount`,
+		productID, price.Currency, price.Amount)
+	if err != nil {
+		return fmt.Errorf("error setting product price: %w", constraintError(err))
+	}
+
+	if err := enqueueProductEvent(tx, productID, models.EventProductUpdated); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func DeleteProductPrice(productID int, currency string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`DELETE FROM product_prices WHERE product_id = $1 AND currency = $2`, productID, currency)
+	if err != nil {
+		return fmt.Errorf("error deleting product price: %w", err)
+	}
+	if deleted, _ := result.RowsAffected(); deleted == 0 {
+		return sql.ErrNoRows
+	}
+
+	if err := enqueueProductEvent(tx, productID, models.EventProductUpdated); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Table Exchange Rates
+func GetExchangeRates() ([]models.ExchangeRate, error) {
+	rows, err := db.Query(`SELECT base_currency, quote_currency, rate, updated_at FROM exchange_rates ORDER BY base_currency, quote_currency`)
+	if err != nil {
+		return nil, fmt.Errorf("error querying exchange rates: %w", err)
+	}
+	defer rows.Close()
+
+	rates := []models.ExchangeRate{}
+	for rows.Next() {
+		var rate models.ExchangeRate
+		if err := rows.Scan(&rate.Base, &rate.Quote, &rate.Rate, &rate.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning exchange rate: %w", err)
+		}
+		rates = append(rates, rate)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating exchange rates: %w", err)
+	}
+
+	return rates, nil
+}
+
+// SetExchangeRates creates or replaces the given rates in one transaction, so
+// an import either applies completely or not at all.
+func SetExchangeRates(rates []models.ExchangeRate) error {
+	for _, rate := range rates {
+		for _, currency := range []string{rate.Base, rate.Quote} {
+			if !money.ValidCurrency(currency) {
+				return invalidInput("exchange_rates_currency", fmt.Errorf("%w: %q", money.ErrUnknownCurrency, currency))
+			}
+		}
+		if rate.Rate.IsZero() {
+			return invalidInput("exchange_rates_rate_positive", money.ErrInvalidRate)
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, rate := range rates {
+		_, err := tx.Exec(`
+INSERT INTO exchange_rates (base_currency, quote_currency, rate) VALUES ($1, $2, $3)
+ON CONFLICT (base_currency, quote_currency) DO UPDATE SET rate = EXCLUDED.rate, updated_at = now()`,
+			rate.Base, rate.Quote, rate.Rate)
+		if err != nil {
+			return fmt.Errorf("error setting exchange rate %s/%s: %w", rate.Base, rate.Quote, constraintError(err))
+		}
+	}
+
+	return tx.Commit()
+}
+
+func DeleteExchangeRate(base, quote string) error {
+	result, err := db.Exec(`DELETE FROM exchange_rates WHERE base_currency = $1 AND quote_currency = $2`, base, quote)
+	if err != nil {
+		return fmt.Errorf("error deleting exchange rate: %w", err)
+	}
+	if deleted, _ := result.RowsAffected(); deleted == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func loadRateTable(q querier) (money.RateTable, error) {
+	rows, err := q.Query(`SELECT base_currency, quote_currency, rate FROM exchange_rates`)
+	if err != nil {
+		return nil, fmt.Errorf("error querying exchange rates: %w", err)
+	}
+	defer rows.Close()
+
+	table := money.RateTable{}
+	for rows.Next() {
+		var (
+			base, quote string
+			rate        money.Rate
+		)
+		if err := rows.Scan(&base, &quote, &rate); err != nil {
+			return nil, fmt.Errorf("error scanning exchange rate: %w", err)
+		}
+		table.Set(base, quote, rate)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating exchange rates: %w", err)
+	}
+
+	return table, nil
+}
+
+// PriceProductsIn prices every product in currency. A product's explicit price
+// in that currency wins; otherwise its list price is converted and the
+// conversion is recorded on the product. Own prices of variants are scaled by
+// the explicit price over the list price when the product has an explicit
+// price and are converted otherwise. It fails with ErrNoExchangeRate when a
+// product can't be priced.
+func PriceProductsIn(products []models.Product, currency string) error {
+	var productIDs []int
+	for _, product := range products {
+		if product.Currency != currency {
+			productIDs = append(productIDs, product.ID)
+		}
+	}
+	if len(productIDs) == 0 {
+		return nil
+	}
+
+	rows, err := db.Query(`SELECT product_id, amount FROM product_prices WHERE currency = $1 AND product_id = ANY($2)`,
+		currency, pq.Array(productIDs))
+	if err != nil {
+		return fmt.Errorf("error querying product prices: %w", err)
+	}
+	defer rows.Close()
+
+	explicit := make(map[int]money.Amount)
+	for rows.Next() {
+		var (
+			productID int
+			amount    money.Amount
+		)
+		if err := rows.Scan(&productID, &amount); err != nil {
+			return fmt.Errorf("error scanning product price: %w", err)
+		}
+		explicit[productID] = amount
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating product prices: %w", err)
+	}
+
+	var rates money.RateTable
+	lookup := func(from string) (money.Rate, error) {
+		if rates == nil {
+			if rates, err = loadRateTable(db); err != nil {
+				return money.Rate{}, err
+			}
+		}
+		rate, ok := rates.Lookup(from, currency)
+		if !ok {
+			return money.Rate{}, fmt.Errorf("%w from %s to %s", ErrNoExchangeRate, from, currency)
+		}
+		return rate, nil
+	}
+
+	for i := range products {
+		product := &products[i]
+		if product.Currency == currency {
+			continue
+		}
+		from := product.Currency
+		listPrice := product.Price
+
+		explicitPrice, hasExplicit := explicit[product.ID]
+		if hasExplicit {
+			product.Price = explicitPrice
+		} else {
+			rate, err := lookup(from)
+			if err != nil {
+				return err
+			}
+			product.Conversion = &models.PriceConversion{
+				FromCurrency: from,
+				FromPrice:    product.Price,
+				Rate:         rate,
+			}
+			product.Price = product.Price.Convert(rate, currency)
+		}
+		product.Currency = currency
+
+		// Own prices of variants are in the product currency. With an explicit
+		// price a variant keeps its ratio to the list price, so no exchange
+		// rate is needed; a list price of zero has no ratio and is converted.
+		for j := range product.Variants {
+			variant := &product.Variants[j]
+			if variant.Price == nil {
+				continue
+			}
+			if hasExplicit && listPrice > 0 {
+				scaled := variant.Price.Convert(listPrice.Ratio(explicitPrice), currency)
+				variant.Price = &scaled
+				continue
+			}
+			rate, err := lookup(from)
+			if err != nil {
+				return err
+			}
+			converted := variant.Price.Convert(rate, currency)
+			variant.Price = &converted
+		}
+	}
+
+	return nil
+}
+
+func productExists(q querier, productID int) error {
+	var exists bool
+	err := q.QueryRow(`SELECT EXISTS (SELECT 1 FROM products WHERE id = $1)`, productID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return sql.ErrNoRows
+	}
+	return nil
+}
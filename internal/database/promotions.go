@@ -0,0 +1,218 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/say8hi/go-api-test/internal/models"
+	"github.com/say8hi/go-api-test/internal/money"
+	"github.com/say8hi/go-api-test/internal/pricing"
+)
+
+// promotionColumns is the column list of promotions queries, in the order
+// expected by scanPromotion. Queries must alias promotions as pr.
+const promotionColumns = `pr.id, pr.name, pr.kind, pr.value, COALESCE(pr.currency, ''), pr.scope, pr.category_id, pr.product_id,
+pr.starts_at, pr.ends_at, pr.stackable, pr.priority, pr.created_at`
+
+// promotionRunning is the condition of promotions running at the moment.
+const promotionRunning = `(pr.starts_at IS NULL OR pr.starts_at <= now()) AND (pr.ends_at IS NULL OR pr.ends_at > now())`
+
+func scanPromotion(row rowScanner) (models.Promotion, error) {
+	var promotion models.Promotion
+	err := row.Scan(&promotion.ID, &promotion.Name, &promotion.Kind, &promotion.Value, &promotion.Currency,
+		&promotion.Scope, &promotion.CategoryID, &promotion.ProductID, &promotion.StartsAt, &promotion.EndsAt,
+		&promotion.Stackable, &promotion.Priority, &promotion.CreatedAt)
+	return promotion, err
+}
+
+// GetPromotions lists promotions by ID, only the running ones when
+// runningOnly is set.
+func GetPromotions(runningOnly bool) ([]models.Promotion, error) {
+	query := `SELECT ` + promotionColumns + ` FROM promotions pr`
+	if runningOnly {
+		query += ` WHERE ` + promotionRunning
+	}
+	rows, err := db.Query(query + ` ORDER BY pr.id`)
+	if err != nil {
+		return nil, fmt.Errorf("error querying promotions: %w", err)
+	}
+	defer rows.Close()
+
+	promotions := []models.Promotion{}
+	for rows.Next() {
+		promotion, err := scanPromotion(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning promotion: %w", err)
+		}
+		promotions = append(promotions, promotion)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating promotions: %w", err)
+	}
+
+	return promotions, nil
+}
+
+// GetPromotion returns a promotion or sql.ErrNoRows.
+func GetPromotion(promotionID int) (models.Promotion, error) {
+	return scanPromotion(db.QueryRow(`SELECT `+promotionColumns+` FROM promotions pr WHERE pr.id = $1`, promotionID))
+}
+
+// CreatePromotion adds a promotion.
+func CreatePromotion(request models.PromotionRequest) (models.Promotion, error) {
+	request, err := promotionRequest(request)
+	if err != nil {
+		return models.Promotion{}, err
+	}
+
+	var promotionID int
+	err = db.QueryRow(`
+INSERT INTO promotions (name, kind, value, currency, scope, category_id, product_id, starts_at, ends_at, stackable, priority)
+VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6, $7, $8, $9, $10, $11) RETURNING id`,
+		request.Name, request.Kind, request.Value, request.Currency, request.Scope, request.CategoryID, request.ProductID,
+		request.StartsAt, request.EndsAt, request.Stackable, request.Priority).Scan(&promotionID)
+	if err != nil {
+		return models.Promotion{}, fmt.Errorf("error creating promotion: %w", constraintError(err))
+	}
+
+	return GetPromotion(promotionID)
+}
+
+// UpdatePromotion replaces a promotion. It returns sql.ErrNoRows when there is
+// none.
+func UpdatePromotion(promotionID int, request models.PromotionRequest) (models.Promotion, error) {
+	request, err := promotionRequest(request)
+	if err != nil {
+		return models.Promotion{}, err
+	}
+
+	result, err := db.Exec(`
+UPDATE promotions SET name = $2, kind = $3, value = $4, currency = NULLIF($5, ''), scope = $6, category_id = $7,
+    product_id = $8, starts_at = $9, ends_at = $10, stackable = $11, priority = $12
+WHERE id = $1`,
+		promotionID, request.Name, request.Kind, request.Value, request.Currency, request.Scope, request.CategoryID,
+		request.ProductID, request.StartsAt, request.EndsAt, request.Stackable, request.Priority)
+	if err != nil {
+		return models.Promotion{}, fmt.Errorf("error updating promotion: %w", constraintError(err))
+	}
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		return models.Promotion{}, sql.ErrNoRows
+	}
+
+	return GetPromotion(promotionID)
+}
+
+// DeletePromotion removes a promotion. It returns sql.ErrNoRows when there is
+// none.
+func DeletePromotion(promotionID int) error {
+	result, err := db.Exec(`DELETE FROM promotions WHERE id = $1`, promotionID)
+	if err != nil {
+		return fmt.Errorf("error deleting promotion: %w", err)
+	}
+	if deleted, _ := result.RowsAffected(); deleted == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// promotionRequest normalizes a promotion request. Fixed promotions default to
+// the catalog currency and their value must fit its minor unit. The table
+// constraints check the rest.
+func promotionRequest(request models.PromotionRequest) (models.PromotionRequest, error) {
+	request.Name = strings.TrimSpace(request.Name)
+	request.Currency = strings.ToUpper(strings.TrimSpace(request.Currency))
+	if request.Kind == models.PromotionFixed {
+		if request.Currency == "" {
+			request.Currency = money.DefaultCurrency()
+		}
+		if err := money.Validate(request.Value, request.Currency); err != nil {
+			return request, invalidInput("promotions_currency", err)
+		}
+	}
+	return request, nil
+}
+
+// loadProductPromotions returns the running promotions of every given product
+// that has any, keyed by product ID. A category promotion reaches the products
+// of the category and of its subcategories.
+func loadProductPromotions(q querier, productIDs []int) (map[int][]models.Promotion, error) {
+	query := `
+WITH RECURSIVE lineage AS (
+    SELECT pc.product_id, c.id, c.parent_id FROM product_category pc
+    JOIN categories c ON c.id = pc.category_id
+    WHERE pc.product_id = ANY($1)
+    UNION
+    SELECT lineage.product_id, parent.id, parent.parent_id FROM categories parent
+    JOIN lineage ON parent.id = lineage.parent_id
+)
+SELECT p.id, ` + promotionColumns + `
+FROM products p
+JOIN promotions pr ON pr.scope = 'catalog'
+    OR (pr.scope = 'product' AND pr.product_id = p.id)
+    OR (pr.scope = 'category' AND EXISTS (
+        SELECT 1 FROM lineage WHERE lineage.product_id = p.id AND lineage.id = pr.category_id))
+WHERE p.id = ANY($1) AND ` + promotionRunning + `
+ORDER BY p.id, pr.priority DESC, pr.id`
+	rows, err := q.Query(query, pq.Array(productIDs))
+	if err != nil {
+		return nil, fmt.Errorf("error fetching promotions for products: %w", err)
+	}
+	defer rows.Close()
+
+	promotions := make(map[int][]models.Promotion)
+	for rows.Next() {
+		var (
+			productID int
+			promotion models.Promotion
+		)
+		err := rows.Scan(&productID, &promotion.ID, &promotion.Name, &promotion.Kind, &promotion.Value, &promotion.Currency,
+			&promotion.Scope, &promotion.CategoryID, &promotion.ProductID, &promotion.StartsAt, &promotion.EndsAt,
+			&promotion.Stackable, &promotion.Priority, &promotion.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning promotion: %w", err)
+		}
+		promotions[productID] = append(promotions[productID], promotion)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating promotions: %w", err)
+	}
+
+	return promotions, nil
+}
+
+// ApplyPromotions sets the effective prices of products and of the variants
+// having their own price, and lists the promotions applied to the product
+// price. It runs after PriceProductsIn, so fixed promotions apply to prices in
+// their currency only.
+func ApplyPromotions(products []models.Product) error {
+	if len(products) == 0 {
+		return nil
+	}
+
+	productIDs := make([]int, len(products))
+	for i, product := range products {
+		productIDs[i] = product.ID
+	}
+	promotions, err := loadProductPromotions(db, productIDs)
+	if err != nil {
+		return err
+	}
+
+	for i := range products {
+		product := &products[i]
+		effective, applied := pricing.EffectivePrice(product.Price, product.Currency, promotions[product.ID])
+		product.EffectivePrice, product.Promotions = &effective, applied
+
+		for j := range product.Variants {
+			variant := &product.Variants[j]
+			if variant.Price == nil {
+				continue
+			}
+			effective, _ := pricing.EffectivePrice(*variant.Price, product.Currency, promotions[product.ID])
+			variant.EffectivePrice = &effective
+		}
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/say8hi/go-api-test/internal/models"
+)
+
+var ErrRelatedProductNotFound = errors.New("related product doesn't exist")
+
+// recommendationQuery selects the products sharing a category or tag with
+// product $1, and recommendationOrder ranks them: every shared category scores
+// 2 and every shared tag 1, and a price in the same currency adds up to 1 the
+// closer it is to the price of the product. Queries add their conditions in
+// between.
+const recommendationQuery = `
+WITH shared AS (
+    SELECT pc.product_id, 2 AS weight FROM product_category pc
+    JOIN product_category own ON own.category_id = pc.category_id AND own.product_id = $1
+    UNION ALL
+    SELECT pt.product_id, 1 AS weight FROM product_tags pt
+    JOIN product_tags own ON own.tag_id = pt.tag_id AND own.product_id = $1
+)
+SELECT p.id FROM products p
+JOIN (SELECT product_id, SUM(weight) AS overlap FROM shared GROUP BY product_id) s ON s.product_id = p.id
+JOIN products base ON base.id = $1
+WHERE p.id <> $1`
+
+const recommendationOrder = `
+ORDER BY s.overlap + CASE
+    WHEN p.currency = base.currency AND GREATEST(p.price, base.price) > 0
+    THEN 1 - ABS(p.price - base.price) / GREATEST(p.price, base.price)
+    ELSE 0 END DESC, p.id`
+
+// SetProductRelation links a product to a related product, or changes the type
+// of an existing link.
+func SetProductRelation(productID, relatedID int, relationType string) (models.ProductRelation, error) {
+	if err := productExists(db, productID); err != nil {
+		return models.ProductRelation{}, err
+	}
+	if err := productExists(db, relatedID); err == sql.ErrNoRows {
+		return models.ProductRelation{}, invalidInput("product_relations_related_id", ErrRelatedProductNotFound)
+	} else if err != nil {
+		return models.ProductRelation{}, err
+	}
+
+	relation := models.ProductRelation{ProductID: productID, RelatedID: relatedID, Type: relationType}
+	err := db.QueryRow(`
+INSERT INTO product_relations (product_id, related_id, type) VALUES ($1, $2, $3)
+ON CONFLICT (product_id, related_id) DO UPDATE SET type = EXCLUDED.type
+RETURNING created_at`, productID, relatedID, relationType).Scan(&relation.CreatedAt)
+	if err != nil {
+		return models.ProductRelation{}, fmt.Errorf("error saving product relation: %w", constraintError(err))
+	}
+
+	return relation, nil
+}
+
+// DeleteProductRelation removes the link between two products. It returns
+// sql.ErrNoRows when there is none.
+func DeleteProductRelation(productID, relatedID int) error {
+	result, err := db.Exec(`DELETE FROM product_relations WHERE product_id = $1 AND related_id = $2`, productID, relatedID)
+	if err != nil {
+		return fmt.Errorf("error deleting product relation: %w", err)
+	}
+	if deleted, _ := result.RowsAffected(); deleted == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetRelatedProducts returns up to filter.Limit products related to a
+// product: its manual links in the order they were made, then, unless
+// filter.Type asks for one type of link, the best recommendations.
+func GetRelatedProducts(productID int, filter models.RelatedFilter) ([]models.RelatedProduct, error) {
+	conditions := []string{`r.product_id = $1`}
+	args := []interface{}{productID}
+	if filter.Type != "" {
+		args = append(args, filter.Type)
+		conditions = append(conditions, fmt.Sprintf(`r.type = $%d`, len(args)))
+	}
+	statusConds, statusArgs := statusConditions(filter.Statuses, len(args)+1)
+	conditions = append(conditions, statusConds...)
+	args = append(args, statusArgs...)
+	args = append(args, filter.Limit)
+
+	query := `SELECT p.id, r.type FROM product_relations r JOIN products p ON p.id = r.related_id
+WHERE ` + strings.Join(conditions, " AND ") + fmt.Sprintf(` ORDER BY r.created_at, r.related_id LIMIT $%d`, len(args))
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying product relations: %w", err)
+	}
+	defer rows.Close()
+
+	var (
+		productIDs []int
+		relations  = make(map[int]string)
+	)
+	for rows.Next() {
+		var (
+			id           int
+			relationType string
+		)
+		if err := rows.Scan(&id, &relationType); err != nil {
+			return nil, fmt.Errorf("error scanning product relation: %w", err)
+		}
+		productIDs = append(productIDs, id)
+		relations[id] = relationType
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating product relations: %w", err)
+	}
+
+	if filter.Type == "" && len(productIDs) < filter.Limit {
+		recommended, err := recommendProducts(productID, filter.Statuses, filter.Limit-len(productIDs))
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range recommended {
+			productIDs = append(productIDs, id)
+			relations[id] = models.RelationRecommended
+		}
+	}
+
+	products, err := GetProductsByIDs(productIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	related := make([]models.RelatedProduct, len(products))
+	for i, product := range products {
+		related[i] = models.RelatedProduct{Relation: relations[product.ID], Product: product}
+	}
+	return related, nil
+}
+
+// recommendProducts returns the IDs of up to limit products recommended next
+// to a product, leaving out the products it links to.
+func recommendProducts(productID int, statuses []string, limit int) ([]int, error) {
+	conditions := []string{`NOT EXISTS (SELECT 1 FROM product_relations r WHERE r.product_id = $1 AND r.related_id = p.id)`}
+	args := []interface{}{productID}
+	statusConds, statusArgs := statusConditions(statuses, len(args)+1)
+	conditions = append(conditions, statusConds...)
+	args = append(args, statusArgs...)
+	args = append(args, limit)
+
+	query := recommendationQuery + ` AND ` + strings.Join(conditions, " AND ") + recommendationOrder + fmt.Sprintf(` LIMIT $%d`, len(args))
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying recommendations: %w", err)
+	}
+	defer rows.Close()
+
+	var productIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("error scanning recommendation: %w", err)
+		}
+		productIDs = append(productIDs, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating recommendations: %w", err)
+	}
+
+	return productIDs, nil
+}
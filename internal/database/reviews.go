@@ -0,0 +1,251 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/say8hi/go-api-test/internal/models"
+)
+
+// ErrNotReviewAuthor is returned when a user changes a review of someone else.
+var ErrNotReviewAuthor = errors.New("only the author can change a review")
+
+const reviewColumns = `r.id, r.product_id, r.user_id, u.username, r.rating, r.text, r.status, r.created_at, r.updated_at`
+
+// reviewSorts maps the review listing orders to their ORDER BY clauses.
+var reviewSorts = map[string]string{
+	models.ReviewSortNewest:  `r.created_at DESC, r.id DESC`,
+	models.ReviewSortOldest:  `r.created_at, r.id`,
+	models.ReviewSortHighest: `r.rating DESC, r.created_at DESC, r.id DESC`,
+	models.ReviewSortLowest:  `r.rating, r.created_at DESC, r.id DESC`,
+}
+
+// ValidReviewSort reports whether sort is a review listing order.
+func ValidReviewSort(sort string) bool {
+	_, ok := reviewSorts[sort]
+	return ok
+}
+
+// ValidReviewStatus reports whether status is a review status.
+func ValidReviewStatus(status string) bool {
+	switch status {
+	case models.ReviewPending, models.ReviewApproved, models.ReviewRejected:
+		return true
+	}
+	return false
+}
+
+func scanReview(row interface{ Scan(...interface{}) error }) (models.Review, error) {
+	var review models.Review
+	err := row.Scan(&review.ID, &review.ProductID, &review.UserID, &review.Username, &review.Rating,
+		&review.Text, &review.Status, &review.CreatedAt, &review.UpdatedAt)
+	return review, err
+}
+
+func getReview(q querier, reviewID int) (models.Review, error) {
+	return scanReview(q.QueryRow(`SELECT `+reviewColumns+` FROM reviews r JOIN users u ON u.id = r.user_id WHERE r.id = $1`, reviewID))
+}
+
+// GetReviews lists the reviews matching filter, newest first unless
+// filter.Sort says otherwise.
+func GetReviews(filter models.ReviewFilter) ([]models.Review, error) {
+	var conditions []string
+	var args []interface{}
+	if filter.ProductID != 0 {
+		args = append(args, filter.ProductID)
+		conditions = append(conditions, fmt.Sprintf(`r.product_id = $%d`, len(args)))
+	}
+	if len(filter.Statuses) > 0 {
+		args = append(args, pq.Array(filter.Statuses))
+		conditions = append(conditions, fmt.Sprintf(`r.status = ANY($%d)`, len(args)))
+	}
+	order, ok := reviewSorts[filter.Sort]
+	if !ok {
+		order = reviewSorts[models.ReviewSortNewest]
+	}
+
+	query := `SELECT ` + reviewColumns + ` FROM reviews r JOIN users u ON u.id = r.user_id`
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+	rows, err := db.Query(query+` ORDER BY `+order, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying reviews: %w", err)
+	}
+	defer rows.Close()
+
+	reviews := []models.Review{}
+	for rows.Next() {
+		review, err := scanReview(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning review: %w", err)
+		}
+		reviews = append(reviews, review)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating reviews: %w", err)
+	}
+
+	return reviews, nil
+}
+
+// CreateReview adds the review of a user to an active product. The review
+// waits for moderation. A user can review a product only once.
+func CreateReview(productID, userID int, request models.ReviewRequest) (models.Review, error) {
+	if err := ProductVisible(productID, []string{models.StatusActive}); err != nil {
+		return models.Review{}, err
+	}
+
+	var reviewID int
+	err := db.QueryRow(`INSERT INTO reviews (product_id, user_id, rating, text) VALUES ($1, $2, $3, $4) RETURNING id`,
+		productID, userID, request.Rating, strings.TrimSpace(request.Text)).Scan(&reviewID)
+	if err != nil {
+		return models.Review{}, fmt.Errorf("error creating review: %w", constraintError(err))
+	}
+
+	return getReview(db, reviewID)
+}
+
+// UpdateReview replaces the rating and text of a review of userID. The
+// changed review waits for moderation again.
+func UpdateReview(reviewID, userID int, request models.ReviewRequest) (models.Review, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return models.Review{}, err
+	}
+	defer tx.Rollback()
+
+	review, err := lockReviewTx(tx, reviewID)
+	if err != nil {
+		return models.Review{}, err
+	}
+	if review.UserID != userID {
+		return models.Review{}, ErrNotReviewAuthor
+	}
+
+	_, err = tx.Exec(`UPDATE reviews SET rating = $2, text = $3, status = 'pending', updated_at = now() WHERE id = $1`,
+		reviewID, request.Rating, strings.TrimSpace(request.Text))
+	if err != nil {
+		return models.Review{}, fmt.Errorf("error updating review: %w", constraintError(err))
+	}
+	if err := ratingChangedTx(tx, review, models.ReviewPending); err != nil {
+		return models.Review{}, err
+	}
+
+	review, err = getReview(tx, reviewID)
+	if err != nil {
+		return models.Review{}, err
+	}
+	return review, tx.Commit()
+}
+
+// SetReviewStatus moderates a review.
+func SetReviewStatus(reviewID int, status string) (models.Review, error) {
+	if !ValidReviewStatus(status) {
+		return models.Review{}, invalidInput("reviews_status_check", errors.New(constraintMessages["reviews_status_check"]))
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return models.Review{}, err
+	}
+	defer tx.Rollback()
+
+	review, err := lockReviewTx(tx, reviewID)
+	if err != nil {
+		return models.Review{}, err
+	}
+	if review.Status != status {
+		if _, err := tx.Exec(`UPDATE reviews SET status = $2 WHERE id = $1`, reviewID, status); err != nil {
+			return models.Review{}, fmt.Errorf("error updating review status: %w", constraintError(err))
+		}
+		if err := ratingChangedTx(tx, review, status); err != nil {
+			return models.Review{}, err
+		}
+	}
+
+	review, err = getReview(tx, reviewID)
+	if err != nil {
+		return models.Review{}, err
+	}
+	return review, tx.Commit()
+}
+
+// DeleteReview deletes a review. Unless asked by a moderator, only the author
+// of the review may delete it.
+func DeleteReview(reviewID, userID int, moderator bool) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	review, err := lockReviewTx(tx, reviewID)
+	if err != nil {
+		return err
+	}
+	if review.UserID != userID && !moderator {
+		return ErrNotReviewAuthor
+	}
+
+	if _, err := tx.Exec(`DELETE FROM reviews WHERE id = $1`, reviewID); err != nil {
+		return fmt.Errorf("error deleting review: %w", err)
+	}
+	if err := ratingChangedTx(tx, review, ""); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func lockReviewTx(tx *sql.Tx, reviewID int) (models.Review, error) {
+	return scanReview(tx.QueryRow(`SELECT `+reviewColumns+` FROM reviews r JOIN users u ON u.id = r.user_id WHERE r.id = $1 FOR UPDATE OF r`, reviewID))
+}
+
+// ratingChangedTx publishes the product of review when moving the review to
+// status, or deleting it when status is empty, changes the rating of the
+// product. Only approved reviews count.
+func ratingChangedTx(tx *sql.Tx, review models.Review, status string) error {
+	if review.Status != models.ReviewApproved && status != models.ReviewApproved {
+		return nil
+	}
+	return enqueueProductEvent(tx, review.ProductID, models.EventProductUpdated)
+}
+
+type productRating struct {
+	average float64
+	count   int
+}
+
+// loadProductRatings returns the average rating and the number of approved
+// reviews of every given product that has any, keyed by product ID.
+func loadProductRatings(q querier, productIDs []int) (map[int]productRating, error) {
+	query := `
+SELECT product_id, ROUND(AVG(rating), 2)::float8, COUNT(*) FROM reviews
+WHERE product_id = ANY($1) AND status = 'approved' GROUP BY product_id`
+	rows, err := q.Query(query, pq.Array(productIDs))
+	if err != nil {
+		return nil, fmt.Errorf("error fetching ratings for products: %w", err)
+	}
+	defer rows.Close()
+
+	ratings := make(map[int]productRating, len(productIDs))
+	for rows.Next() {
+		var (
+			productID int
+			rating    productRating
+		)
+		if err := rows.Scan(&productID, &rating.average, &rating.count); err != nil {
+			return nil, fmt.Errorf("error scanning rating: %w", err)
+		}
+		ratings[productID] = rating
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating ratings: %w", err)
+	}
+
+	return ratings, nil
+}
@@ -0,0 +1,305 @@
+package database
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/say8hi/go-api-test/internal/models"
+	"github.com/say8hi/go-api-test/internal/money"
+)
+
+// schedulerLock is the advisory lock key that makes sure only one replica
+// applies scheduled changes at a time, which keeps the changes of a product
+// in order.
+const schedulerLock = 727004
+
+const (
+	schedulerInterval  = 10 * time.Second
+	schedulerBatchSize = 100
+)
+
+// scheduledChangeColumns is the column list of scheduled changes queries, in
+// the order expected by scanScheduledChange. Queries must alias
+// scheduled_changes as sc.
+const scheduledChangeColumns = `sc.id, sc.product_id, sc.changes, sc.effective_at, sc.status, COALESCE(sc.error, ''),
+sc.created_by, sc.created_at, sc.status_updated_at`
+
+func scanScheduledChange(row rowScanner) (models.ScheduledChange, error) {
+	var change models.ScheduledChange
+	err := row.Scan(&change.ID, &change.ProductID, &change.Changes, &change.EffectiveAt, &change.Status, &change.Error,
+		&change.CreatedBy, &change.CreatedAt, &change.StatusUpdatedAt)
+	return change, err
+}
+
+// ValidScheduledChangeStatus reports whether status is a status of scheduled
+// changes.
+func ValidScheduledChangeStatus(status string) bool {
+	switch status {
+	case models.ChangePending, models.ChangeApplied, models.ChangeFailed, models.ChangeCancelled:
+		return true
+	}
+	return false
+}
+
+// ScheduleProductChange stores changes that a product takes at
+// request.EffectiveAt, on behalf of userID. Changes are checked against the
+// product as it is now; if it no longer accepts them when they are due, the
+// change fails.
+func ScheduleProductChange(productID, userID int, request models.ScheduledChangeRequest) (models.ScheduledChange, error) {
+	if request.EffectiveAt.IsZero() || !request.EffectiveAt.After(time.Now()) {
+		return models.ScheduledChange{}, invalidInput("scheduled_changes_effective_at",
+			errors.New(constraintMessages["scheduled_changes_effective_at"]))
+	}
+	fields, err := decodeScheduledFields(request.Changes)
+	if err != nil {
+		return models.ScheduledChange{}, invalidInput("scheduled_changes_changes", err)
+	}
+	if fields.Status != nil && !ValidStatus(*fields.Status) {
+		return models.ScheduledChange{}, invalidInput("products_status_check", errors.New(constraintMessages["products_status_check"]))
+	}
+
+	var currency string
+	if err := db.QueryRow(`SELECT currency FROM products WHERE id = $1`, productID).Scan(&currency); err != nil {
+		return models.ScheduledChange{}, err
+	}
+	if fields.Price != nil {
+		if fields.Currency != nil {
+			currency = *fields.Currency
+		}
+		if err := money.Validate(*fields.Price, currency); err != nil {
+			return models.ScheduledChange{}, invalidInput("products_price", err)
+		}
+	}
+
+	var changeID int
+	err = db.QueryRow(`
+INSERT INTO scheduled_changes (product_id, changes, effective_at, created_by) VALUES ($1, $2, $3, $4) RETURNING id`,
+		productID, []byte(request.Changes), request.EffectiveAt, userID).Scan(&changeID)
+	if err != nil {
+		return models.ScheduledChange{}, fmt.Errorf("error scheduling change: %w", constraintError(err))
+	}
+
+	return GetScheduledChange(changeID)
+}
+
+// decodeScheduledFields reads the changes of a scheduled change. Unknown
+// fields are rejected rather than ignored, as a typo would otherwise only
+// show once the change is due.
+func decodeScheduledFields(changes json.RawMessage) (models.ScheduledFields, error) {
+	var fields models.ScheduledFields
+	if len(bytes.TrimSpace(changes)) == 0 {
+		return fields, errors.New("changes are required")
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(changes))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&fields); err != nil {
+		return fields, fmt.Errorf("invalid changes: %w", err)
+	}
+
+	if !updatesProduct(fields.ProductUpdateRequest) && fields.Status == nil {
+		return fields, errors.New("changes must set at least one field")
+	}
+	return fields, nil
+}
+
+// updatesProduct reports whether update sets any field.
+func updatesProduct(update models.ProductUpdateRequest) bool {
+	return update.ExternalID != nil || update.Name != nil || update.Slug != nil || update.Description != nil ||
+		update.Price != nil || update.Currency != nil || update.Categories != nil || update.Attributes != nil
+}
+
+// GetScheduledChange returns a scheduled change or sql.ErrNoRows.
+func GetScheduledChange(changeID int) (models.ScheduledChange, error) {
+	return scanScheduledChange(db.QueryRow(`SELECT `+scheduledChangeColumns+` FROM scheduled_changes sc WHERE sc.id = $1`, changeID))
+}
+
+// GetScheduledChanges lists the scheduled changes matching filter in the
+// order they take effect.
+func GetScheduledChanges(filter models.ScheduledChangeFilter) ([]models.ScheduledChange, error) {
+	var conditions []string
+	var args []interface{}
+	if filter.ProductID != 0 {
+		args = append(args, filter.ProductID)
+		conditions = append(conditions, fmt.Sprintf(`sc.product_id = $%d`, len(args)))
+	}
+	if len(filter.Statuses) > 0 {
+		args = append(args, pq.Array(filter.Statuses))
+		conditions = append(conditions, fmt.Sprintf(`sc.status = ANY($%d)`, len(args)))
+	}
+
+	query := `SELECT ` + scheduledChangeColumns + ` FROM scheduled_changes sc`
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+	rows, err := db.Query(query+` ORDER BY sc.effective_at, sc.id`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying scheduled changes: %w", err)
+	}
+	defer rows.Close()
+
+	changes := []models.ScheduledChange{}
+	for rows.Next() {
+		change, err := scanScheduledChange(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning scheduled change: %w", err)
+		}
+		changes = append(changes, change)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating scheduled changes: %w", err)
+	}
+
+	return changes, nil
+}
+
+// CancelScheduledChange cancels a pending change and returns it. It returns
+// sql.ErrNoRows when there is none.
+func CancelScheduledChange(changeID int) (models.ScheduledChange, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return models.ScheduledChange{}, err
+	}
+	defer tx.Rollback()
+
+	// The scheduler holds this lock while it applies the change.
+	var status string
+	if err := tx.QueryRow(`SELECT status FROM scheduled_changes WHERE id = $1 FOR UPDATE`, changeID).Scan(&status); err != nil {
+		return models.ScheduledChange{}, err
+	}
+	if status != models.ChangePending {
+		return models.ScheduledChange{}, &ConstraintError{
+			Constraint: "scheduled_changes_not_pending",
+			Conflict:   true,
+			Message:    fmt.Sprintf("A change that is %s can't be cancelled.", status),
+		}
+	}
+
+	_, err = tx.Exec(`UPDATE scheduled_changes SET status = 'cancelled', status_updated_at = now() WHERE id = $1`, changeID)
+	if err != nil {
+		return models.ScheduledChange{}, fmt.Errorf("error cancelling scheduled change: %w", err)
+	}
+
+	change, err := scanScheduledChange(tx.QueryRow(`SELECT `+scheduledChangeColumns+` FROM scheduled_changes sc WHERE sc.id = $1`, changeID))
+	if err != nil {
+		return models.ScheduledChange{}, err
+	}
+
+	return change, tx.Commit()
+}
+
+// RunScheduler applies scheduled changes as they fall due until the process
+// exits. Every replica runs it; the advisory lock lets one of them work at a
+// time.
+func RunScheduler() {
+	for {
+		applied, err := ApplyDueChanges(schedulerBatchSize)
+		if err != nil {
+			log.Printf("Scheduler: %s", err)
+		}
+		if applied < schedulerBatchSize {
+			time.Sleep(schedulerInterval)
+		}
+	}
+}
+
+// ApplyDueChanges applies up to batchSize due changes in the order they take
+// effect and returns how many it handled. A change the product rejects is
+// marked failed with the reason and the others still apply. Every change
+// commits together with its record, so none applies twice.
+func ApplyDueChanges(batchSize int) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var locked bool
+	if err := tx.QueryRow(`SELECT pg_try_advisory_xact_lock($1)`, schedulerLock).Scan(&locked); err != nil {
+		return 0, fmt.Errorf("error acquiring scheduler lock: %w", err)
+	}
+	if !locked {
+		return 0, nil
+	}
+
+	rows, err := tx.Query(`
+SELECT `+scheduledChangeColumns+` FROM scheduled_changes sc
+WHERE sc.status = 'pending' AND sc.effective_at <= now()
+ORDER BY sc.effective_at, sc.id
+LIMIT $1
+FOR UPDATE`, batchSize)
+	if err != nil {
+		return 0, fmt.Errorf("error fetching due changes: %w", err)
+	}
+
+	var due []models.ScheduledChange
+	for rows.Next() {
+		change, err := scanScheduledChange(rows)
+		if err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("error scanning scheduled change: %w", err)
+		}
+		due = append(due, change)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("error iterating scheduled changes: %w", err)
+	}
+
+	for _, change := range due {
+		if _, err := tx.Exec(`SAVEPOINT scheduled_change`); err != nil {
+			return 0, err
+		}
+
+		if applyErr := applyScheduledChange(tx, change); applyErr != nil {
+			if _, err := tx.Exec(`ROLLBACK TO SAVEPOINT scheduled_change`); err != nil {
+				return 0, err
+			}
+			_, err = tx.Exec(`UPDATE scheduled_changes SET status = 'failed', error = $2, status_updated_at = now() WHERE id = $1`,
+				change.ID, applyErr.Error())
+			if err != nil {
+				return 0, fmt.Errorf("error recording failed change: %w", err)
+			}
+			continue
+		}
+
+		_, err = tx.Exec(`UPDATE scheduled_changes SET status = 'applied', status_updated_at = now() WHERE id = $1`, change.ID)
+		if err != nil {
+			return 0, fmt.Errorf("error recording applied change: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return len(due), nil
+}
+
+// applyScheduledChange sets the fields of change on its product as part of
+// tx, as an update and a status change would.
+func applyScheduledChange(tx *sql.Tx, change models.ScheduledChange) error {
+	fields, err := decodeScheduledFields(change.Changes)
+	if err != nil {
+		return err
+	}
+
+	if updatesProduct(fields.ProductUpdateRequest) {
+		if err := updateProductTx(tx, change.ProductID, fields.ProductUpdateRequest); err != nil {
+			return err
+		}
+	}
+	if fields.Status != nil {
+		if err := setProductStatusTx(tx, change.ProductID, *fields.Status); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/say8hi/go-api-test/internal/models"
+)
+
+const (
+	maxSlugLength = 100
+	// maxGeneratedSlugLength leaves room for a numeric suffix.
+	maxGeneratedSlugLength = 80
+)
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// ValidSlug reports whether slug can be used as a slug.
+func ValidSlug(slug string) bool {
+	return len(slug) <= maxSlugLength && slugPattern.MatchString(slug)
+}
+
+// Slugify turns a name into a slug: lowercase ASCII letters and digits with
+// runs of everything else replaced by a hyphen. Migration 13 generates the
+// slugs of existing rows the same way.
+func Slugify(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte('-')
+		}
+	}
+
+	slug := b.String()
+	for strings.Contains(slug, "--") {
+		slug = strings.ReplaceAll(slug, "--", "-")
+	}
+	if len(slug) > maxGeneratedSlugLength {
+		slug = slug[:maxGeneratedSlugLength]
+	}
+	return strings.Trim(slug, "-")
+}
+
+// sluggedTable describes a table with slugs and the history of its replaced
+// slugs. Old slugs stay reserved for their row, so they keep redirecting.
+type sluggedTable struct {
+	table    string
+	history  string
+	column   string
+	fallback string
+}
+
+var (
+	productSlugs  = sluggedTable{table: "products", history: "product_slug_history", column: "product_id", fallback: "product"}
+	categorySlugs = sluggedTable{table: "categories", history: "category_slug_history", column: "category_id", fallback: "category"}
+)
+
+// takenTx reports whether slug is the current or an old slug of a row other
+// than id.
+func (t sluggedTable) takenTx(q querier, slug string, id int) (bool, error) {
+	var taken bool
+	err := q.QueryRow(fmt.Sprintf(`SELECT EXISTS (SELECT 1 FROM %s WHERE slug = $1 AND id <> $2)
+    OR EXISTS (SELECT 1 FROM %s WHERE slug = $1 AND %s <> $2)`, t.table, t.history, t.column), slug, id).Scan(&taken)
+	if err != nil {
+		return false, fmt.Errorf("error checking slug: %w", err)
+	}
+	return taken, nil
+}
+
+// slugTx returns the slug for a new row: requested when it is set, which must
+// be valid and free, or otherwise one generated from name, with a numeric
+// suffix when needed to make it unique.
+func (t sluggedTable) slugTx(tx *sql.Tx, requested, name string) (string, error) {
+	if requested != "" {
+		return requested, t.checkTx(tx, requested, 0)
+	}
+
+	base := Slugify(name)
+	if base == "" {
+		base = t.fallback
+	}
+	for n := 1; ; n++ {
+		slug := base
+		if n > 1 {
+			slug = base + "-" + strconv.Itoa(n)
+		}
+		taken, err := t.takenTx(tx, slug, 0)
+		if err != nil {
+			return "", err
+		}
+		if !taken {
+			return slug, nil
+		}
+	}
+}
+
+// checkTx fails when slug is invalid or belongs to a row other than id.
+func (t sluggedTable) checkTx(q querier, slug string, id int) error {
+	if !ValidSlug(slug) {
+		constraint := t.table + "_slug_format"
+		return invalidInput(constraint, errors.New(constraintMessages[constraint]))
+	}
+
+	taken, err := t.takenTx(q, slug, id)
+	if err != nil {
+		return err
+	}
+	if taken {
+		constraint := t.table + "_slug_key"
+		return &ConstraintError{Constraint: constraint, Conflict: true, Message: constraintMessages[constraint]}
+	}
+	return nil
+}
+
+// changeTx gives row id a new slug and keeps its current one in the history.
+// It returns whether the slug changed.
+func (t sluggedTable) changeTx(tx *sql.Tx, id int, slug string) (bool, error) {
+	var current string
+	if err := tx.QueryRow(fmt.Sprintf(`SELECT slug FROM %s WHERE id = $1 FOR UPDATE`, t.table), id).Scan(&current); err != nil {
+		return false, err
+	}
+	if slug == current {
+		return false, nil
+	}
+	if err := t.checkTx(tx, slug, id); err != nil {
+		return false, err
+	}
+
+	// A row can take back one of its old slugs.
+	if _, err := tx.Exec(fmt.Sprintf(`DELETE FROM %s WHERE slug = $1`, t.history), slug); err != nil {
+		return false, fmt.Errorf("error updating slug history: %w", err)
+	}
+	if _, err := tx.Exec(fmt.Sprintf(`INSERT INTO %s (slug, %s) VALUES ($1, $2)`, t.history, t.column), current, id); err != nil {
+		return false, fmt.Errorf("error updating slug history: %w", err)
+	}
+	if _, err := tx.Exec(fmt.Sprintf(`UPDATE %s SET slug = $2 WHERE id = $1`, t.table), id, slug); err != nil {
+		return false, fmt.Errorf("error updating slug: %w", constraintError(err))
+	}
+	return true, nil
+}
+
+// resolve returns the ID of the row with slug. For an old slug it also
+// returns the current slug of the row.
+func (t sluggedTable) resolve(slug string) (int, string, error) {
+	var id int
+	err := db.QueryRow(fmt.Sprintf(`SELECT id FROM %s WHERE slug = $1`, t.table), slug).Scan(&id)
+	if err != sql.ErrNoRows {
+		return id, "", err
+	}
+
+	var current string
+	err = db.QueryRow(fmt.Sprintf(`SELECT t.id, t.slug FROM %s h JOIN %s t ON t.id = h.%s WHERE h.slug = $1`,
+		t.history, t.table, t.column), slug).Scan(&id, &current)
+	return id, current, err
+}
+
+// GetProductBySlug returns the product with slug if it has one of statuses.
+// When slug is an old slug of the product, only its current slug is returned.
+func GetProductBySlug(slug string, statuses []string) (models.Product, string, error) {
+	productID, movedTo, err := productSlugs.resolve(slug)
+	if err != nil {
+		return models.Product{}, "", err
+	}
+	if movedTo != "" {
+		return models.Product{}, movedTo, ProductVisible(productID, statuses)
+	}
+
+	product, err := GetProduct(productID, statuses)
+	return product, "", err
+}
+
+// GetCategoryBySlug returns the category with slug. When slug is an old slug
+// of the category, only its current slug is returned.
+func GetCategoryBySlug(slug string) (models.Category, string, error) {
+	categoryID, movedTo, err := categorySlugs.resolve(slug)
+	if err != nil || movedTo != "" {
+		return models.Category{}, movedTo, err
+	}
+
+	category, err := GetCategoryByID(categoryID)
+	return category, "", err
+}
@@ -0,0 +1,129 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+	"github.com/say8hi/go-api-test/internal/models"
+)
+
+// statusTransitions lists the statuses a product may move to from each
+// status. A product that was active can't become a draft again; it is
+// archived instead.
+var statusTransitions = map[string][]string{
+	models.StatusDraft:    {models.StatusActive, models.StatusArchived},
+	models.StatusActive:   {models.StatusArchived},
+	models.StatusArchived: {models.StatusActive, models.StatusDraft},
+}
+
+// ValidStatus reports whether status is a product status.
+func ValidStatus(status string) bool {
+	_, ok := statusTransitions[status]
+	return ok
+}
+
+func canTransition(from, to string) bool {
+	for _, status := range statusTransitions[from] {
+		if status == to {
+			return true
+		}
+	}
+	return false
+}
+
+// SetProductStatus moves a product to status if the transition is allowed and
+// returns the product. Setting the current status again changes nothing.
+func SetProductStatus(productID int, status string) (models.Product, error) {
+	if !ValidStatus(status) {
+		return models.Product{}, invalidInput("products_status_check", errors.New(constraintMessages["products_status_check"]))
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return models.Product{}, err
+	}
+	defer tx.Rollback()
+
+	if err := setProductStatusTx(tx, productID, status); err != nil {
+		return models.Product{}, err
+	}
+
+	products, err := queryProducts(tx, `SELECT `+productColumns+` FROM products p WHERE p.id = $1`, productID)
+	if err != nil {
+		return models.Product{}, err
+	}
+
+	return products[0], tx.Commit()
+}
+
+// setProductStatusTx moves a product to status as part of tx if the
+// transition is allowed. status must be valid.
+func setProductStatusTx(tx *sql.Tx, productID int, status string) error {
+	var current string
+	if err := tx.QueryRow(`SELECT status FROM products WHERE id = $1 FOR UPDATE`, productID).Scan(&current); err != nil {
+		return err
+	}
+	if current == status {
+		return nil
+	}
+
+	if !canTransition(current, status) {
+		return &ConstraintError{
+			Constraint: "products_status_transition",
+			Conflict:   true,
+			Message:    fmt.Sprintf("A %s product can't become %s.", current, status),
+		}
+	}
+
+	if _, err := tx.Exec(`UPDATE products SET status = $2, status_updated_at = now() WHERE id = $1`, productID, status); err != nil {
+		return fmt.Errorf("error updating status: %w", constraintError(err))
+	}
+	return enqueueProductEvent(tx, productID, models.EventProductUpdated)
+}
+
+// ProductVisible returns sql.ErrNoRows unless the product exists and has one
+// of statuses. With no statuses every existing product is visible.
+func ProductVisible(productID int, statuses []string) error {
+	if len(statuses) == 0 {
+		return productExists(db, productID)
+	}
+
+	var id int
+	return db.QueryRow(`SELECT id FROM products WHERE id = $1 AND status = ANY($2)`, productID, pq.Array(statuses)).Scan(&id)
+}
+
+// statusConditions returns the condition matching products with one of
+// statuses and its argument, numbered $next. Queries must alias products as
+// p.
+func statusConditions(statuses []string, next int) ([]string, []interface{}) {
+	if len(statuses) == 0 {
+		return nil, nil
+	}
+	return []string{fmt.Sprintf("p.status = ANY($%d)", next)}, []interface{}{pq.Array(statuses)}
+}
+
+// productFilterConditions returns the conditions of filter that don't depend
+// on a category and their arguments, numbered from $next on.
+func productFilterConditions(filter models.ProductFilter, next int) ([]string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	if filter.InStockOnly {
+		conditions = append(conditions, inStockCondition)
+	}
+
+	attributeConds, attributeArgs := attributeConditions(filter.Attributes, next+len(args))
+	conditions = append(conditions, attributeConds...)
+	args = append(args, attributeArgs...)
+
+	tagConds, tagArgs := tagConditions(filter.Tags, next+len(args))
+	conditions = append(conditions, tagConds...)
+	args = append(args, tagArgs...)
+
+	statusConds, statusArgs := statusConditions(filter.Statuses, next+len(args))
+	conditions = append(conditions, statusConds...)
+	args = append(args, statusArgs...)
+
+	return conditions, args
+}
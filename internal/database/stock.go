@@ -0,0 +1,421 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/say8hi/go-api-test/internal/models"
+)
+
+const (
+	defaultReservationTTL = 15 * time.Minute
+	maxReservationTTL     = 24 * time.Hour
+
+	reservationExpiryInterval = time.Minute
+)
+
+var ErrVariantNotFound = errors.New("variant doesn't exist")
+
+// inStockCondition matches products without stock tracking and products with
+// stock available for sale. Queries must alias products as p.
+const inStockCondition = `(
+    NOT EXISTS (SELECT 1 FROM stock_items s WHERE s.product_id = p.id)
+    OR (SELECT SUM(s.on_hand - s.reserved) FROM stock_items s WHERE s.product_id = p.id) > 0
+)`
+
+// stockLevelColumns is the column list of stock_items queries, in the order
+// expected by scanStockLevel. Queries must alias stock_items as s.
+const stockLevelColumns = `s.variant_id, s.on_hand, s.reserved`
+
+func scanStockLevel(row rowScanner) (models.StockLevel, error) {
+	var level models.StockLevel
+	err := row.Scan(&level.VariantID, &level.OnHand, &level.Reserved)
+	level.Available = level.OnHand - level.Reserved
+	return level, err
+}
+
+// reservationColumns is the column list of stock_reservations queries, in the
+// order expected by scanReservation. Queries must alias stock_reservations as
+// r and join stock_items as s.
+const reservationColumns = `r.id, s.product_id, s.variant_id, r.quantity, r.status, r.expires_at`
+
+func scanReservation(row rowScanner) (models.StockReservation, error) {
+	var reservation models.StockReservation
+	err := row.Scan(&reservation.ID, &reservation.ProductID, &reservation.VariantID, &reservation.Quantity,
+		&reservation.Status, &reservation.ExpiresAt)
+	return reservation, err
+}
+
+func insufficientStock() *ConstraintError {
+	return &ConstraintError{Constraint: "stock_items_available", Conflict: true, Message: "Not enough stock available."}
+}
+
+// Table Stock Items
+func GetProductStock(productID int) ([]models.StockLevel, error) {
+	if err := productExists(db, productID); err != nil {
+		return nil, err
+	}
+
+	stock, err := loadProductStock(db, []int{productID})
+	if err != nil {
+		return nil, err
+	}
+	if stock[productID] == nil {
+		return []models.StockLevel{}, nil
+	}
+	return stock[productID], nil
+}
+
+// AdjustStock changes the stock on hand of a product or a variant and records
+// the change with its reason. Stock is tracked from the first adjustment on.
+// The stock on hand never drops below the reserved quantity.
+func AdjustStock(productID int, req models.StockAdjustmentRequest) (models.StockLevel, error) {
+	reason := strings.TrimSpace(req.Reason)
+	if reason == "" {
+		return models.StockLevel{}, invalidInput("stock_movements_reason", errors.New("a reason is required for stock adjustments"))
+	}
+	if req.Delta == 0 {
+		return models.StockLevel{}, invalidInput("stock_movements_delta", errors.New("delta must not be zero"))
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return models.StockLevel{}, err
+	}
+	defer tx.Rollback()
+
+	itemID, err := stockItemTx(tx, productID, req.VariantID, true)
+	if err != nil {
+		return models.StockLevel{}, err
+	}
+	if err := expireReservations(tx, &itemID); err != nil {
+		return models.StockLevel{}, err
+	}
+
+	query := `UPDATE stock_items AS s SET on_hand = on_hand + $2, updated_at = now()
+WHERE s.id = $1 AND s.on_hand + $2 >= s.reserved RETURNING ` + stockLevelColumns
+	level, err := scanStockLevel(tx.QueryRow(query, itemID, req.Delta))
+	if err == sql.ErrNoRows {
+		return models.StockLevel{}, insufficientStock()
+	} else if err != nil {
+		return models.StockLevel{}, fmt.Errorf("error adjusting stock: %w", constraintError(err))
+	}
+
+	if err := recordStockMovementTx(tx, itemID, req.Delta, reason, nil); err != nil {
+		return models.StockLevel{}, err
+	}
+	if err := enqueueProductEvent(tx, productID, models.EventProductUpdated); err != nil {
+		return models.StockLevel{}, err
+	}
+
+	return level, tx.Commit()
+}
+
+// ReserveStock holds stock of a product or a variant until the reservation is
+// committed, released or expires. Products without stock tracking can't be
+// reserved.
+func ReserveStock(productID int, req models.ReserveStockRequest) (models.StockReservation, error) {
+	if req.Quantity <= 0 {
+		return models.StockReservation{}, invalidInput("stock_reservations_quantity_positive", errors.New("quantity must be positive"))
+	}
+	ttl := defaultReservationTTL
+	if req.TTLSeconds != 0 {
+		ttl = time.Duration(req.TTLSeconds) * time.Second
+	}
+	if ttl <= 0 || ttl > maxReservationTTL {
+		return models.StockReservation{}, invalidInput("stock_reservations_ttl",
+			fmt.Errorf("ttl_seconds must be between 1 and %d", int(maxReservationTTL.Seconds())))
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return models.StockReservation{}, err
+	}
+	defer tx.Rollback()
+
+	itemID, err := stockItemTx(tx, productID, req.VariantID, false)
+	if err == errStockNotTracked {
+		return models.StockReservation{}, insufficientStock()
+	} else if err != nil {
+		return models.StockReservation{}, err
+	}
+	if err := expireReservations(tx, &itemID); err != nil {
+		return models.StockReservation{}, err
+	}
+
+	result, err := tx.Exec(`UPDATE stock_items SET reserved = reserved + $2, updated_at = now()
+        WHERE id = $1 AND on_hand - reserved >= $2`, itemID, req.Quantity)
+	if err != nil {
+		return models.StockReservation{}, fmt.Errorf("error reserving stock: %w", constraintError(err))
+	}
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		return models.StockReservation{}, insufficientStock()
+	}
+
+	query := `WITH r AS (
+    INSERT INTO stock_reservations (stock_item_id, quantity, expires_at)
+    VALUES ($1, $2, now() + $3::int * interval '1 second') RETURNING *
+)
+SELECT ` + reservationColumns + ` FROM r JOIN stock_items s ON s.id = r.stock_item_id`
+	reservation, err := scanReservation(tx.QueryRow(query, itemID, req.Quantity, int(ttl.Seconds())))
+	if err != nil {
+		return models.StockReservation{}, fmt.Errorf("error reserving stock: %w", constraintError(err))
+	}
+
+	return reservation, tx.Commit()
+}
+
+func GetReservation(reservationID int) (models.StockReservation, error) {
+	query := `SELECT ` + reservationColumns + ` FROM stock_reservations r JOIN stock_items s ON s.id = r.stock_item_id WHERE r.id = $1`
+	return scanReservation(db.QueryRow(query, reservationID))
+}
+
+// CommitReservation takes the reserved stock off hand, e.g. once an order is
+// paid.
+func CommitReservation(reservationID int) (models.StockReservation, error) {
+	return finishReservation(reservationID, models.ReservationCommitted)
+}
+
+// ReleaseReservation returns the reserved stock before the reservation
+// expires.
+func ReleaseReservation(reservationID int) (models.StockReservation, error) {
+	return finishReservation(reservationID, models.ReservationReleased)
+}
+
+func finishReservation(reservationID int, status string) (models.StockReservation, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return models.StockReservation{}, err
+	}
+	defer tx.Rollback()
+
+	query := `SELECT ` + reservationColumns + ` FROM stock_reservations r
+JOIN stock_items s ON s.id = r.stock_item_id WHERE r.id = $1 FOR UPDATE OF r`
+	reservation, err := scanReservation(tx.QueryRow(query, reservationID))
+	if err != nil {
+		return models.StockReservation{}, err
+	}
+	var itemID int
+	if err := tx.QueryRow(`SELECT stock_item_id FROM stock_reservations WHERE id = $1`, reservationID).Scan(&itemID); err != nil {
+		return models.StockReservation{}, err
+	}
+
+	if reservation.Status == models.ReservationActive && !reservation.ExpiresAt.After(time.Now()) {
+		reservation.Status = models.ReservationExpired
+	}
+	if reservation.Status != models.ReservationActive {
+		return models.StockReservation{}, &ConstraintError{
+			Constraint: "stock_reservations_status",
+			Conflict:   true,
+			Message:    fmt.Sprintf("The reservation is %s.", reservation.Status),
+		}
+	}
+
+	onHand := 0
+	if status == models.ReservationCommitted {
+		onHand = reservation.Quantity
+	}
+	_, err = tx.Exec(`UPDATE stock_items SET on_hand = on_hand - $2, reserved = reserved - $3, updated_at = now() WHERE id = $1`,
+		itemID, onHand, reservation.Quantity)
+	if err != nil {
+		return models.StockReservation{}, fmt.Errorf("error updating stock: %w", constraintError(err))
+	}
+	if _, err := tx.Exec(`UPDATE stock_reservations SET status = $2 WHERE id = $1`, reservationID, status); err != nil {
+		return models.StockReservation{}, err
+	}
+	reservation.Status = status
+
+	if status == models.ReservationCommitted {
+		reason := fmt.Sprintf("reservation %d committed", reservationID)
+		if err := recordStockMovementTx(tx, itemID, -reservation.Quantity, reason, &reservationID); err != nil {
+			return models.StockReservation{}, err
+		}
+		if err := enqueueProductEvent(tx, reservation.ProductID, models.EventProductUpdated); err != nil {
+			return models.StockReservation{}, err
+		}
+	}
+
+	return reservation, tx.Commit()
+}
+
+// GetLowStock returns the stock levels with at most threshold available, the
+// lowest first.
+func GetLowStock(threshold int) ([]models.LowStockItem, error) {
+	query := `
+SELECT s.product_id, p.name, COALESCE(v.sku, ''), ` + stockLevelColumns + `
+FROM stock_items s
+JOIN products p ON p.id = s.product_id
+LEFT JOIN product_variants v ON v.id = s.variant_id
+WHERE s.on_hand - s.reserved <= $1
+ORDER BY s.on_hand - s.reserved, s.product_id, s.variant_id NULLS FIRST
+`
+	rows, err := db.Query(query, threshold)
+	if err != nil {
+		return nil, fmt.Errorf("error querying low stock: %w", err)
+	}
+	defer rows.Close()
+
+	items := []models.LowStockItem{}
+	for rows.Next() {
+		var item models.LowStockItem
+		if err := rows.Scan(&item.ProductID, &item.ProductName, &item.SKU,
+			&item.VariantID, &item.OnHand, &item.Reserved); err != nil {
+			return nil, fmt.Errorf("error scanning stock level: %w", err)
+		}
+		item.Available = item.OnHand - item.Reserved
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating stock levels: %w", err)
+	}
+
+	return items, nil
+}
+
+// RunReservationExpiry returns the stock of expired reservations until the
+// process exits. Stock operations also expire the reservations of the stock
+// they touch, so this only matters for stock that is otherwise idle.
+func RunReservationExpiry() {
+	for {
+		if err := expireReservations(db, nil); err != nil {
+			log.Printf("Reservation expiry: %s", err)
+		}
+		time.Sleep(reservationExpiryInterval)
+	}
+}
+
+// expireReservations marks the active reservations past their expiry as
+// expired and returns their stock, for one stock item or for all of them when
+// itemID is nil.
+func expireReservations(q querier, itemID *int) error {
+	_, err := q.Exec(`
+WITH expired AS (
+    UPDATE stock_reservations SET status = 'expired'
+    WHERE status = 'active' AND expires_at <= now() AND ($1::int IS NULL OR stock_item_id = $1)
+    RETURNING stock_item_id, quantity
+), totals AS (
+    SELECT stock_item_id, SUM(quantity) AS quantity FROM expired GROUP BY stock_item_id
+)
+UPDATE stock_items s SET reserved = s.reserved - totals.quantity, updated_at = now()
+FROM totals WHERE s.id = totals.stock_item_id`, itemID)
+	if err != nil {
+		return fmt.Errorf("error expiring reservations: %w", err)
+	}
+	return nil
+}
+
+var errStockNotTracked = errors.New("stock is not tracked")
+
+// stockItemTx returns the ID of the stock item of a product or of one of its
+// variants. With create set a missing item is created, otherwise
+// errStockNotTracked is returned.
+func stockItemTx(tx *sql.Tx, productID int, variantID *int, create bool) (int, error) {
+	if err := productExists(tx, productID); err != nil {
+		return 0, err
+	}
+	if variantID != nil {
+		var exists bool
+		err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM product_variants WHERE id = $1 AND product_id = $2)`,
+			*variantID, productID).Scan(&exists)
+		if err != nil {
+			return 0, err
+		}
+		if !exists {
+			return 0, invalidInput("stock_items_variant_id", ErrVariantNotFound)
+		}
+	}
+
+	if create {
+		_, err := tx.Exec(`INSERT INTO stock_items (product_id, variant_id) VALUES ($1, $2)
+            ON CONFLICT (product_id, (COALESCE(variant_id, 0))) DO NOTHING`, productID, variantID)
+		if err != nil {
+			return 0, fmt.Errorf("error creating stock item: %w", constraintError(err))
+		}
+	}
+
+	var itemID int
+	err := tx.QueryRow(`SELECT id FROM stock_items WHERE product_id = $1 AND variant_id IS NOT DISTINCT FROM $2`,
+		productID, variantID).Scan(&itemID)
+	if err == sql.ErrNoRows {
+		return 0, errStockNotTracked
+	}
+	return itemID, err
+}
+
+func recordStockMovementTx(tx *sql.Tx, itemID, delta int, reason string, reservationID *int) error {
+	_, err := tx.Exec(`INSERT INTO stock_movements (stock_item_id, delta, reason, reservation_id) VALUES ($1, $2, $3, $4)`,
+		itemID, delta, reason, reservationID)
+	if err != nil {
+		return fmt.Errorf("error recording stock movement: %w", constraintError(err))
+	}
+	return nil
+}
+
+// loadProductStock returns the stock levels of every given product keyed by
+// product ID. The product's own level comes first, then those of its variants
+// ordered by variant ID.
+func loadProductStock(q querier, productIDs []int) (map[int][]models.StockLevel, error) {
+	query := `SELECT s.product_id, ` + stockLevelColumns + ` FROM stock_items s
+WHERE s.product_id = ANY($1) ORDER BY s.product_id, s.variant_id NULLS FIRST`
+	rows, err := q.Query(query, pq.Array(productIDs))
+	if err != nil {
+		return nil, fmt.Errorf("error fetching stock for products: %w", err)
+	}
+	defer rows.Close()
+
+	stock := make(map[int][]models.StockLevel, len(productIDs))
+	for rows.Next() {
+		var (
+			productID int
+			level     models.StockLevel
+		)
+		if err := rows.Scan(&productID, &level.VariantID, &level.OnHand, &level.Reserved); err != nil {
+			return nil, fmt.Errorf("error scanning stock level: %w", err)
+		}
+		level.Available = level.OnHand - level.Reserved
+		stock[productID] = append(stock[productID], level)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating stock levels: %w", err)
+	}
+
+	return stock, nil
+}
+
+// attachStock sets the total stock of a product and the stock of each of its
+// variants. Products without stock tracking are left without stock.
+func attachStock(product *models.Product, levels []models.StockLevel) {
+	if len(levels) == 0 {
+		return
+	}
+
+	total := models.StockLevel{}
+	for _, level := range levels {
+		total.OnHand += level.OnHand
+		total.Reserved += level.Reserved
+		total.Available += level.Available
+	}
+	product.Stock = &total
+
+	attachVariantStock(product.Variants, levels)
+}
+
+func attachVariantStock(variants []models.ProductVariant, levels []models.StockLevel) {
+	for _, level := range levels {
+		if level.VariantID == nil {
+			continue
+		}
+		for i := range variants {
+			if variants[i].ID == *level.VariantID {
+				level := level
+				level.VariantID = nil
+				variants[i].Stock = &level
+			}
+		}
+	}
+}
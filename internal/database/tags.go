@@ -0,0 +1,253 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/say8hi/go-api-test/internal/models"
+)
+
+const maxTagLength = 64
+
+// NormalizeTag returns the stored form of a tag: trimmed and lowercase. It
+// fails when the tag is empty or too long.
+func NormalizeTag(name string) (string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" || len(name) > maxTagLength {
+		return "", invalidInput("tags_name_format", errors.New(constraintMessages["tags_name_format"]))
+	}
+	return name, nil
+}
+
+// normalizeTags normalizes names and drops duplicates, keeping their order.
+func normalizeTags(names []string) ([]string, error) {
+	tags := make([]string, 0, len(names))
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		tag, err := NormalizeTag(name)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	return tags, nil
+}
+
+// Table Tags
+
+// GetTagCounts returns every tag in use by products with one of statuses with
+// the number of those products, the most used first.
+func GetTagCounts(statuses []string) ([]models.TagCount, error) {
+	conditions, args := statusConditions(statuses, 1)
+	query := `
+SELECT t.name, COUNT(*) FROM tags t JOIN product_tags pt ON pt.tag_id = t.id JOIN products p ON p.id = pt.product_id`
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+	rows, err := db.Query(query+` GROUP BY t.name ORDER BY COUNT(*) DESC, t.name`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying tags: %w", err)
+	}
+	defer rows.Close()
+
+	counts := []models.TagCount{}
+	for rows.Next() {
+		var count models.TagCount
+		if err := rows.Scan(&count.Name, &count.Products); err != nil {
+			return nil, fmt.Errorf("error scanning tag: %w", err)
+		}
+		counts = append(counts, count)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating tags: %w", err)
+	}
+
+	return counts, nil
+}
+
+// GetProductsByTag returns the products carrying a tag that match filter,
+// ordered by ID.
+func GetProductsByTag(name string, filter models.ProductFilter) ([]models.Product, error) {
+	tag, err := NormalizeTag(name)
+	if err != nil {
+		return nil, err
+	}
+
+	filter.Tags = append([]string{tag}, filter.Tags...)
+	conditions, args := productFilterConditions(filter, 1)
+	query := `SELECT ` + productColumns + ` FROM products p WHERE ` + strings.Join(conditions, " AND ") + ` ORDER BY p.id`
+	products, err := queryProducts(db, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying products by tag: %w", err)
+	}
+
+	return products, nil
+}
+
+func GetProductTags(productID int) ([]string, error) {
+	if err := productExists(db, productID); err != nil {
+		return nil, err
+	}
+
+	tags, err := loadProductTags(db, []int{productID})
+	if err != nil {
+		return nil, err
+	}
+	if tags[productID] == nil {
+		return []string{}, nil
+	}
+	return tags[productID], nil
+}
+
+// TagProduct adds tags to a product, creating missing tags, and returns all
+// tags of the product. Tags the product already has are kept.
+func TagProduct(productID int, names []string) ([]string, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := lockProductTx(tx, productID); err != nil {
+		return nil, err
+	}
+
+	tags, err := normalizeTags(names)
+	if err != nil {
+		return nil, err
+	}
+	added, err := tagProductTx(tx, productID, tags)
+	if err != nil {
+		return nil, err
+	}
+	if added > 0 {
+		if err := enqueueProductEvent(tx, productID, models.EventProductUpdated); err != nil {
+			return nil, err
+		}
+	}
+
+	productTags, err := loadProductTags(tx, []int{productID})
+	if err != nil {
+		return nil, err
+	}
+	if productTags[productID] == nil {
+		productTags[productID] = []string{}
+	}
+
+	return productTags[productID], tx.Commit()
+}
+
+// UntagProduct removes a tag from a product. It returns sql.ErrNoRows when the
+// product doesn't carry the tag.
+func UntagProduct(productID int, name string) error {
+	tag, err := NormalizeTag(name)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`DELETE FROM product_tags pt USING tags t WHERE pt.tag_id = t.id AND pt.product_id = $1 AND t.name = $2`,
+		productID, tag)
+	if err != nil {
+		return fmt.Errorf("error removing tag: %w", err)
+	}
+	if removed, _ := result.RowsAffected(); removed == 0 {
+		return sql.ErrNoRows
+	}
+
+	if err := enqueueProductEvent(tx, productID, models.EventProductUpdated); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// tagProductTx links a product to normalized tags, creating missing ones. It
+// returns the number of new links.
+func tagProductTx(tx *sql.Tx, productID int, tags []string) (int64, error) {
+	var added int64
+	for _, tag := range tags {
+		var tagID int
+		// DO UPDATE instead of DO NOTHING, so the ID of an existing tag is
+		// returned too.
+		err := tx.QueryRow(`INSERT INTO tags (name) VALUES ($1) ON CONFLICT (name) DO UPDATE SET name = EXCLUDED.name RETURNING id`,
+			tag).Scan(&tagID)
+		if err != nil {
+			return 0, fmt.Errorf("error creating tag: %w", constraintError(err))
+		}
+
+		result, err := tx.Exec(`INSERT INTO product_tags (product_id, tag_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`, productID, tagID)
+		if err != nil {
+			return 0, fmt.Errorf("error tagging product: %w", err)
+		}
+		inserted, _ := result.RowsAffected()
+		added += inserted
+	}
+	return added, nil
+}
+
+// linkIngestedTagsTx adds the tags sent by the source to a product. Tags that
+// can't be stored are skipped. It returns the number of tags added.
+func linkIngestedTagsTx(tx *sql.Tx, productID int, names []string) (int64, error) {
+	var tags []string
+	for _, name := range names {
+		if tag, err := NormalizeTag(name); err == nil {
+			tags = append(tags, tag)
+		}
+	}
+	return tagProductTx(tx, productID, tags)
+}
+
+// tagConditions returns the condition matching products that carry every
+// normalized tag and its arguments, numbered from $next on. Queries must alias
+// products as p.
+func tagConditions(tags []string, next int) ([]string, []interface{}) {
+	if len(tags) == 0 {
+		return nil, nil
+	}
+	condition := fmt.Sprintf(`p.id IN (
+    SELECT pt.product_id FROM product_tags pt JOIN tags t ON t.id = pt.tag_id
+    WHERE t.name = ANY($%d) GROUP BY pt.product_id HAVING COUNT(*) = $%d)`, next, next+1)
+	return []string{condition}, []interface{}{pq.Array(tags), len(tags)}
+}
+
+// loadProductTags returns the tags of every given product keyed by product ID,
+// ordered by name.
+func loadProductTags(q querier, productIDs []int) (map[int][]string, error) {
+	query := `
+SELECT pt.product_id, t.name FROM product_tags pt JOIN tags t ON t.id = pt.tag_id
+WHERE pt.product_id = ANY($1) ORDER BY pt.product_id, t.name`
+	rows, err := q.Query(query, pq.Array(productIDs))
+	if err != nil {
+		return nil, fmt.Errorf("error fetching tags for products: %w", err)
+	}
+	defer rows.Close()
+
+	tags := make(map[int][]string, len(productIDs))
+	for rows.Next() {
+		var (
+			productID int
+			tag       string
+		)
+		if err := rows.Scan(&productID, &tag); err != nil {
+			return nil, fmt.Errorf("error scanning tag: %w", err)
+		}
+		tags[productID] = append(tags[productID], tag)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating tags: %w", err)
+	}
+
+	return tags, nil
+}
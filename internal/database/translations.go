@@ -0,0 +1,344 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/say8hi/go-api-test/internal/locale"
+	"github.com/say8hi/go-api-test/internal/models"
+)
+
+// translatedTable describes the translations of the rows of a table. The rows
+// themselves hold the content in the default locale.
+type translatedTable struct {
+	table        string
+	translations string
+	column       string
+}
+
+var (
+	productTranslations  = translatedTable{table: "products", translations: "product_translations", column: "product_id"}
+	categoryTranslations = translatedTable{table: "categories", translations: "category_translations", column: "category_id"}
+)
+
+// translationLocale normalizes the locale of a translation, which must be
+// supported and not the default locale.
+func translationLocale(lang string) (string, error) {
+	lang = locale.Normalize(lang)
+	if !locale.IsSupported(lang) || lang == locale.Default() {
+		constraint := "translations_locale_unsupported"
+		return "", invalidInput(constraint, errors.New(constraintMessages[constraint]))
+	}
+	return lang, nil
+}
+
+// list returns the translations of row id ordered by locale, or sql.ErrNoRows
+// when the row doesn't exist.
+func (t translatedTable) list(id int) ([]models.Translation, error) {
+	var exists bool
+	if err := db.QueryRow(fmt.Sprintf(`SELECT EXISTS (SELECT 1 FROM %s WHERE id = $1)`, t.table), id).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, sql.ErrNoRows
+	}
+
+	translations, err := t.load(db, []int{id}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return byLocale(translations[id]), nil
+}
+
+// setTx creates or replaces the translation of row id, which must be locked.
+func (t translatedTable) setTx(tx *sql.Tx, id int, lang string, request models.TranslationRequest) (models.Translation, error) {
+	translation := models.Translation{Locale: lang, Name: request.Name, Description: request.Description}
+	_, err := tx.Exec(fmt.Sprintf(`
+INSERT INTO %s (%s, locale, name, description) VALUES ($1, $2, $3, $4)
+ON CONFLICT (%s, locale) DO UPDATE SET name = EXCLUDED.name, description = EXCLUDED.description`,
+		t.translations, t.column, t.column), id, lang, translation.Name, translation.Description)
+	if err != nil {
+		return models.Translation{}, fmt.Errorf("error saving translation: %w", constraintError(err))
+	}
+	return translation, nil
+}
+
+// deleteTx removes the translation of row id. It returns sql.ErrNoRows when
+// there is none.
+func (t translatedTable) deleteTx(tx *sql.Tx, id int, lang string) error {
+	result, err := tx.Exec(fmt.Sprintf(`DELETE FROM %s WHERE %s = $1 AND locale = $2`, t.translations, t.column), id, lang)
+	if err != nil {
+		return fmt.Errorf("error deleting translation: %w", err)
+	}
+	if deleted, _ := result.RowsAffected(); deleted == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// load returns the translations of every given row, or of all rows when ids
+// is nil, keyed by row ID and locale. With locales set only those locales are
+// loaded.
+func (t translatedTable) load(q querier, ids []int, locales []string) (map[int]map[string]models.Translation, error) {
+	var (
+		conditions []string
+		args       []interface{}
+	)
+	if ids != nil {
+		args = append(args, pq.Array(ids))
+		conditions = append(conditions, fmt.Sprintf(`%s = ANY($%d)`, t.column, len(args)))
+	}
+	if locales != nil {
+		args = append(args, pq.Array(locales))
+		conditions = append(conditions, fmt.Sprintf(`locale = ANY($%d)`, len(args)))
+	}
+	query := fmt.Sprintf(`SELECT %s, locale, name, description FROM %s`, t.column, t.translations)
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching translations: %w", err)
+	}
+	defer rows.Close()
+
+	translations := make(map[int]map[string]models.Translation, len(ids))
+	for rows.Next() {
+		var (
+			id          int
+			translation models.Translation
+		)
+		if err := rows.Scan(&id, &translation.Locale, &translation.Name, &translation.Description); err != nil {
+			return nil, fmt.Errorf("error scanning translation: %w", err)
+		}
+		if translations[id] == nil {
+			translations[id] = make(map[string]models.Translation)
+		}
+		translations[id][translation.Locale] = translation
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating translations: %w", err)
+	}
+
+	return translations, nil
+}
+
+// byLocale returns translations ordered by locale.
+func byLocale(translations map[string]models.Translation) []models.Translation {
+	list := make([]models.Translation, 0, len(translations))
+	for _, translation := range translations {
+		list = append(list, translation)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Locale < list[j].Locale })
+	return list
+}
+
+// localize returns the name and description of a row along chain: each field
+// comes from the first locale having it, the default locale being the row
+// itself.
+func localize(translations map[string]models.Translation, chain []string, name, description string) (string, string) {
+	localizedName, localizedDescription := "", (*string)(nil)
+	for _, lang := range chain {
+		translation, ok := translations[lang]
+		if !ok {
+			continue
+		}
+		if localizedName == "" {
+			localizedName = translation.Name
+		}
+		if localizedDescription == nil {
+			localizedDescription = translation.Description
+		}
+	}
+
+	if localizedName != "" {
+		name = localizedName
+	}
+	if localizedDescription != nil {
+		description = *localizedDescription
+	}
+	return name, description
+}
+
+// GetProductTranslations returns the translations of a product.
+func GetProductTranslations(productID int) ([]models.Translation, error) {
+	return productTranslations.list(productID)
+}
+
+// SetProductTranslation creates or replaces the translation of a product into
+// a locale.
+func SetProductTranslation(productID int, lang string, request models.TranslationRequest) (models.Translation, error) {
+	lang, err := translationLocale(lang)
+	if err != nil {
+		return models.Translation{}, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return models.Translation{}, err
+	}
+	defer tx.Rollback()
+
+	if err := lockProductTx(tx, productID); err != nil {
+		return models.Translation{}, err
+	}
+	translation, err := productTranslations.setTx(tx, productID, lang, request)
+	if err != nil {
+		return models.Translation{}, err
+	}
+	if err := enqueueProductEvent(tx, productID, models.EventProductUpdated); err != nil {
+		return models.Translation{}, err
+	}
+
+	return translation, tx.Commit()
+}
+
+// DeleteProductTranslation removes the translation of a product into a locale.
+// It returns sql.ErrNoRows when there is none.
+func DeleteProductTranslation(productID int, lang string) error {
+	lang, err := translationLocale(lang)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := productTranslations.deleteTx(tx, productID, lang); err != nil {
+		return err
+	}
+	if err := enqueueProductEvent(tx, productID, models.EventProductUpdated); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetCategoryTranslations returns the translations of a category.
+func GetCategoryTranslations(categoryID int) ([]models.Translation, error) {
+	return categoryTranslations.list(categoryID)
+}
+
+// SetCategoryTranslation creates or replaces the translation of a category
+// into a locale.
+func SetCategoryTranslation(categoryID int, lang string, request models.TranslationRequest) (models.Translation, error) {
+	lang, err := translationLocale(lang)
+	if err != nil {
+		return models.Translation{}, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return models.Translation{}, err
+	}
+	defer tx.Rollback()
+
+	var id int
+	if err := tx.QueryRow(`SELECT id FROM categories WHERE id = $1 FOR UPDATE`, categoryID).Scan(&id); err != nil {
+		return models.Translation{}, err
+	}
+	translation, err := categoryTranslations.setTx(tx, categoryID, lang, request)
+	if err != nil {
+		return models.Translation{}, err
+	}
+	if err := enqueueCategoryEvent(tx, categoryID, models.EventCategoryUpdated); err != nil {
+		return models.Translation{}, err
+	}
+
+	return translation, tx.Commit()
+}
+
+// DeleteCategoryTranslation removes the translation of a category into a
+// locale. It returns sql.ErrNoRows when there is none.
+func DeleteCategoryTranslation(categoryID int, lang string) error {
+	lang, err := translationLocale(lang)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := categoryTranslations.deleteTx(tx, categoryID, lang); err != nil {
+		return err
+	}
+	if err := enqueueCategoryEvent(tx, categoryID, models.EventCategoryUpdated); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// LocalizeProducts replaces the names and descriptions of products and their
+// categories with the first translation found along chain.
+func LocalizeProducts(products []models.Product, chain []string) error {
+	var categories []*models.Category
+	for i := range products {
+		for j := range products[i].Categories {
+			categories = append(categories, &products[i].Categories[j])
+		}
+	}
+	if err := LocalizeCategories(categories, chain); err != nil {
+		return err
+	}
+
+	if len(products) == 0 || !translated(chain) {
+		return nil
+	}
+
+	productIDs := make([]int, len(products))
+	for i, product := range products {
+		productIDs[i] = product.ID
+	}
+	translations, err := productTranslations.load(db, productIDs, chain)
+	if err != nil {
+		return err
+	}
+
+	for i := range products {
+		products[i].Name, products[i].Description = localize(translations[products[i].ID], chain,
+			products[i].Name, products[i].Description)
+	}
+	return nil
+}
+
+// LocalizeCategories replaces the names and descriptions of categories with
+// the first translation found along chain.
+func LocalizeCategories(categories []*models.Category, chain []string) error {
+	if len(categories) == 0 || !translated(chain) {
+		return nil
+	}
+
+	categoryIDs := make([]int, len(categories))
+	for i, category := range categories {
+		categoryIDs[i] = category.ID
+	}
+	translations, err := categoryTranslations.load(db, categoryIDs, chain)
+	if err != nil {
+		return err
+	}
+
+	for _, category := range categories {
+		category.Name, category.Description = localize(translations[category.ID], chain,
+			category.Name, category.Description)
+	}
+	return nil
+}
+
+// translated reports whether chain leads to any locale other than the default
+// one, which needs no translations.
+func translated(chain []string) bool {
+	return len(chain) > 1 || (len(chain) == 1 && chain[0] != locale.Default())
+}
@@ -0,0 +1,234 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/say8hi/go-api-test/internal/models"
+	"github.com/say8hi/go-api-test/internal/money"
+)
+
+// Table Product Variants
+func GetProductVariants(productID int) ([]models.ProductVariant, error) {
+	if err := productExists(db, productID); err != nil {
+		return nil, err
+	}
+
+	variants, err := loadProductVariants(db, []int{productID})
+	if err != nil {
+		return nil, err
+	}
+	if variants[productID] == nil {
+		return []models.ProductVariant{}, nil
+	}
+
+	stock, err := loadProductStock(db, []int{productID})
+	if err != nil {
+		return nil, err
+	}
+	attachVariantStock(variants[productID], stock[productID])
+
+	return variants[productID], nil
+}
+
+func GetProductVariant(productID, variantID int) (models.ProductVariant, error) {
+	query := `SELECT ` + variantColumns + ` FROM product_variants v WHERE v.product_id = $1 AND v.id = $2`
+	variant, err := scanVariant(db.QueryRow(query, productID, variantID))
+	if err != nil {
+		return models.ProductVariant{}, err
+	}
+
+	stock, err := loadProductStock(db, []int{productID})
+	if err != nil {
+		return models.ProductVariant{}, err
+	}
+	variants := []models.ProductVariant{variant}
+	attachVariantStock(variants, stock[productID])
+
+	return variants[0], nil
+}
+
+func CreateVariant(productID int, req models.CreateVariantRequest) (models.ProductVariant, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return models.ProductVariant{}, err
+	}
+	defer tx.Rollback()
+
+	if err := validateVariantTx(tx, productID, 0, req.Options, req.Price); err != nil {
+		return models.ProductVariant{}, err
+	}
+
+	available := true
+	if req.Available != nil {
+		available = *req.Available
+	}
+	options, err := json.Marshal(normalizeOptions(req.Options))
+	if err != nil {
+		return models.ProductVariant{}, err
+	}
+
+	query := `INSERT INTO product_variants AS v (product_id, sku, options, price, available)
+VALUES ($1, $2, $3::jsonb, $4, $5) RETURNING ` + variantColumns
+	variant, err := scanVariant(tx.QueryRow(query, productID, strings.TrimSpace(req.SKU), string(options), req.Price, available))
+	if err != nil {
+		return models.ProductVariant{}, fmt.Errorf("error creating variant: %w", constraintError(err))
+	}
+
+	if err := enqueueProductEvent(tx, productID, models.EventProductUpdated); err != nil {
+		return models.ProductVariant{}, err
+	}
+
+	return variant, tx.Commit()
+}
+
+func UpdateVariant(productID, variantID int, req models.VariantUpdateRequest) (models.ProductVariant, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return models.ProductVariant{}, err
+	}
+	defer tx.Rollback()
+
+	var setParts []string
+	var args []interface{}
+	set := func(column string, value interface{}) {
+		args = append(args, value)
+		setParts = append(setParts, fmt.Sprintf("%s = $%d", column, len(args)))
+	}
+
+	if req.SKU != nil {
+		set("sku", strings.TrimSpace(*req.SKU))
+	}
+	if req.Options != nil {
+		options, err := json.Marshal(normalizeOptions(req.Options))
+		if err != nil {
+			return models.ProductVariant{}, err
+		}
+		args = append(args, string(options))
+		setParts = append(setParts, fmt.Sprintf("options = $%d::jsonb", len(args)))
+	}
+	if req.InheritPrice {
+		setParts = append(setParts, "price = NULL")
+	} else if req.Price != nil {
+		set("price", *req.Price)
+	}
+	if req.Available != nil {
+		set("available", *req.Available)
+	}
+
+	if len(setParts) == 0 {
+		return models.ProductVariant{}, fmt.Errorf("no fields to update")
+	}
+
+	if err := validateVariantTx(tx, productID, variantID, req.Options, req.Price); err != nil {
+		return models.ProductVariant{}, err
+	}
+
+	args = append(args, productID, variantID)
+	query := fmt.Sprintf("UPDATE product_variants AS v SET %s WHERE v.product_id = $%d AND v.id = $%d RETURNING %s",
+		strings.Join(setParts, ", "), len(args)-1, len(args), variantColumns)
+	variant, err := scanVariant(tx.QueryRow(query, args...))
+	if err == sql.ErrNoRows {
+		return models.ProductVariant{}, err
+	} else if err != nil {
+		return models.ProductVariant{}, fmt.Errorf("error updating variant: %w", constraintError(err))
+	}
+
+	if err := enqueueProductEvent(tx, productID, models.EventProductUpdated); err != nil {
+		return models.ProductVariant{}, err
+	}
+
+	return variant, tx.Commit()
+}
+
+func DeleteVariant(productID, variantID int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`DELETE FROM product_variants WHERE product_id = $1 AND id = $2`, productID, variantID)
+	if err != nil {
+		return fmt.Errorf("error deleting variant: %w", constraintError(err))
+	}
+	if deleted, _ := result.RowsAffected(); deleted == 0 {
+		return sql.ErrNoRows
+	}
+
+	if err := enqueueProductEvent(tx, productID, models.EventProductUpdated); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// validateVariantTx checks a new or changed variant against its product. It
+// locks the product, so concurrent changes to its variants are serialized.
+// All variants of a product must use the same option names, e.g. size and
+// color.
+func validateVariantTx(tx *sql.Tx, productID, variantID int, options map[string]string, price *money.Amount) error {
+	var currency string
+	err := tx.QueryRow(`SELECT currency FROM products WHERE id = $1 FOR UPDATE`, productID).Scan(&currency)
+	if err != nil {
+		return err
+	}
+
+	if price != nil {
+		if err := money.Validate(*price, currency); err != nil {
+			return invalidInput("product_variants_price", err)
+		}
+	}
+
+	if options == nil {
+		return nil
+	}
+	for name, value := range options {
+		if strings.TrimSpace(name) == "" || strings.TrimSpace(value) == "" {
+			return invalidInput("product_variants_options", errors.New("option names and values must not be empty"))
+		}
+	}
+
+	var existing []byte
+	err = tx.QueryRow(`SELECT options FROM product_variants WHERE product_id = $1 AND id <> $2 ORDER BY id LIMIT 1`,
+		productID, variantID).Scan(&existing)
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var existingOptions map[string]string
+	if err := json.Unmarshal(existing, &existingOptions); err != nil {
+		return err
+	}
+	want, got := optionNames(existingOptions), optionNames(normalizeOptions(options))
+	if strings.Join(want, ",") != strings.Join(got, ",") {
+		return invalidInput("product_variants_options",
+			fmt.Errorf("variants of this product use the options %s", strings.Join(want, ", ")))
+	}
+	return nil
+}
+
+// normalizeOptions trims option names and values and lowercases the names, so
+// "Size" and "size " are the same dimension.
+func normalizeOptions(options map[string]string) map[string]string {
+	normalized := make(map[string]string, len(options))
+	for name, value := range options {
+		normalized[strings.ToLower(strings.TrimSpace(name))] = strings.TrimSpace(value)
+	}
+	return normalized
+}
+
+func optionNames(options map[string]string) []string {
+	names := make([]string, 0, len(options))
+	for name := range options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
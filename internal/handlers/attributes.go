@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/say8hi/go-api-test/internal/database"
+	"github.com/say8hi/go-api-test/internal/models"
+	"github.com/say8hi/go-api-test/internal/utils"
+)
+
+// attributeFilterPrefix marks query parameters filtering products by
+// attribute, e.g. ?attr.color=red.
+const attributeFilterPrefix = "attr."
+
+func GetCategoryAttributesHandler(w http.ResponseWriter, r *http.Request) {
+	categoryID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	attributes, err := database.GetCategoryAttributes(categoryID)
+	if err == sql.ErrNoRows {
+		utils.SendJSONError(w, "category not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(attributes)
+}
+
+func CreateAttributeHandler(w http.ResponseWriter, r *http.Request) {
+	categoryID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	var request models.CreateAttributeRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	attribute, err := database.CreateAttribute(categoryID, request)
+	if err == sql.ErrNoRows {
+		utils.SendJSONError(w, "category not found", http.StatusNotFound)
+		return
+	} else if err != nil && sendConstraintError(w, err) {
+		return
+	} else if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(attribute)
+}
+
+func UpdateAttributeHandler(w http.ResponseWriter, r *http.Request) {
+	categoryID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	attributeID, ok := pathID(w, r, "attributeID")
+	if !ok {
+		return
+	}
+
+	var request models.AttributeUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	attribute, err := database.UpdateAttribute(categoryID, attributeID, request)
+	if err == sql.ErrNoRows {
+		utils.SendJSONError(w, "attribute not found", http.StatusNotFound)
+		return
+	} else if err != nil && sendConstraintError(w, err) {
+		return
+	} else if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(attribute)
+}
+
+func DeleteAttributeHandler(w http.ResponseWriter, r *http.Request) {
+	categoryID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	attributeID, ok := pathID(w, r, "attributeID")
+	if !ok {
+		return
+	}
+
+	err := database.DeleteAttribute(categoryID, attributeID)
+	if err == sql.ErrNoRows {
+		utils.SendJSONError(w, "attribute not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.GeneralResponse{Status: "success", Message: "Attribute deleted successfully"})
+}
+
+// attributeFilter reads the attr.* query parameters. On failure it answers
+// with 400 and returns false.
+func attributeFilter(w http.ResponseWriter, r *http.Request) (map[string][]string, bool) {
+	var filter map[string][]string
+	for key, values := range r.URL.Query() {
+		name, ok := strings.CutPrefix(key, attributeFilterPrefix)
+		if !ok {
+			continue
+		}
+		name = strings.ToLower(name)
+		if !database.ValidAttributeName(name) {
+			utils.SendJSONError(w, "Invalid attribute filter "+key, http.StatusBadRequest)
+			return nil, false
+		}
+		if filter == nil {
+			filter = make(map[string][]string)
+		}
+		filter[name] = append(filter[name], values...)
+	}
+	return filter, true
+}
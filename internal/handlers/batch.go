@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/say8hi/go-api-test/internal/database"
+	"github.com/say8hi/go-api-test/internal/models"
+	"github.com/say8hi/go-api-test/internal/utils"
+)
+
+// BatchProductsHandler creates, updates and deletes products in one request
+// and reports the outcome of every operation. Failed operations don't fail
+// the request; the report tells whether the batch was committed.
+func BatchProductsHandler(w http.ResponseWriter, r *http.Request) {
+	var request models.BatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(request.Operations) == 0 {
+		utils.SendJSONError(w, "operations must not be empty", http.StatusBadRequest)
+		return
+	}
+	if len(request.Operations) > database.MaxBatchOperations {
+		utils.SendJSONError(w, "A batch holds at most "+strconv.Itoa(database.MaxBatchOperations)+" operations", http.StatusBadRequest)
+		return
+	}
+
+	report, err := database.BatchProducts(request)
+	if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,470 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/say8hi/go-api-test/internal/database"
+	"github.com/say8hi/go-api-test/internal/models"
+	"github.com/say8hi/go-api-test/internal/money"
+	"github.com/say8hi/go-api-test/internal/utils"
+)
+
+const (
+	formatCSV   = "csv"
+	formatJSONL = "jsonl"
+
+	importChunkSize = 100
+	maxJSONLLine    = 1 << 20
+
+	// categorySeparator joins category names inside one CSV field.
+	categorySeparator = "|"
+)
+
+var productCSVHeader = []string{"id", "external_id", "name", "description", "price", "currency", "categories", "attributes"}
+var categoryCSVHeader = []string{"id", "name", "description"}
+
+// bulkFormat reads ?format=, which defaults to JSON Lines.
+func bulkFormat(w http.ResponseWriter, r *http.Request) (string, bool) {
+	format := r.URL.Query().Get("format")
+	switch format {
+	case "", formatJSONL:
+		return formatJSONL, true
+	case formatCSV:
+		return formatCSV, true
+	}
+	utils.SendJSONError(w, "Unknown format "+format+", use csv or jsonl", http.StatusBadRequest)
+	return "", false
+}
+
+// bulkWriter writes records as CSV or JSON Lines and flushes after every page,
+// so large exports are streamed instead of buffered.
+type bulkWriter struct {
+	w      http.ResponseWriter
+	format string
+	csv    *csv.Writer
+	json   *json.Encoder
+}
+
+func newBulkWriter(w http.ResponseWriter, format, name string, header []string) *bulkWriter {
+	bw := &bulkWriter{w: w, format: format}
+	if format == formatCSV {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.csv"`, name))
+		bw.csv = csv.NewWriter(w)
+		bw.csv.Write(header)
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.jsonl"`, name))
+		bw.json = json.NewEncoder(w)
+	}
+	w.WriteHeader(http.StatusOK)
+	return bw
+}
+
+func (bw *bulkWriter) write(csvRecord []string, jsonRecord interface{}) error {
+	if bw.csv != nil {
+		return bw.csv.Write(csvRecord)
+	}
+	return bw.json.Encode(jsonRecord)
+}
+
+func (bw *bulkWriter) flush() error {
+	if bw.csv != nil {
+		bw.csv.Flush()
+		if err := bw.csv.Error(); err != nil {
+			return err
+		}
+	}
+	if flusher, ok := bw.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return nil
+}
+
+func ExportProductsHandler(w http.ResponseWriter, r *http.Request) {
+	format, ok := bulkFormat(w, r)
+	if !ok {
+		return
+	}
+
+	bw := newBulkWriter(w, format, "products", productCSVHeader)
+	err := database.ExportProducts(func(products []models.Product) error {
+		for _, product := range products {
+			record := productRecord(product)
+			attributes, err := attributesCSV(record.Attributes)
+			if err != nil {
+				return err
+			}
+			csvRecord := []string{
+				strconv.Itoa(record.ID),
+				record.ExternalID,
+				record.Name,
+				record.Description,
+				record.Price.String(),
+				record.Currency,
+				strings.Join(record.Categories, categorySeparator),
+				attributes,
+			}
+			if err := bw.write(csvRecord, record); err != nil {
+				return err
+			}
+		}
+		return bw.flush()
+	})
+	if err != nil {
+		// The status line is already sent, so the export just ends early.
+		log.Printf("Product export failed: %s", err)
+	}
+}
+
+func ExportCategoriesHandler(w http.ResponseWriter, r *http.Request) {
+	format, ok := bulkFormat(w, r)
+	if !ok {
+		return
+	}
+
+	bw := newBulkWriter(w, format, "categories", categoryCSVHeader)
+	err := database.ExportCategories(func(categories []models.Category) error {
+		for _, category := range categories {
+			record := models.CategoryRecord{ID: category.ID, Name: category.Name, Description: category.Description}
+			if err := bw.write([]string{strconv.Itoa(record.ID), record.Name, record.Description}, record); err != nil {
+				return err
+			}
+		}
+		return bw.flush()
+	})
+	if err != nil {
+		log.Printf("Category export failed: %s", err)
+	}
+}
+
+func productRecord(product models.Product) models.ProductRecord {
+	record := models.ProductRecord{
+		ID:          product.ID,
+		ExternalID:  product.ExternalID,
+		Name:        product.Name,
+		Description: product.Description,
+		Price:       product.Price,
+		Currency:    product.Currency,
+		Categories:  []string{},
+		Attributes:  product.Attributes,
+	}
+	for _, category := range product.Categories {
+		record.Categories = append(record.Categories, category.Name)
+	}
+	return record
+}
+
+// ImportProductsHandler creates or updates products from a CSV or JSON Lines
+// body in the export format. Existing products are matched by ?match=name
+// (default) or ?match=external_id. Rows are applied in chunked transactions
+// and the response reports the outcome of every row.
+func ImportProductsHandler(w http.ResponseWriter, r *http.Request) {
+	format, ok := bulkFormat(w, r)
+	if !ok {
+		return
+	}
+
+	matchBy := r.URL.Query().Get("match")
+	switch matchBy {
+	case "":
+		matchBy = database.MatchByName
+	case database.MatchByName, database.MatchByExternalID:
+	default:
+		utils.SendJSONError(w, "Unknown match "+matchBy+", use name or external_id", http.StatusBadRequest)
+		return
+	}
+
+	importer := &chunkedImport[models.ProductRecord]{
+		apply: func(records []models.ProductRecord) ([]models.ImportRowResult, error) {
+			return database.ImportProducts(records, matchBy)
+		},
+		row: func(record models.ProductRecord) int { return record.Row },
+	}
+
+	var err error
+	if format == formatCSV {
+		err = readCSVRecords(r.Body, []string{"name"}, func(row int, fields map[string]string) {
+			record, err := productRecordFromCSV(fields)
+			record.Row = row
+			importer.add(record, err)
+		}, importer.fail)
+	} else {
+		err = readJSONLRecords(r.Body, func(row int, line []byte) {
+			var record models.ProductRecord
+			err := json.Unmarshal(line, &record)
+			if err == nil {
+				record.Fields, err = jsonFields(line)
+			}
+			record.Row = row
+			importer.add(record, err)
+		}, importer.fail)
+	}
+	if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(importer.report())
+}
+
+// ImportCategoriesHandler creates or updates categories, matched by name, like
+// ImportProductsHandler.
+func ImportCategoriesHandler(w http.ResponseWriter, r *http.Request) {
+	format, ok := bulkFormat(w, r)
+	if !ok {
+		return
+	}
+
+	importer := &chunkedImport[models.CategoryRecord]{
+		apply: database.ImportCategories,
+		row:   func(record models.CategoryRecord) int { return record.Row },
+	}
+
+	var err error
+	if format == formatCSV {
+		err = readCSVRecords(r.Body, []string{"name"}, func(row int, fields map[string]string) {
+			importer.add(models.CategoryRecord{
+				Row:         row,
+				Fields:      csvFields(fields),
+				Name:        fields["name"],
+				Description: fields["description"],
+			}, nil)
+		}, importer.fail)
+	} else {
+		err = readJSONLRecords(r.Body, func(row int, line []byte) {
+			var record models.CategoryRecord
+			err := json.Unmarshal(line, &record)
+			if err == nil {
+				record.Fields, err = jsonFields(line)
+			}
+			record.Row = row
+			importer.add(record, err)
+		}, importer.fail)
+	}
+	if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(importer.report())
+}
+
+// attributesCSV writes attributes as a JSON object, or an empty cell when
+// there are none.
+func attributesCSV(attributes models.Attributes) (string, error) {
+	if len(attributes) == 0 {
+		return "", nil
+	}
+	data, err := json.Marshal(attributes)
+	return string(data), err
+}
+
+// productRecordFromCSV reads a product row. Empty price, categories and
+// attributes cells count as missing, so updates keep the current values.
+func productRecordFromCSV(fields map[string]string) (models.ProductRecord, error) {
+	record := models.ProductRecord{
+		Fields:      csvFields(fields),
+		ExternalID:  fields["external_id"],
+		Name:        fields["name"],
+		Description: fields["description"],
+		Currency:    strings.ToUpper(fields["currency"]),
+	}
+
+	if price := strings.TrimSpace(fields["price"]); price != "" {
+		amount, err := money.Parse(price)
+		if err != nil {
+			return record, err
+		}
+		record.Price = amount
+	} else {
+		delete(record.Fields, "price")
+	}
+
+	if categories := strings.TrimSpace(fields["categories"]); categories != "" {
+		for _, name := range strings.Split(categories, categorySeparator) {
+			record.Categories = append(record.Categories, strings.TrimSpace(name))
+		}
+	} else {
+		delete(record.Fields, "categories")
+	}
+
+	if attributes := strings.TrimSpace(fields["attributes"]); attributes != "" {
+		if err := json.Unmarshal([]byte(attributes), &record.Attributes); err != nil {
+			return record, fmt.Errorf("invalid attributes: %w", err)
+		}
+	} else {
+		delete(record.Fields, "attributes")
+	}
+
+	return record, nil
+}
+
+// csvFields lists the columns of a CSV row.
+func csvFields(fields map[string]string) map[string]bool {
+	present := make(map[string]bool, len(fields))
+	for name := range fields {
+		present[name] = true
+	}
+	return present
+}
+
+// jsonFields lists the keys of a JSON Lines record that aren't null.
+func jsonFields(line []byte) (map[string]bool, error) {
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(line, &values); err != nil {
+		return nil, err
+	}
+
+	present := make(map[string]bool, len(values))
+	for name, value := range values {
+		if string(bytes.TrimSpace(value)) != "null" {
+			present[name] = true
+		}
+	}
+	return present, nil
+}
+
+// chunkedImport collects parsed records and applies them importChunkSize at a
+// time, each chunk in its own transaction.
+type chunkedImport[T any] struct {
+	apply   func([]T) ([]models.ImportRowResult, error)
+	row     func(T) int
+	pending []T
+	results []models.ImportRowResult
+}
+
+func (ci *chunkedImport[T]) add(record T, parseErr error) {
+	if parseErr != nil {
+		ci.fail(ci.row(record), parseErr)
+		return
+	}
+
+	ci.pending = append(ci.pending, record)
+	if len(ci.pending) >= importChunkSize {
+		ci.flush()
+	}
+}
+
+func (ci *chunkedImport[T]) fail(row int, err error) {
+	ci.results = append(ci.results, models.ImportRowResult{Row: row, Status: models.ImportFailed, Error: err.Error()})
+}
+
+func (ci *chunkedImport[T]) flush() {
+	if len(ci.pending) == 0 {
+		return
+	}
+
+	results, err := ci.apply(ci.pending)
+	if err != nil {
+		log.Printf("Import chunk failed: %s", err)
+		for _, record := range ci.pending {
+			ci.fail(ci.row(record), errors.New("the transaction of this chunk failed"))
+		}
+	} else {
+		ci.results = append(ci.results, results...)
+	}
+	ci.pending = ci.pending[:0]
+}
+
+func (ci *chunkedImport[T]) report() models.ImportReport {
+	ci.flush()
+	sort.SliceStable(ci.results, func(i, j int) bool { return ci.results[i].Row < ci.results[j].Row })
+
+	report := models.ImportReport{Total: len(ci.results), Rows: ci.results}
+	if report.Rows == nil {
+		report.Rows = []models.ImportRowResult{}
+	}
+	for _, result := range ci.results {
+		switch result.Status {
+		case models.ImportCreated:
+			report.Created++
+		case models.ImportUpdated:
+			report.Updated++
+		default:
+			report.Failed++
+		}
+	}
+	return report
+}
+
+// readCSVRecords calls handle with the fields of every data row keyed by the
+// header names. Rows that can't be read are passed to fail. Only a missing or
+// incomplete header is returned as an error.
+func readCSVRecords(body io.Reader, required []string, handle func(row int, fields map[string]string), fail func(row int, err error)) error {
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return fmt.Errorf("error reading CSV header: %w", err)
+	}
+	for i := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(header[i]))
+	}
+	for _, column := range required {
+		found := false
+		for _, name := range header {
+			found = found || name == column
+		}
+		if !found {
+			return fmt.Errorf("CSV header is missing column %q", column)
+		}
+	}
+
+	for row := 1; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			// The reader can't resynchronize after a quoting error.
+			fail(row, err)
+			return nil
+		}
+
+		if len(record) != len(header) {
+			fail(row, fmt.Errorf("expected %d fields, got %d", len(header), len(record)))
+			continue
+		}
+
+		fields := make(map[string]string, len(header))
+		for i, name := range header {
+			fields[name] = record[i]
+		}
+		handle(row, fields)
+	}
+}
+
+// readJSONLRecords calls handle with every non-empty line of body.
+func readJSONLRecords(body io.Reader, handle func(row int, line []byte), fail func(row int, err error)) error {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), maxJSONLLine)
+
+	row := 0
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		row++
+		handle(row, line)
+	}
+	if err := scanner.Err(); err != nil {
+		fail(row+1, err)
+	}
+	return nil
+}
@@ -5,7 +5,6 @@ import (
 	"encoding/json"
 	"net/http"
 	"strconv"
-	"strings"
 
 	"github.com/gorilla/mux"
 	"github.com/say8hi/go-api-test/internal/database"
@@ -22,8 +21,7 @@ func CreateCategoryHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	createdCategory, err := database.CreateCategory(requestCategory)
-  if err != nil && strings.Contains(err.Error(), "duplicate key value violates unique constraint") {
-      utils.SendJSONError(w, "This category name is already exist.", http.StatusBadRequest)
+  if err != nil && sendConstraintError(w, err) {
     return
   } else if err != nil{
       utils.SendJSONError(w, "Database error.", http.StatusInternalServerError)
@@ -56,7 +54,12 @@ func UpdateCategoryHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	err = database.UpdateCategory(categoryID, requestCategory)
-	if err != nil {
+	if err == sql.ErrNoRows {
+		utils.SendJSONError(w, "category not found", http.StatusNotFound)
+		return
+	} else if err != nil && sendConstraintError(w, err) {
+		return
+	} else if err != nil {
 		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -91,7 +94,9 @@ func DeleteCategoryHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	err = database.DeleteCategory(categoryID)
-	if err != nil {
+	if err != nil && sendConstraintError(w, err) {
+		return
+	} else if err != nil {
 		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -134,6 +139,10 @@ func GetCategoryByIDHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !presentCategories(w, r, []*models.Category{&category}) {
+		return
+	}
+
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(category)
 }
@@ -145,6 +154,170 @@ func GetAllCategoriesHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !presentCategories(w, r, categoryRefs(categories)) {
+		return
+	}
+
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(categories)
 }
+
+func GetCategoryTreeHandler(w http.ResponseWriter, r *http.Request) {
+	tree, err := database.GetCategoryTree()
+	if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if !presentCategories(w, r, treeCategories(tree)) {
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(tree)
+}
+
+func GetCategorySubtreeHandler(w http.ResponseWriter, r *http.Request) {
+	categoryID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	subtree, err := database.GetCategorySubtree(categoryID)
+	if err == sql.ErrNoRows {
+		utils.SendJSONError(w, "category not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if !presentCategories(w, r, treeCategories([]*models.CategoryNode{subtree})) {
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(subtree)
+}
+
+func GetCategoryPathHandler(w http.ResponseWriter, r *http.Request) {
+	categoryID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	path, err := database.GetCategoryPath(categoryID)
+	if err == sql.ErrNoRows {
+		utils.SendJSONError(w, "category not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if !presentCategories(w, r, categoryRefs(path)) {
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(path)
+}
+
+// MoveCategoryHandler moves a category with its subtree under another
+// category, or to the top level when parent_id is null.
+func MoveCategoryHandler(w http.ResponseWriter, r *http.Request) {
+	categoryID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	var request models.MoveCategoryRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err := database.MoveCategory(categoryID, request.ParentID)
+	if err == sql.ErrNoRows {
+		utils.SendJSONError(w, "category not found", http.StatusNotFound)
+		return
+	} else if err != nil && sendConstraintError(w, err) {
+		return
+	} else if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := models.GeneralResponse{
+		Status:  "success",
+		Message: "Category moved successfully",
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// ReorderCategoriesHandler orders the subcategories of a category, or the
+// top-level categories when parent_id is null.
+func ReorderCategoriesHandler(w http.ResponseWriter, r *http.Request) {
+	var request models.ReorderCategoriesRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	categories, err := database.ReorderCategories(request.ParentID, request.CategoryIDs)
+	if err == sql.ErrNoRows {
+		utils.SendJSONError(w, "category not found", http.StatusNotFound)
+		return
+	} else if err != nil && sendConstraintError(w, err) {
+		return
+	} else if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !presentCategories(w, r, categoryRefs(categories)) {
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(categories)
+}
+
+// ReorderCategoryProductsHandler orders the products of a category and
+// returns them, whatever their status, in the new order.
+func ReorderCategoryProductsHandler(w http.ResponseWriter, r *http.Request) {
+	categoryID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	var request models.ReorderProductsRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err := database.ReorderCategoryProducts(categoryID, request.ProductIDs)
+	if err == sql.ErrNoRows {
+		utils.SendJSONError(w, "category not found", http.StatusNotFound)
+		return
+	} else if err != nil && sendConstraintError(w, err) {
+		return
+	} else if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	products, err := database.GetProductsByCategory(categoryID, models.ProductFilter{})
+	if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !presentProducts(w, r, products) {
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(products)
+}
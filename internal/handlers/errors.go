@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/say8hi/go-api-test/internal/database"
+	"github.com/say8hi/go-api-test/internal/utils"
+)
+
+// sendConstraintError answers with 409 or 422 when err is a constraint
+// violation and reports whether it did.
+func sendConstraintError(w http.ResponseWriter, err error) bool {
+	var constraintErr *database.ConstraintError
+	if !errors.As(err, &constraintErr) {
+		return false
+	}
+
+	if constraintErr.Conflict {
+		utils.SendJSONError(w, constraintErr.Message, http.StatusConflict)
+	} else {
+		utils.SendJSONError(w, constraintErr.Message, http.StatusUnprocessableEntity)
+	}
+	return true
+}
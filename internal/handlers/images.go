@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/say8hi/go-api-test/internal/database"
+	"github.com/say8hi/go-api-test/internal/media"
+	"github.com/say8hi/go-api-test/internal/models"
+	"github.com/say8hi/go-api-test/internal/utils"
+)
+
+// multipartOverhead is allowed on top of the upload limit for the headers and
+// boundaries of a multipart body.
+const multipartOverhead = 64 << 10
+
+func GetProductImagesHandler(w http.ResponseWriter, r *http.Request) {
+	productID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	if !productVisible(w, r, productID) {
+		return
+	}
+
+	images, err := database.GetProductImages(productID)
+	if err == sql.ErrNoRows {
+		utils.SendJSONError(w, "product not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(images)
+}
+
+// UploadProductImageHandler stores the file in the multipart field "image"
+// with a thumbnail and adds it to the product.
+func UploadProductImageHandler(w http.ResponseWriter, r *http.Request) {
+	productID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, media.MaxUploadBytes()+multipartOverhead)
+	file, _, err := r.FormFile("image")
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		sendTooLarge(w)
+		return
+	} else if err != nil {
+		utils.SendJSONError(w, "The image must be sent in the multipart field image", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, media.MaxUploadBytes()+1))
+	if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	stored, err := media.SaveImage(fmt.Sprintf("products/%d", productID), data)
+	if errors.Is(err, media.ErrTooLarge) {
+		sendTooLarge(w)
+		return
+	} else if errors.Is(err, media.ErrUnsupportedType) {
+		utils.SendJSONError(w, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	} else if errors.Is(err, media.ErrInvalidImage) {
+		utils.SendJSONError(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	} else if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	image, err := database.AddProductImage(productID, stored)
+	if err != nil {
+		media.Delete(stored.Keys()...)
+	}
+	if err == sql.ErrNoRows {
+		utils.SendJSONError(w, "product not found", http.StatusNotFound)
+		return
+	} else if err != nil && sendConstraintError(w, err) {
+		return
+	} else if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(image)
+}
+
+func sendTooLarge(w http.ResponseWriter) {
+	utils.SendJSONError(w, fmt.Sprintf("The image must not be larger than %d bytes", media.MaxUploadBytes()),
+		http.StatusRequestEntityTooLarge)
+}
+
+func ReorderProductImagesHandler(w http.ResponseWriter, r *http.Request) {
+	productID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	var request models.ReorderImagesRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	images, err := database.ReorderProductImages(productID, request.ImageIDs)
+	if err == sql.ErrNoRows {
+		utils.SendJSONError(w, "product not found", http.StatusNotFound)
+		return
+	} else if err != nil && sendConstraintError(w, err) {
+		return
+	} else if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(images)
+}
+
+func SetPrimaryImageHandler(w http.ResponseWriter, r *http.Request) {
+	productID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	imageID, ok := pathID(w, r, "imageID")
+	if !ok {
+		return
+	}
+
+	err := database.SetPrimaryImage(productID, imageID)
+	if err == sql.ErrNoRows {
+		utils.SendJSONError(w, "image not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.GeneralResponse{Status: "success", Message: "Primary image set successfully"})
+}
+
+func DeleteProductImageHandler(w http.ResponseWriter, r *http.Request) {
+	productID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	imageID, ok := pathID(w, r, "imageID")
+	if !ok {
+		return
+	}
+
+	err := database.DeleteProductImage(productID, imageID)
+	if err == sql.ErrNoRows {
+		utils.SendJSONError(w, "image not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.GeneralResponse{Status: "success", Message: "Image deleted successfully"})
+}
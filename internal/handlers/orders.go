@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+
+	"github.com/say8hi/go-api-test/internal/database"
+	"github.com/say8hi/go-api-test/internal/middlewares"
+	"github.com/say8hi/go-api-test/internal/models"
+	"github.com/say8hi/go-api-test/internal/utils"
+)
+
+func GetCartHandler(w http.ResponseWriter, r *http.Request) {
+	user, _ := middlewares.UserFromContext(r.Context())
+	cart, err := database.GetCart(user.ID)
+	if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(cart)
+}
+
+func AddCartItemHandler(w http.ResponseWriter, r *http.Request) {
+	var request models.AddCartItemRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	user, _ := middlewares.UserFromContext(r.Context())
+	cart, err := database.AddCartItem(user.ID, request)
+	if err == sql.ErrNoRows {
+		utils.SendJSONError(w, "product not found", http.StatusNotFound)
+		return
+	} else if err != nil && sendConstraintError(w, err) {
+		return
+	} else if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(cart)
+}
+
+func UpdateCartItemHandler(w http.ResponseWriter, r *http.Request) {
+	itemID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	var request models.CartItemUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	user, _ := middlewares.UserFromContext(r.Context())
+	cart, err := database.UpdateCartItem(user.ID, itemID, request.Quantity)
+	if err == sql.ErrNoRows {
+		utils.SendJSONError(w, "cart item not found", http.StatusNotFound)
+		return
+	} else if err != nil && sendConstraintError(w, err) {
+		return
+	} else if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(cart)
+}
+
+func RemoveCartItemHandler(w http.ResponseWriter, r *http.Request) {
+	itemID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	user, _ := middlewares.UserFromContext(r.Context())
+	err := database.RemoveCartItem(user.ID, itemID)
+	if err == sql.ErrNoRows {
+		utils.SendJSONError(w, "cart item not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.GeneralResponse{Status: "success", Message: "Item removed successfully"})
+}
+
+// CheckoutHandler places an order for the cart of the current user.
+func CheckoutHandler(w http.ResponseWriter, r *http.Request) {
+	user, _ := middlewares.UserFromContext(r.Context())
+	order, err := database.Checkout(user.ID)
+	if err != nil && sendConstraintError(w, err) {
+		return
+	} else if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(order)
+}
+
+// GetOrdersHandler lists the orders of the current user.
+func GetOrdersHandler(w http.ResponseWriter, r *http.Request) {
+	user, _ := middlewares.UserFromContext(r.Context())
+	orders, err := database.GetOrders(user.ID)
+	if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(orders)
+}
+
+// GetOrderHandler returns an order of the current user, or any order to
+// admins.
+func GetOrderHandler(w http.ResponseWriter, r *http.Request) {
+	orderID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	user, _ := middlewares.UserFromContext(r.Context())
+	order, err := database.GetOrder(orderID, user.ID, middlewares.IsAdmin(user))
+	if err == sql.ErrNoRows {
+		utils.SendJSONError(w, "order not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(order)
+}
+
+// CancelOrderHandler cancels an order of the current user.
+func CancelOrderHandler(w http.ResponseWriter, r *http.Request) {
+	orderID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	user, _ := middlewares.UserFromContext(r.Context())
+	order, err := database.CancelOrder(orderID, user.ID)
+	sendOrder(w, order, err)
+}
+
+func SetOrderStatusHandler(w http.ResponseWriter, r *http.Request) {
+	orderID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	var request models.OrderStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	order, err := database.SetOrderStatus(orderID, request.Status)
+	sendOrder(w, order, err)
+}
+
+func sendOrder(w http.ResponseWriter, order models.Order, err error) {
+	if err == sql.ErrNoRows {
+		utils.SendJSONError(w, "order not found", http.StatusNotFound)
+		return
+	} else if err != nil && sendConstraintError(w, err) {
+		return
+	} else if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(order)
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/say8hi/go-api-test/internal/money"
+	"github.com/say8hi/go-api-test/internal/utils"
+)
+
+// pathID reads the integer path parameter name. On failure it answers with
+// 400 and returns false.
+func pathID(w http.ResponseWriter, r *http.Request, name string) (int, bool) {
+	idStr, ok := mux.Vars(r)[name]
+	if !ok {
+		utils.SendJSONError(w, "ID is missing in parameters", http.StatusBadRequest)
+		return 0, false
+	}
+
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		utils.SendJSONError(w, "Invalid ID format", http.StatusBadRequest)
+		return 0, false
+	}
+
+	return id, true
+}
+
+// currencyCode normalizes an ISO 4217 code and answers with 400 when it is
+// not supported.
+func currencyCode(w http.ResponseWriter, code string) (string, bool) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if !money.ValidCurrency(code) {
+		utils.SendJSONError(w, "Unknown currency "+code, http.StatusBadRequest)
+		return "", false
+	}
+	return code, true
+}
+
+// queryBool reads the optional boolean query parameter name. On failure it
+// answers with 400 and returns false.
+func queryBool(w http.ResponseWriter, r *http.Request, name string) (bool, bool) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return false, true
+	}
+
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		utils.SendJSONError(w, "Invalid "+name+" value", http.StatusBadRequest)
+		return false, false
+	}
+	return parsed, true
+}
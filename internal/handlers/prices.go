@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/say8hi/go-api-test/internal/database"
+	"github.com/say8hi/go-api-test/internal/models"
+	"github.com/say8hi/go-api-test/internal/money"
+	"github.com/say8hi/go-api-test/internal/utils"
+)
+
+func GetProductPricesHandler(w http.ResponseWriter, r *http.Request) {
+	productID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	if !productVisible(w, r, productID) {
+		return
+	}
+
+	prices, err := database.GetProductPrices(productID)
+	if err == sql.ErrNoRows {
+		utils.SendJSONError(w, "product not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(prices)
+}
+
+func SetProductPriceHandler(w http.ResponseWriter, r *http.Request) {
+	productID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	currency, ok := currencyCode(w, mux.Vars(r)["currency"])
+	if !ok {
+		return
+	}
+
+	var request models.SetProductPriceRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	price := models.ProductPrice{Currency: currency, Amount: request.Amount}
+	err := database.SetProductPrice(productID, price)
+	if err == sql.ErrNoRows {
+		utils.SendJSONError(w, "product not found", http.StatusNotFound)
+		return
+	} else if err != nil && sendConstraintError(w, err) {
+		return
+	} else if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(price)
+}
+
+func DeleteProductPriceHandler(w http.ResponseWriter, r *http.Request) {
+	productID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	currency, ok := currencyCode(w, mux.Vars(r)["currency"])
+	if !ok {
+		return
+	}
+
+	err := database.DeleteProductPrice(productID, currency)
+	if err == sql.ErrNoRows {
+		utils.SendJSONError(w, "price not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.GeneralResponse{
+		Status:  "success",
+		Message: "Price deleted successfully",
+	})
+}
+
+func GetExchangeRatesHandler(w http.ResponseWriter, r *http.Request) {
+	rates, err := database.GetExchangeRates()
+	if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(rates)
+}
+
+func SetExchangeRateHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	base, ok := currencyCode(w, vars["base"])
+	if !ok {
+		return
+	}
+	quote, ok := currencyCode(w, vars["quote"])
+	if !ok {
+		return
+	}
+
+	var request models.SetExchangeRateRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rate := models.ExchangeRate{Base: base, Quote: quote, Rate: request.Rate}
+	err := database.SetExchangeRates([]models.ExchangeRate{rate})
+	if err != nil && sendConstraintError(w, err) {
+		return
+	} else if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(rate)
+}
+
+func DeleteExchangeRateHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	base, ok := currencyCode(w, vars["base"])
+	if !ok {
+		return
+	}
+	quote, ok := currencyCode(w, vars["quote"])
+	if !ok {
+		return
+	}
+
+	err := database.DeleteExchangeRate(base, quote)
+	if err == sql.ErrNoRows {
+		utils.SendJSONError(w, "exchange rate not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.GeneralResponse{
+		Status:  "success",
+		Message: "Exchange rate deleted successfully",
+	})
+}
+
+// ImportExchangeRatesHandler replaces rates from an uploaded file: either a
+// JSON array of rates or, with Content-Type text/csv, lines of
+// "base,quote,rate" with an optional header line.
+func ImportExchangeRatesHandler(w http.ResponseWriter, r *http.Request) {
+	var (
+		rates []models.ExchangeRate
+		err   error
+	)
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "text/csv") {
+		rates, err = readExchangeRatesCSV(r.Body)
+	} else {
+		err = json.NewDecoder(r.Body).Decode(&rates)
+	}
+	if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	for i := range rates {
+		rates[i].Base = strings.ToUpper(strings.TrimSpace(rates[i].Base))
+		rates[i].Quote = strings.ToUpper(strings.TrimSpace(rates[i].Quote))
+	}
+
+	err = database.SetExchangeRates(rates)
+	if err != nil && sendConstraintError(w, err) {
+		return
+	} else if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.ImportResult{Imported: len(rates)})
+}
+
+func readExchangeRatesCSV(body io.Reader) ([]models.ExchangeRate, error) {
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = 3
+	reader.TrimLeadingSpace = true
+
+	var rates []models.ExchangeRate
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return rates, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if line == 1 && strings.EqualFold(record[0], "base") {
+			continue
+		}
+
+		rate, err := money.ParseRate(record[2])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		rates = append(rates, models.ExchangeRate{Base: record[0], Quote: record[1], Rate: rate})
+	}
+}
@@ -3,6 +3,7 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -24,6 +25,8 @@ func CreateProductHandler(w http.ResponseWriter, r *http.Request) {
 	if err == database.ErrCategoryDoesntExists {
 		utils.SendJSONError(w, "One or more of the categories you specified doesn't exist", http.StatusBadRequest)
 		return
+	} else if err != nil && sendConstraintError(w, err) {
+		return
 	} else if err != nil {
 		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -47,12 +50,33 @@ func GetAllProductsInCategoryHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	products, err := database.GetProductsByCategory(categoryID)
+	var filter models.ProductFilter
+	if filter.IncludeDescendants, ok = queryBool(w, r, "descendants"); !ok {
+		return
+	}
+	if filter.InStockOnly, ok = queryBool(w, r, "in_stock"); !ok {
+		return
+	}
+	if filter.Attributes, ok = attributeFilter(w, r); !ok {
+		return
+	}
+	if filter.Tags, ok = tagFilter(w, r); !ok {
+		return
+	}
+	if filter.Statuses, ok = statusFilter(w, r); !ok {
+		return
+	}
+
+	products, err := database.GetProductsByCategory(categoryID, filter)
 	if err != nil {
 		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	if !presentProducts(w, r, products) {
+		return
+	}
+
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(products)
 }
@@ -79,11 +103,17 @@ func UpdateProductHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	err = database.UpdateProduct(productID, requestProduct)
-	if err == database.ErrCategoryDoesntExists {
+	if err == sql.ErrNoRows {
+		utils.SendJSONError(w, "product not found", http.StatusNotFound)
+		return
+	} else if err == database.ErrCategoryDoesntExists {
 		utils.SendJSONError(w, err.Error(), http.StatusBadRequest)
 		return
+	} else if err != nil && sendConstraintError(w, err) {
+		return
 	} else if err != nil {
 		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
 	response := models.GeneralResponse{
@@ -145,12 +175,12 @@ func GetProductByIDHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	productID, err := strconv.Atoi(idStr)
-	if err == sql.ErrNoRows {
-		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+	if err != nil {
+		utils.SendJSONError(w, "Invalid ID format", http.StatusBadRequest)
 		return
 	}
 
-	product, err := database.GetProduct(productID)
+	product, err := database.GetProduct(productID, visibleStatuses(r))
 	if err == sql.ErrNoRows {
 		utils.SendJSONError(w, "product not found", http.StatusNotFound)
 		return
@@ -159,6 +189,47 @@ func GetProductByIDHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	products := []models.Product{product}
+	if !presentProducts(w, r, products) {
+		return
+	}
+	product = products[0]
+
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(product)
 }
+
+// presentProducts applies the view options of the request to products before
+// they are written: they are translated into the locale of the request,
+// ?currency= prices them in another currency, and running promotions give
+// their effective prices. It answers with an error and returns false when the
+// options can't be applied.
+func presentProducts(w http.ResponseWriter, r *http.Request, products []models.Product) bool {
+	if err := database.LocalizeProducts(products, requestLocale(w, r)); err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+
+	if currency := r.URL.Query().Get("currency"); currency != "" {
+		currency, ok := currencyCode(w, currency)
+		if !ok {
+			return false
+		}
+
+		err := database.PriceProductsIn(products, currency)
+		if errors.Is(err, database.ErrNoExchangeRate) {
+			utils.SendJSONError(w, err.Error(), http.StatusUnprocessableEntity)
+			return false
+		} else if err != nil {
+			utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+			return false
+		}
+	}
+
+	if err := database.ApplyPromotions(products); err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+
+	"github.com/say8hi/go-api-test/internal/database"
+	"github.com/say8hi/go-api-test/internal/models"
+	"github.com/say8hi/go-api-test/internal/utils"
+)
+
+// GetPromotionsHandler lists promotions, only the running ones with
+// ?running=true.
+func GetPromotionsHandler(w http.ResponseWriter, r *http.Request) {
+	running, ok := queryBool(w, r, "running")
+	if !ok {
+		return
+	}
+
+	promotions, err := database.GetPromotions(running)
+	if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(promotions)
+}
+
+func GetPromotionHandler(w http.ResponseWriter, r *http.Request) {
+	promotionID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	promotion, err := database.GetPromotion(promotionID)
+	if err == sql.ErrNoRows {
+		utils.SendJSONError(w, "promotion not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(promotion)
+}
+
+func CreatePromotionHandler(w http.ResponseWriter, r *http.Request) {
+	var request models.PromotionRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	promotion, err := database.CreatePromotion(request)
+	if err != nil && sendConstraintError(w, err) {
+		return
+	} else if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(promotion)
+}
+
+// UpdatePromotionHandler replaces a promotion.
+func UpdatePromotionHandler(w http.ResponseWriter, r *http.Request) {
+	promotionID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	var request models.PromotionRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	promotion, err := database.UpdatePromotion(promotionID, request)
+	if err == sql.ErrNoRows {
+		utils.SendJSONError(w, "promotion not found", http.StatusNotFound)
+		return
+	} else if err != nil && sendConstraintError(w, err) {
+		return
+	} else if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(promotion)
+}
+
+func DeletePromotionHandler(w http.ResponseWriter, r *http.Request) {
+	promotionID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	err := database.DeletePromotion(promotionID)
+	if err == sql.ErrNoRows {
+		utils.SendJSONError(w, "promotion not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.GeneralResponse{Status: "success", Message: "Promotion deleted successfully"})
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/say8hi/go-api-test/internal/database"
+	"github.com/say8hi/go-api-test/internal/models"
+	"github.com/say8hi/go-api-test/internal/utils"
+)
+
+const (
+	// defaultRelatedLimit and maxRelatedLimit bound ?limit= of related
+	// product listings.
+	defaultRelatedLimit = 10
+	maxRelatedLimit     = 50
+)
+
+// GetRelatedProductsHandler lists the products related to a product, manual
+// links first and then recommendations. ?type= lists the manual links of one
+// type only.
+func GetRelatedProductsHandler(w http.ResponseWriter, r *http.Request) {
+	productID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	if !productVisible(w, r, productID) {
+		return
+	}
+
+	filter := models.RelatedFilter{Type: r.URL.Query().Get("type"), Statuses: visibleStatuses(r), Limit: defaultRelatedLimit}
+	switch filter.Type {
+	case "", models.RelationAccessory, models.RelationSimilar, models.RelationReplacement:
+	default:
+		utils.SendJSONError(w, "Unknown relation type "+filter.Type+", use accessory, similar or replacement", http.StatusBadRequest)
+		return
+	}
+	if value := r.URL.Query().Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxRelatedLimit {
+			utils.SendJSONError(w, "Invalid limit value", http.StatusBadRequest)
+			return
+		}
+		filter.Limit = limit
+	}
+
+	related, err := database.GetRelatedProducts(productID, filter)
+	if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	products := make([]models.Product, len(related))
+	for i := range related {
+		products[i] = related[i].Product
+	}
+	if !presentProducts(w, r, products) {
+		return
+	}
+	for i := range related {
+		related[i].Product = products[i]
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(related)
+}
+
+// SetProductRelationHandler links a related product to a product, or changes
+// the type of the link.
+func SetProductRelationHandler(w http.ResponseWriter, r *http.Request) {
+	productID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	relatedID, ok := pathID(w, r, "relatedID")
+	if !ok {
+		return
+	}
+
+	var request models.ProductRelationRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	relation, err := database.SetProductRelation(productID, relatedID, request.Type)
+	if err == sql.ErrNoRows {
+		utils.SendJSONError(w, "product not found", http.StatusNotFound)
+		return
+	} else if err != nil && sendConstraintError(w, err) {
+		return
+	} else if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(relation)
+}
+
+func DeleteProductRelationHandler(w http.ResponseWriter, r *http.Request) {
+	productID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	relatedID, ok := pathID(w, r, "relatedID")
+	if !ok {
+		return
+	}
+
+	err := database.DeleteProductRelation(productID, relatedID)
+	if err == sql.ErrNoRows {
+		utils.SendJSONError(w, "relation not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.GeneralResponse{Status: "success", Message: "Relation deleted successfully"})
+}
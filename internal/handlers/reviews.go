@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/say8hi/go-api-test/internal/database"
+	"github.com/say8hi/go-api-test/internal/middlewares"
+	"github.com/say8hi/go-api-test/internal/models"
+	"github.com/say8hi/go-api-test/internal/utils"
+)
+
+// GetProductReviewsHandler lists the approved reviews of a product.
+func GetProductReviewsHandler(w http.ResponseWriter, r *http.Request) {
+	productID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	if !productVisible(w, r, productID) {
+		return
+	}
+
+	filter := models.ReviewFilter{ProductID: productID, Statuses: []string{models.ReviewApproved}}
+	if filter.Sort, ok = reviewSort(w, r); !ok {
+		return
+	}
+
+	reviews, err := database.GetReviews(filter)
+	if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(reviews)
+}
+
+// GetReviewsHandler lists reviews for moderation, pending ones unless
+// ?status= asks for others.
+func GetReviewsHandler(w http.ResponseWriter, r *http.Request) {
+	filter := models.ReviewFilter{Statuses: r.URL.Query()["status"]}
+	if len(filter.Statuses) == 0 {
+		filter.Statuses = []string{models.ReviewPending}
+	}
+	for _, status := range filter.Statuses {
+		if !database.ValidReviewStatus(status) {
+			utils.SendJSONError(w, "Unknown review status "+status+", use pending, approved or rejected", http.StatusBadRequest)
+			return
+		}
+	}
+	var ok bool
+	if filter.Sort, ok = reviewSort(w, r); !ok {
+		return
+	}
+
+	reviews, err := database.GetReviews(filter)
+	if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(reviews)
+}
+
+func CreateReviewHandler(w http.ResponseWriter, r *http.Request) {
+	productID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	var request models.ReviewRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	user, _ := middlewares.UserFromContext(r.Context())
+	review, err := database.CreateReview(productID, user.ID, request)
+	if err == sql.ErrNoRows {
+		utils.SendJSONError(w, "product not found", http.StatusNotFound)
+		return
+	} else if err != nil && sendConstraintError(w, err) {
+		return
+	} else if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(review)
+}
+
+func UpdateReviewHandler(w http.ResponseWriter, r *http.Request) {
+	reviewID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	var request models.ReviewRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	user, _ := middlewares.UserFromContext(r.Context())
+	review, err := database.UpdateReview(reviewID, user.ID, request)
+	if err == sql.ErrNoRows {
+		utils.SendJSONError(w, "review not found", http.StatusNotFound)
+		return
+	} else if errors.Is(err, database.ErrNotReviewAuthor) {
+		utils.SendJSONError(w, err.Error(), http.StatusForbidden)
+		return
+	} else if err != nil && sendConstraintError(w, err) {
+		return
+	} else if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(review)
+}
+
+func SetReviewStatusHandler(w http.ResponseWriter, r *http.Request) {
+	reviewID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	var request models.ReviewStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	review, err := database.SetReviewStatus(reviewID, request.Status)
+	if err == sql.ErrNoRows {
+		utils.SendJSONError(w, "review not found", http.StatusNotFound)
+		return
+	} else if err != nil && sendConstraintError(w, err) {
+		return
+	} else if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(review)
+}
+
+// DeleteReviewHandler deletes a review of the current user, or any review
+// when the user is an admin.
+func DeleteReviewHandler(w http.ResponseWriter, r *http.Request) {
+	reviewID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	user, _ := middlewares.UserFromContext(r.Context())
+	err := database.DeleteReview(reviewID, user.ID, middlewares.IsAdmin(user))
+	if err == sql.ErrNoRows {
+		utils.SendJSONError(w, "review not found", http.StatusNotFound)
+		return
+	} else if errors.Is(err, database.ErrNotReviewAuthor) {
+		utils.SendJSONError(w, err.Error(), http.StatusForbidden)
+		return
+	} else if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.GeneralResponse{Status: "success", Message: "Review deleted successfully"})
+}
+
+// reviewSort reads the ?sort= query parameter of review listings. On failure
+// it answers with 400 and returns false.
+func reviewSort(w http.ResponseWriter, r *http.Request) (string, bool) {
+	sort := r.URL.Query().Get("sort")
+	if sort == "" {
+		return models.ReviewSortNewest, true
+	}
+	if !database.ValidReviewSort(sort) {
+		utils.SendJSONError(w, "Unknown sort "+sort+", use newest, oldest, highest or lowest", http.StatusBadRequest)
+		return "", false
+	}
+	return sort, true
+}
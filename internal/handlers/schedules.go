@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+
+	"github.com/say8hi/go-api-test/internal/database"
+	"github.com/say8hi/go-api-test/internal/middlewares"
+	"github.com/say8hi/go-api-test/internal/models"
+	"github.com/say8hi/go-api-test/internal/utils"
+)
+
+// ScheduleProductChangeHandler stores changes to a product that the scheduler
+// applies at effective_at.
+func ScheduleProductChangeHandler(w http.ResponseWriter, r *http.Request) {
+	productID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	var request models.ScheduledChangeRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	user, _ := middlewares.UserFromContext(r.Context())
+	change, err := database.ScheduleProductChange(productID, user.ID, request)
+	if err == sql.ErrNoRows {
+		utils.SendJSONError(w, "product not found", http.StatusNotFound)
+		return
+	} else if err != nil && sendConstraintError(w, err) {
+		return
+	} else if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(change)
+}
+
+// GetProductScheduledChangesHandler lists the scheduled changes of a product,
+// of every status unless ?status= asks for some.
+func GetProductScheduledChangesHandler(w http.ResponseWriter, r *http.Request) {
+	productID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	if !productVisible(w, r, productID) {
+		return
+	}
+
+	listScheduledChanges(w, r, productID)
+}
+
+// GetScheduledChangesHandler lists the scheduled changes of all products, of
+// every status unless ?status= asks for some.
+func GetScheduledChangesHandler(w http.ResponseWriter, r *http.Request) {
+	listScheduledChanges(w, r, 0)
+}
+
+func listScheduledChanges(w http.ResponseWriter, r *http.Request, productID int) {
+	statuses := r.URL.Query()["status"]
+	for _, status := range statuses {
+		if !database.ValidScheduledChangeStatus(status) {
+			utils.SendJSONError(w, "Unknown status "+status+", use pending, applied, failed or cancelled", http.StatusBadRequest)
+			return
+		}
+	}
+
+	changes, err := database.GetScheduledChanges(models.ScheduledChangeFilter{ProductID: productID, Statuses: statuses})
+	if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(changes)
+}
+
+func GetScheduledChangeHandler(w http.ResponseWriter, r *http.Request) {
+	changeID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	change, err := database.GetScheduledChange(changeID)
+	sendScheduledChange(w, change, err)
+}
+
+// CancelScheduledChangeHandler cancels a pending change. The change is kept
+// with the cancelled status.
+func CancelScheduledChangeHandler(w http.ResponseWriter, r *http.Request) {
+	changeID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	change, err := database.CancelScheduledChange(changeID)
+	sendScheduledChange(w, change, err)
+}
+
+func sendScheduledChange(w http.ResponseWriter, change models.ScheduledChange, err error) {
+	if err == sql.ErrNoRows {
+		utils.SendJSONError(w, "scheduled change not found", http.StatusNotFound)
+		return
+	} else if err != nil && sendConstraintError(w, err) {
+		return
+	} else if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(change)
+}
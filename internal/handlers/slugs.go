@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/say8hi/go-api-test/internal/database"
+	"github.com/say8hi/go-api-test/internal/models"
+	"github.com/say8hi/go-api-test/internal/utils"
+)
+
+func GetProductBySlugHandler(w http.ResponseWriter, r *http.Request) {
+	product, movedTo, err := database.GetProductBySlug(mux.Vars(r)["slug"], visibleStatuses(r))
+	if err == sql.ErrNoRows {
+		utils.SendJSONError(w, "product not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if movedTo != "" {
+		redirectToSlug(w, r, "/product/by-slug/", movedTo)
+		return
+	}
+
+	products := []models.Product{product}
+	if !presentProducts(w, r, products) {
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(products[0])
+}
+
+func GetCategoryBySlugHandler(w http.ResponseWriter, r *http.Request) {
+	category, movedTo, err := database.GetCategoryBySlug(mux.Vars(r)["slug"])
+	if err == sql.ErrNoRows {
+		utils.SendJSONError(w, "category not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if movedTo != "" {
+		redirectToSlug(w, r, "/category/by-slug/", movedTo)
+		return
+	}
+
+	if !presentCategories(w, r, []*models.Category{&category}) {
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(category)
+}
+
+// redirectToSlug permanently redirects a lookup by an old slug to the current
+// one, keeping the query string.
+func redirectToSlug(w http.ResponseWriter, r *http.Request, prefix, slug string) {
+	location := prefix + slug
+	if r.URL.RawQuery != "" {
+		location += "?" + r.URL.RawQuery
+	}
+	http.Redirect(w, r, location, http.StatusMovedPermanently)
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+
+	"github.com/say8hi/go-api-test/internal/database"
+	"github.com/say8hi/go-api-test/internal/middlewares"
+	"github.com/say8hi/go-api-test/internal/models"
+	"github.com/say8hi/go-api-test/internal/utils"
+)
+
+func SetProductStatusHandler(w http.ResponseWriter, r *http.Request) {
+	var request models.ProductStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	setProductStatus(w, r, request.Status)
+}
+
+// ArchiveProductHandler hides a product from the public without deleting it.
+func ArchiveProductHandler(w http.ResponseWriter, r *http.Request) {
+	setProductStatus(w, r, models.StatusArchived)
+}
+
+func setProductStatus(w http.ResponseWriter, r *http.Request, status string) {
+	productID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	product, err := database.SetProductStatus(productID, status)
+	if err == sql.ErrNoRows {
+		utils.SendJSONError(w, "product not found", http.StatusNotFound)
+		return
+	} else if err != nil && sendConstraintError(w, err) {
+		return
+	} else if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(product)
+}
+
+// visibleStatuses returns the statuses of products the request may see by ID:
+// active ones for the public and all for authorized users, which is nil.
+func visibleStatuses(r *http.Request) []string {
+	if middlewares.Authenticated(r) {
+		return nil
+	}
+	return []string{models.StatusActive}
+}
+
+// statusFilter reads the repeatable ?status= query parameter of listings.
+// Authorized users see drafts and active products unless they ask for other
+// statuses; the public only ever sees active products. On failure it answers
+// with 400 and returns false.
+func statusFilter(w http.ResponseWriter, r *http.Request) ([]string, bool) {
+	if !middlewares.Authenticated(r) {
+		return []string{models.StatusActive}, true
+	}
+
+	statuses := r.URL.Query()["status"]
+	if len(statuses) == 0 {
+		return []string{models.StatusDraft, models.StatusActive}, true
+	}
+	for _, status := range statuses {
+		if !database.ValidStatus(status) {
+			utils.SendJSONError(w, "Unknown status "+status+", use draft, active or archived", http.StatusBadRequest)
+			return nil, false
+		}
+	}
+	return statuses, true
+}
+
+// productVisible answers with 404 and returns false when the product doesn't
+// exist or the request may not see it.
+func productVisible(w http.ResponseWriter, r *http.Request, productID int) bool {
+	err := database.ProductVisible(productID, visibleStatuses(r))
+	if err == sql.ErrNoRows {
+		utils.SendJSONError(w, "product not found", http.StatusNotFound)
+		return false
+	} else if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/say8hi/go-api-test/internal/database"
+	"github.com/say8hi/go-api-test/internal/models"
+	"github.com/say8hi/go-api-test/internal/utils"
+)
+
+// defaultLowStockThreshold is used by the low stock report when no threshold
+// is given.
+const defaultLowStockThreshold = 5
+
+func GetProductStockHandler(w http.ResponseWriter, r *http.Request) {
+	productID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	if !productVisible(w, r, productID) {
+		return
+	}
+
+	stock, err := database.GetProductStock(productID)
+	if err == sql.ErrNoRows {
+		utils.SendJSONError(w, "product not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(stock)
+}
+
+func AdjustStockHandler(w http.ResponseWriter, r *http.Request) {
+	productID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	var request models.StockAdjustmentRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	level, err := database.AdjustStock(productID, request)
+	if err == sql.ErrNoRows {
+		utils.SendJSONError(w, "product not found", http.StatusNotFound)
+		return
+	} else if err != nil && sendConstraintError(w, err) {
+		return
+	} else if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(level)
+}
+
+func ReserveStockHandler(w http.ResponseWriter, r *http.Request) {
+	productID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	var request models.ReserveStockRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	reservation, err := database.ReserveStock(productID, request)
+	if err == sql.ErrNoRows {
+		utils.SendJSONError(w, "product not found", http.StatusNotFound)
+		return
+	} else if err != nil && sendConstraintError(w, err) {
+		return
+	} else if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(reservation)
+}
+
+func GetReservationHandler(w http.ResponseWriter, r *http.Request) {
+	reservationID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	reservation, err := database.GetReservation(reservationID)
+	if err == sql.ErrNoRows {
+		utils.SendJSONError(w, "reservation not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(reservation)
+}
+
+func CommitReservationHandler(w http.ResponseWriter, r *http.Request) {
+	finishReservation(w, r, database.CommitReservation)
+}
+
+func ReleaseReservationHandler(w http.ResponseWriter, r *http.Request) {
+	finishReservation(w, r, database.ReleaseReservation)
+}
+
+func finishReservation(w http.ResponseWriter, r *http.Request, finish func(int) (models.StockReservation, error)) {
+	reservationID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	reservation, err := finish(reservationID)
+	if err == sql.ErrNoRows {
+		utils.SendJSONError(w, "reservation not found", http.StatusNotFound)
+		return
+	} else if err != nil && sendConstraintError(w, err) {
+		return
+	} else if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(reservation)
+}
+
+func GetLowStockHandler(w http.ResponseWriter, r *http.Request) {
+	threshold := defaultLowStockThreshold
+	if value := r.URL.Query().Get("threshold"); value != "" {
+		var err error
+		threshold, err = strconv.Atoi(value)
+		if err != nil || threshold < 0 {
+			utils.SendJSONError(w, "Invalid threshold value", http.StatusBadRequest)
+			return
+		}
+	}
+
+	items, err := database.GetLowStock(threshold)
+	if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(items)
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/say8hi/go-api-test/internal/database"
+	"github.com/say8hi/go-api-test/internal/models"
+	"github.com/say8hi/go-api-test/internal/utils"
+)
+
+func GetTagsHandler(w http.ResponseWriter, r *http.Request) {
+	statuses, ok := statusFilter(w, r)
+	if !ok {
+		return
+	}
+
+	tags, err := database.GetTagCounts(statuses)
+	if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(tags)
+}
+
+func GetProductsByTagHandler(w http.ResponseWriter, r *http.Request) {
+	var filter models.ProductFilter
+	var ok bool
+	if filter.Statuses, ok = statusFilter(w, r); !ok {
+		return
+	}
+
+	products, err := database.GetProductsByTag(mux.Vars(r)["tag"], filter)
+	if err != nil && sendConstraintError(w, err) {
+		return
+	} else if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if !presentProducts(w, r, products) {
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(products)
+}
+
+func GetProductTagsHandler(w http.ResponseWriter, r *http.Request) {
+	productID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	if !productVisible(w, r, productID) {
+		return
+	}
+
+	tags, err := database.GetProductTags(productID)
+	if err == sql.ErrNoRows {
+		utils.SendJSONError(w, "product not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(tags)
+}
+
+func TagProductHandler(w http.ResponseWriter, r *http.Request) {
+	productID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	var request models.TagProductRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tags, err := database.TagProduct(productID, request.Tags)
+	if err == sql.ErrNoRows {
+		utils.SendJSONError(w, "product not found", http.StatusNotFound)
+		return
+	} else if err != nil && sendConstraintError(w, err) {
+		return
+	} else if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(tags)
+}
+
+func UntagProductHandler(w http.ResponseWriter, r *http.Request) {
+	productID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	err := database.UntagProduct(productID, mux.Vars(r)["tag"])
+	if err == sql.ErrNoRows {
+		utils.SendJSONError(w, "tag not found", http.StatusNotFound)
+		return
+	} else if err != nil && sendConstraintError(w, err) {
+		return
+	} else if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.GeneralResponse{Status: "success", Message: "Tag removed successfully"})
+}
+
+// tagFilter reads the repeatable ?tag= query parameter. On failure it answers
+// with 400 and returns false.
+func tagFilter(w http.ResponseWriter, r *http.Request) ([]string, bool) {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, value := range r.URL.Query()["tag"] {
+		tag, err := database.NormalizeTag(value)
+		if err != nil {
+			utils.SendJSONError(w, "Invalid tag filter "+value, http.StatusBadRequest)
+			return nil, false
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	return tags, true
+}
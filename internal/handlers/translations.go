@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/say8hi/go-api-test/internal/database"
+	"github.com/say8hi/go-api-test/internal/locale"
+	"github.com/say8hi/go-api-test/internal/models"
+	"github.com/say8hi/go-api-test/internal/utils"
+)
+
+func GetProductTranslationsHandler(w http.ResponseWriter, r *http.Request) {
+	productID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	if !productVisible(w, r, productID) {
+		return
+	}
+
+	translations, err := database.GetProductTranslations(productID)
+	if err == sql.ErrNoRows {
+		utils.SendJSONError(w, "product not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(translations)
+}
+
+func SetProductTranslationHandler(w http.ResponseWriter, r *http.Request) {
+	productID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	var request models.TranslationRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	translation, err := database.SetProductTranslation(productID, mux.Vars(r)["locale"], request)
+	if err == sql.ErrNoRows {
+		utils.SendJSONError(w, "product not found", http.StatusNotFound)
+		return
+	} else if err != nil && sendConstraintError(w, err) {
+		return
+	} else if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(translation)
+}
+
+func DeleteProductTranslationHandler(w http.ResponseWriter, r *http.Request) {
+	productID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	err := database.DeleteProductTranslation(productID, mux.Vars(r)["locale"])
+	if err == sql.ErrNoRows {
+		utils.SendJSONError(w, "translation not found", http.StatusNotFound)
+		return
+	} else if err != nil && sendConstraintError(w, err) {
+		return
+	} else if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.GeneralResponse{Status: "success", Message: "Translation deleted successfully"})
+}
+
+func GetCategoryTranslationsHandler(w http.ResponseWriter, r *http.Request) {
+	categoryID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	translations, err := database.GetCategoryTranslations(categoryID)
+	if err == sql.ErrNoRows {
+		utils.SendJSONError(w, "category not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(translations)
+}
+
+func SetCategoryTranslationHandler(w http.ResponseWriter, r *http.Request) {
+	categoryID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	var request models.TranslationRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	translation, err := database.SetCategoryTranslation(categoryID, mux.Vars(r)["locale"], request)
+	if err == sql.ErrNoRows {
+		utils.SendJSONError(w, "category not found", http.StatusNotFound)
+		return
+	} else if err != nil && sendConstraintError(w, err) {
+		return
+	} else if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(translation)
+}
+
+func DeleteCategoryTranslationHandler(w http.ResponseWriter, r *http.Request) {
+	categoryID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	err := database.DeleteCategoryTranslation(categoryID, mux.Vars(r)["locale"])
+	if err == sql.ErrNoRows {
+		utils.SendJSONError(w, "translation not found", http.StatusNotFound)
+		return
+	} else if err != nil && sendConstraintError(w, err) {
+		return
+	} else if err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.GeneralResponse{Status: "success", Message: "Translation deleted successfully"})
+}
+
+// requestLocale negotiates the locale of a request from ?lang= and
+// Accept-Language, announces it in Content-Language and returns its fallback
+// chain.
+func requestLocale(w http.ResponseWriter, r *http.Request) []string {
+	lang := locale.Negotiate(r.URL.Query().Get("lang"), r.Header.Get("Accept-Language"))
+	w.Header().Set("Content-Language", lang)
+	w.Header().Add("Vary", "Accept-Language")
+	return locale.Chain(lang)
+}
+
+// presentCategories translates categories into the locale of the request. It
+// answers with an error and returns false when they can't be translated.
+func presentCategories(w http.ResponseWriter, r *http.Request, categories []*models.Category) bool {
+	if err := database.LocalizeCategories(categories, requestLocale(w, r)); err != nil {
+		utils.SendJSONError(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+// categoryRefs returns pointers to the elements of categories.
+func categoryRefs(categories []models.Category) []*models.Category {
+	refs := make([]*models.Category, len(categories))
+	for i := range categories {
+		refs[i] = &categories[i]
+	}
+	return refs
+}
+
+// treeCategories returns the categories of every node of a category tree.
+func treeCategories(nodes []*models.CategoryNode) []*models.Category {
+	var categories []*models.Category
+	for _, node := range nodes {
+		categories = append(categories, &node.Category)
+		categories = append(categories, treeCategories(node.Children)...)
+	}
+	return categories
+}
@@ -5,7 +5,6 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"net/http"
-	"strings"
 
 	"github.com/say8hi/go-api-test/internal/database"
 	"github.com/say8hi/go-api-test/internal/models"
@@ -26,8 +25,7 @@ func CreateUserHandler(w http.ResponseWriter, r *http.Request) {
   
   request_user.Password = string(hashedPassword)
   user, err := database.CreateUser(request_user)
-  if err != nil && strings.Contains(err.Error(), "duplicate key value violates unique constraint") {
-      utils.SendJSONError(w, "This username is already taken.", http.StatusBadRequest)
+  if err != nil && sendConstraintError(w, err) {
       return
   } else if err != nil{
       utils.SendJSONError(w, "Database error.", http.StatusInternalServerError)
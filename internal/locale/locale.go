@@ -0,0 +1,129 @@
+// Package locale negotiates the language catalog content is served in.
+//
+// Products and categories are written in the default locale and may carry
+// translations into the other supported locales. A request asks for a locale
+// with ?lang= or Accept-Language and gets, field by field, the first content
+// found along the fallback chain of that locale.
+package locale
+
+import (
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const defaultLocales = "en,ru"
+
+// Supported returns the locales of CATALOG_LOCALES, a comma separated list
+// such as "en,ru". The first one is the default locale.
+func Supported() []string {
+	var locales []string
+	for _, tag := range strings.Split(os.Getenv("CATALOG_LOCALES"), ",") {
+		if tag = Normalize(tag); tag != "" {
+			locales = append(locales, tag)
+		}
+	}
+	if len(locales) == 0 {
+		return strings.Split(defaultLocales, ",")
+	}
+	return locales
+}
+
+// Default returns the locale products and categories are written in.
+func Default() string {
+	return Supported()[0]
+}
+
+// Normalize lowercases a language tag and uses hyphens as separators, so
+// "pt_BR" becomes "pt-br".
+func Normalize(tag string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(tag), "_", "-"))
+}
+
+// IsSupported reports whether locale, normalized, is supported.
+func IsSupported(locale string) bool {
+	locale = Normalize(locale)
+	for _, supported := range Supported() {
+		if supported == locale {
+			return true
+		}
+	}
+	return false
+}
+
+// Negotiate picks the locale of a request: lang when it is set and matches,
+// otherwise the best matching entry of the Accept-Language header, otherwise
+// the default locale. A tag matches a supported locale exactly or through its
+// language, so ru-RU matches ru.
+func Negotiate(lang, acceptLanguage string) string {
+	if locale, ok := match(lang); ok {
+		return locale
+	}
+
+	for _, tag := range parseAcceptLanguage(acceptLanguage) {
+		if locale, ok := match(tag); ok {
+			return locale
+		}
+	}
+	return Default()
+}
+
+// Chain returns the locales to look for content in, in order: locale, its
+// language when that is supported too, and the default locale.
+func Chain(locale string) []string {
+	chain := []string{locale}
+	if language, _, found := strings.Cut(locale, "-"); found && IsSupported(language) {
+		chain = append(chain, language)
+	}
+	if def := Default(); chain[len(chain)-1] != def && locale != def {
+		chain = append(chain, def)
+	}
+	return chain
+}
+
+func match(tag string) (string, bool) {
+	tag = Normalize(tag)
+	if tag == "" || tag == "*" {
+		return "", false
+	}
+	if IsSupported(tag) {
+		return tag, true
+	}
+	if language, _, found := strings.Cut(tag, "-"); found && IsSupported(language) {
+		return language, true
+	}
+	return "", false
+}
+
+// parseAcceptLanguage returns the tags of an Accept-Language header ordered by
+// quality. Tags with quality 0 are dropped.
+func parseAcceptLanguage(header string) []string {
+	type entry struct {
+		tag     string
+		quality float64
+	}
+
+	var entries []entry
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		quality := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			quality = parsed
+		}
+		if tag = strings.TrimSpace(tag); tag != "" && quality > 0 {
+			entries = append(entries, entry{tag, quality})
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].quality > entries[j].quality })
+	tags := make([]string, len(entries))
+	for i, e := range entries {
+		tags[i] = e.tag
+	}
+	return tags
+}
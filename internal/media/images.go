@@ -0,0 +1,160 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+const (
+	thumbnailSize = 320
+	maxPixels     = 40_000_000
+)
+
+var (
+	ErrTooLarge        = errors.New("file is too large")
+	ErrUnsupportedType = errors.New("only JPEG, PNG and GIF images are supported")
+	ErrInvalidImage    = errors.New("file is not a valid image")
+)
+
+var imageExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+// StoredImage is an uploaded image and its thumbnail after they were stored.
+type StoredImage struct {
+	Key          string
+	ThumbnailKey string
+	URL          string
+	ThumbnailURL string
+	ContentType  string
+	Width        int
+	Height       int
+	Size         int
+}
+
+// Keys returns the keys of every file of the image.
+func (i StoredImage) Keys() []string {
+	return []string{i.Key, i.ThumbnailKey}
+}
+
+// SaveImage checks that data is a supported image within the upload limit,
+// stores it under prefix with a thumbnail and returns where they were stored.
+// The content type is detected from data, not taken from the client.
+func SaveImage(prefix string, data []byte) (StoredImage, error) {
+	if int64(len(data)) > maxUploadBytes {
+		return StoredImage{}, ErrTooLarge
+	}
+
+	contentType := http.DetectContentType(data)
+	ext, ok := imageExtensions[contentType]
+	if !ok {
+		return StoredImage{}, ErrUnsupportedType
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || config.Width == 0 || config.Height == 0 {
+		return StoredImage{}, ErrInvalidImage
+	}
+	if config.Width*config.Height > maxPixels {
+		return StoredImage{}, fmt.Errorf("%w: at most %d pixels are allowed", ErrTooLarge, maxPixels)
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return StoredImage{}, ErrInvalidImage
+	}
+
+	// Thumbnails of JPEGs are JPEGs, all others are PNGs to keep transparency.
+	var thumbnail bytes.Buffer
+	thumbnailExt := ".png"
+	if contentType == "image/jpeg" {
+		thumbnailExt = ".jpg"
+		err = jpeg.Encode(&thumbnail, scaleDown(src, thumbnailSize), &jpeg.Options{Quality: 85})
+	} else {
+		err = png.Encode(&thumbnail, scaleDown(src, thumbnailSize))
+	}
+	if err != nil {
+		return StoredImage{}, fmt.Errorf("error encoding thumbnail: %w", err)
+	}
+
+	stored := StoredImage{
+		ContentType: contentType,
+		Width:       config.Width,
+		Height:      config.Height,
+		Size:        len(data),
+	}
+	if stored.Key, err = newKey(prefix, ext); err != nil {
+		return StoredImage{}, err
+	}
+	if stored.ThumbnailKey, err = newKey(prefix, "-thumb"+thumbnailExt); err != nil {
+		return StoredImage{}, err
+	}
+
+	if err := store.Put(stored.Key, bytes.NewReader(data)); err != nil {
+		return StoredImage{}, fmt.Errorf("error storing image: %w", err)
+	}
+	if err := store.Put(stored.ThumbnailKey, &thumbnail); err != nil {
+		Delete(stored.Key)
+		return StoredImage{}, fmt.Errorf("error storing thumbnail: %w", err)
+	}
+	stored.URL = store.URL(stored.Key)
+	stored.ThumbnailURL = store.URL(stored.ThumbnailKey)
+
+	return stored, nil
+}
+
+// scaleDown scales src down to fit into a size x size square, averaging the
+// source pixels that fall into every thumbnail pixel. Smaller images are
+// copied unscaled.
+func scaleDown(src image.Image, size int) image.Image {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	scaledWidth, scaledHeight := width, height
+	if width > size || height > size {
+		if width >= height {
+			scaledWidth, scaledHeight = size, max(1, height*size/width)
+		} else {
+			scaledWidth, scaledHeight = max(1, width*size/height), size
+		}
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, scaledWidth, scaledHeight))
+	for y := 0; y < scaledHeight; y++ {
+		y0, y1 := y*height/scaledHeight, max((y+1)*height/scaledHeight, y*height/scaledHeight+1)
+		for x := 0; x < scaledWidth; x++ {
+			x0, x1 := x*width/scaledWidth, max((x+1)*width/scaledWidth, x*width/scaledWidth+1)
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := src.At(bounds.Min.X+sx, bounds.Min.Y+sy).RGBA()
+					r, g, b, a = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa)
+					n++
+				}
+			}
+
+			// RGBA returns premultiplied values, NRGBA stores them
+			// unpremultiplied.
+			pixel := color.NRGBA{}
+			if a > 0 {
+				pixel = color.NRGBA{
+					R: uint8(r * 0xff / a),
+					G: uint8(g * 0xff / a),
+					B: uint8(b * 0xff / a),
+					A: uint8(a / n >> 8),
+				}
+			}
+			dst.SetNRGBA(x, y, pixel)
+		}
+	}
+	return dst
+}
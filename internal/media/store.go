@@ -0,0 +1,158 @@
+// Package media stores uploaded files and prepares product images.
+package media
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const defaultMaxUploadBytes = 5 << 20
+
+// Store keeps media files under slash-separated keys.
+type Store interface {
+	Put(key string, r io.Reader) error
+	Delete(key string) error
+	URL(key string) string
+}
+
+var (
+	store          Store
+	maxUploadBytes int64 = defaultMaxUploadBytes
+)
+
+// Init configures the store from MEDIA_STORE, local by default, and the upload
+// limit from MEDIA_MAX_UPLOAD_BYTES.
+func Init() {
+	switch kind := os.Getenv("MEDIA_STORE"); kind {
+	case "", "local":
+		dir := os.Getenv("MEDIA_DIR")
+		if dir == "" {
+			dir = "media"
+		}
+		baseURL := os.Getenv("MEDIA_BASE_URL")
+		if baseURL == "" {
+			baseURL = "/media"
+		}
+		store = &LocalStore{Dir: dir, BaseURL: baseURL}
+	default:
+		log.Fatalf("Unknown MEDIA_STORE %q", kind)
+	}
+
+	if value := os.Getenv("MEDIA_MAX_UPLOAD_BYTES"); value != "" {
+		limit, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || limit <= 0 {
+			log.Fatalf("Invalid MEDIA_MAX_UPLOAD_BYTES %q", value)
+		}
+		maxUploadBytes = limit
+	}
+}
+
+// MaxUploadBytes is the largest file that may be uploaded.
+func MaxUploadBytes() int64 {
+	return maxUploadBytes
+}
+
+// Handler serves the stored files when the store keeps them itself, and is
+// nil otherwise.
+func Handler() http.Handler {
+	handler, _ := store.(http.Handler)
+	return handler
+}
+
+// Delete removes stored files. Failures are logged, as the files are no longer
+// referenced.
+func Delete(keys ...string) {
+	for _, key := range keys {
+		if err := store.Delete(key); err != nil {
+			log.Printf("Error deleting media %s: %s", key, err)
+		}
+	}
+}
+
+// newKey returns a unique key under prefix with the given extension.
+func newKey(prefix, ext string) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return path.Join(prefix, hex.EncodeToString(b)+ext), nil
+}
+
+// LocalStore keeps files in Dir and serves them under BaseURL.
+type LocalStore struct {
+	Dir     string
+	BaseURL string
+}
+
+func (s *LocalStore) Put(key string, r io.Reader) error {
+	name, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+
+	// The file is written under a temporary name first, so it is never served
+	// half-written.
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+func (s *LocalStore) Delete(key string) error {
+	name, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(name); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *LocalStore) URL(key string) string {
+	return strings.TrimSuffix(s.BaseURL, "/") + "/" + key
+}
+
+// ServeHTTP serves the file named by the request path. Directories are not
+// listed.
+func (s *LocalStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasSuffix(r.URL.Path, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	http.FileServer(http.Dir(s.Dir)).ServeHTTP(w, r)
+}
+
+func (s *LocalStore) path(key string) (string, error) {
+	cleaned := path.Clean("/" + key)
+	if cleaned == "/" || cleaned != "/"+key {
+		return "", fmt.Errorf("invalid media key %q", key)
+	}
+	return filepath.Join(s.Dir, filepath.FromSlash(key)), nil
+}
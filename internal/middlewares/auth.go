@@ -1,16 +1,40 @@
 package middlewares
 
 import (
+	"context"
 	"database/sql"
 	"net/http"
+	"os"
 	"strings"
 
 	"github.com/say8hi/go-api-test/internal/database"
+	"github.com/say8hi/go-api-test/internal/models"
 	"github.com/say8hi/go-api-test/internal/utils"
 )
 
+type contextKey int
+
+const userKey contextKey = iota
+
+// UserFromContext returns the user authenticated for the request, if any.
+func UserFromContext(ctx context.Context) (models.UserInDatabase, bool) {
+	user, ok := ctx.Value(userKey).(models.UserInDatabase)
+	return user, ok
+}
+
+// Authenticated reports whether the request carries a valid token.
+func Authenticated(r *http.Request) bool {
+	_, ok := UserFromContext(r.Context())
+	return ok
+}
+
 func AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// OptionalAuthMiddleware already checked the token.
+		if Authenticated(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
 
 		receivedHash := r.Header.Get("Authorization")
 		if !strings.HasPrefix(receivedHash, "Bearer ") {
@@ -19,7 +43,7 @@ func AuthMiddleware(next http.Handler) http.Handler {
 		}
 
 		receivedHash = strings.TrimPrefix(receivedHash, "Bearer ")
-		_, err := database.GetUserByPasswordHash(receivedHash)
+		user, err := database.GetUserByPasswordHash(receivedHash)
 		if err == sql.ErrNoRows {
 			utils.SendJSONError(w, "Unauthorized", http.StatusConflict)
 			return
@@ -28,6 +52,52 @@ func AuthMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userKey, user)))
+	})
+}
+
+// OptionalAuthMiddleware authenticates requests that carry a valid token and
+// lets every other request through anonymously, so public endpoints can show
+// more to authorized users.
+func OptionalAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receivedHash, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		user, err := database.GetUserByPasswordHash(receivedHash)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userKey, user)))
+	})
+}
+
+// IsAdmin reports whether user is listed in ADMIN_USERNAMES, a comma separated
+// list of the users allowed to moderate.
+func IsAdmin(user models.UserInDatabase) bool {
+	for _, username := range strings.Split(os.Getenv("ADMIN_USERNAMES"), ",") {
+		if username = strings.TrimSpace(username); username != "" && username == user.Username {
+			return true
+		}
+	}
+	return false
+}
+
+// AdminMiddleware answers 403 to users who aren't admins. It must run after
+// AuthMiddleware.
+func AdminMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := UserFromContext(r.Context())
+		if !ok || !IsAdmin(user) {
+			utils.SendJSONError(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
 		next.ServeHTTP(w, r)
 	})
 }
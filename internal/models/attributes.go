@@ -0,0 +1,37 @@
+package models
+
+const (
+	AttributeString  = "string"
+	AttributeNumber  = "number"
+	AttributeBoolean = "boolean"
+)
+
+// Attributes are the attribute values of a product keyed by attribute name.
+// Values are JSON strings, numbers or booleans.
+type Attributes map[string]interface{}
+
+// AttributeDefinition is an attribute that products of a category, or of its
+// subcategories, may or must have. AllowedValues, when set, lists every value
+// the attribute may take.
+type AttributeDefinition struct {
+	ID            int           `json:"id"`
+	CategoryID    int           `json:"category_id"`
+	Name          string        `json:"name"`
+	Type          string        `json:"type"`
+	Required      bool          `json:"required"`
+	AllowedValues []interface{} `json:"allowed_values,omitempty"`
+}
+
+type CreateAttributeRequest struct {
+	Name          string        `json:"name"`
+	Type          string        `json:"type"`
+	Required      bool          `json:"required"`
+	AllowedValues []interface{} `json:"allowed_values,omitempty"`
+}
+
+// AttributeUpdateRequest changes whether an attribute is required and its
+// allowed values. An empty allowed_values list allows every value.
+type AttributeUpdateRequest struct {
+	Required      *bool         `json:"required,omitempty"`
+	AllowedValues []interface{} `json:"allowed_values"`
+}
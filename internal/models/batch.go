@@ -0,0 +1,52 @@
+package models
+
+import "encoding/json"
+
+// Batch operations and the statuses of their results. Operations of an atomic
+// batch that succeeded are rolled back when another one fails.
+const (
+	BatchCreate = "create"
+	BatchUpdate = "update"
+	BatchDelete = "delete"
+
+	BatchCreated    = "created"
+	BatchUpdated    = "updated"
+	BatchDeleted    = "deleted"
+	BatchFailed     = "failed"
+	BatchRolledBack = "rolled_back"
+)
+
+// BatchOperation creates, updates or deletes one product. Product holds a
+// CreateProductRequest for creates and a ProductUpdateRequest for updates;
+// ID is the product to update or delete.
+type BatchOperation struct {
+	Op      string          `json:"op"`
+	ID      int             `json:"id,omitempty"`
+	Product json.RawMessage `json:"product,omitempty"`
+}
+
+// BatchRequest applies Operations in order. An atomic batch applies all of
+// them or none; otherwise every operation that succeeds is kept.
+type BatchRequest struct {
+	Atomic     bool             `json:"atomic"`
+	Operations []BatchOperation `json:"operations"`
+}
+
+// BatchResult is the outcome of the operation at Index.
+type BatchResult struct {
+	Index  int    `json:"index"`
+	Op     string `json:"op"`
+	Status string `json:"status"`
+	ID     int    `json:"id,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// BatchReport tells whether a batch was committed and the outcome of every
+// operation.
+type BatchReport struct {
+	Atomic    bool          `json:"atomic"`
+	Committed bool          `json:"committed"`
+	Succeeded int           `json:"succeeded"`
+	Failed    int           `json:"failed"`
+	Results   []BatchResult `json:"results"`
+}
@@ -0,0 +1,48 @@
+package models
+
+import "github.com/say8hi/go-api-test/internal/money"
+
+// ProductRecord is one product in a bulk export or import. Categories are
+// referenced by name. Fields lists the columns or keys an imported record
+// has; an update leaves the others alone.
+type ProductRecord struct {
+	Row         int             `json:"-"`
+	Fields      map[string]bool `json:"-"`
+	ID          int             `json:"id,omitempty"`
+	ExternalID  string          `json:"external_id,omitempty"`
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Price       money.Amount    `json:"price"`
+	Currency    string          `json:"currency,omitempty"`
+	Categories  []string        `json:"categories"`
+	Attributes  Attributes      `json:"attributes,omitempty"`
+}
+
+type CategoryRecord struct {
+	Row         int             `json:"-"`
+	Fields      map[string]bool `json:"-"`
+	ID          int             `json:"id,omitempty"`
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+}
+
+const (
+	ImportCreated = "created"
+	ImportUpdated = "updated"
+	ImportFailed  = "failed"
+)
+
+type ImportRowResult struct {
+	Row    int    `json:"row"`
+	Status string `json:"status"`
+	ID     int    `json:"id,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+type ImportReport struct {
+	Total   int               `json:"total"`
+	Created int               `json:"created"`
+	Updated int               `json:"updated"`
+	Failed  int               `json:"failed"`
+	Rows    []ImportRowResult `json:"rows"`
+}
@@ -3,15 +3,48 @@ package models
 type Category struct {
 	ID          int    `json:"id"`
 	Name        string `json:"name"`
+	Slug        string `json:"slug"`
 	Description string `json:"description,omitempty"`
+	ParentID    *int   `json:"parent_id,omitempty"`
 }
 
+// CreateCategoryRequest creates a category. Without Slug one is generated
+// from the name.
 type CreateCategoryRequest struct {
 	Name        string `json:"name"`
+	Slug        string `json:"slug,omitempty"`
 	Description string `json:"description,omitempty"`
+	ParentID    *int   `json:"parent_id,omitempty"`
 }
 
+// CategoryUpdateRequest updates a category. Renaming keeps the slug; a new
+// Slug replaces it and the old one keeps redirecting.
 type CategoryUpdateRequest struct {
 	Name        *string `json:"name,omitempty"`
+	Slug        *string `json:"slug,omitempty"`
 	Description *string `json:"description,omitempty"`
 }
+
+// MoveCategoryRequest moves a category with its subtree under ParentID, or
+// to the top level when ParentID is null.
+type MoveCategoryRequest struct {
+	ParentID *int `json:"parent_id"`
+}
+
+// CategoryNode is a category with its subcategories.
+type CategoryNode struct {
+	Category
+	Children []*CategoryNode `json:"children"`
+}
+
+// ReorderCategoriesRequest lists every subcategory of ParentID, or every
+// top-level category when ParentID is null, in the new order.
+type ReorderCategoriesRequest struct {
+	ParentID    *int  `json:"parent_id"`
+	CategoryIDs []int `json:"category_ids"`
+}
+
+// ReorderProductsRequest lists every product of a category in the new order.
+type ReorderProductsRequest struct {
+	ProductIDs []int `json:"product_ids"`
+}
@@ -0,0 +1,21 @@
+package models
+
+// ProductImage is an uploaded image or, without a thumbnail, an image linked
+// by URL.
+type ProductImage struct {
+	ID           int    `json:"id"`
+	ProductID    int    `json:"product_id"`
+	URL          string `json:"url"`
+	ThumbnailURL string `json:"thumbnail_url,omitempty"`
+	ContentType  string `json:"content_type,omitempty"`
+	Width        int    `json:"width,omitempty"`
+	Height       int    `json:"height,omitempty"`
+	Size         int    `json:"size,omitempty"`
+	Position     int    `json:"position"`
+	Primary      bool   `json:"primary"`
+}
+
+// ReorderImagesRequest lists every image ID of a product in the new order.
+type ReorderImagesRequest struct {
+	ImageIDs []int `json:"image_ids"`
+}
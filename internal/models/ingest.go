@@ -0,0 +1,45 @@
+package models
+
+import "github.com/say8hi/go-api-test/internal/money"
+
+// IngestProduct is a product sent by the datacollector. Fields it doesn't
+// send are nil and never overwrite the catalog. Images are URLs of images
+// hosted by the source. Images and tags are only ever added. Status is a
+// product status; new products without one are active.
+type IngestProduct struct {
+	Name        string        `json:"name"`
+	Description *string       `json:"description,omitempty"`
+	Price       *money.Amount `json:"price,omitempty"`
+	Currency    string        `json:"currency,omitempty"`
+	Status      string        `json:"status,omitempty"`
+	Categories  []Category    `json:"categories"`
+	Images      []string      `json:"images,omitempty"`
+	Tags        []string      `json:"tags,omitempty"`
+}
+
+const (
+	IngestInserted  = "inserted"
+	IngestUpdated   = "updated"
+	IngestUnchanged = "unchanged"
+	IngestSkipped   = "skipped"
+)
+
+type IngestReport struct {
+	Inserted  int `json:"inserted"`
+	Updated   int `json:"updated"`
+	Unchanged int `json:"unchanged"`
+	Skipped   int `json:"skipped"`
+}
+
+func (r *IngestReport) Add(outcome string) {
+	switch outcome {
+	case IngestInserted:
+		r.Inserted++
+	case IngestUpdated:
+		r.Updated++
+	case IngestUnchanged:
+		r.Unchanged++
+	default:
+		r.Skipped++
+	}
+}
@@ -0,0 +1,79 @@
+package models
+
+import (
+	"time"
+
+	"github.com/say8hi/go-api-test/internal/money"
+)
+
+// CartItem is a product, or a variant of it, in the cart of a user. It keeps
+// the price the product had when it was added, promotions included.
+type CartItem struct {
+	ID          int          `json:"id"`
+	ProductID   int          `json:"product_id"`
+	VariantID   *int         `json:"variant_id,omitempty"`
+	ProductName string       `json:"product_name"`
+	SKU         string       `json:"sku,omitempty"`
+	Quantity    int          `json:"quantity"`
+	UnitPrice   money.Amount `json:"unit_price"`
+	LineTotal   money.Amount `json:"line_total"`
+	AddedAt     time.Time    `json:"added_at"`
+}
+
+// Cart is the cart of a user. All items share one currency.
+type Cart struct {
+	Items    []CartItem   `json:"items"`
+	Currency string       `json:"currency,omitempty"`
+	Total    money.Amount `json:"total"`
+}
+
+// AddCartItemRequest adds Quantity of a product or variant to the cart. When
+// the cart already holds it, the quantities add up.
+type AddCartItemRequest struct {
+	ProductID int  `json:"product_id"`
+	VariantID *int `json:"variant_id,omitempty"`
+	Quantity  int  `json:"quantity"`
+}
+
+// CartItemUpdateRequest changes the quantity of a cart item.
+type CartItemUpdateRequest struct {
+	Quantity int `json:"quantity"`
+}
+
+// Order statuses. Orders are placed at checkout, paid, shipped and delivered,
+// and may be cancelled until they are shipped.
+const (
+	OrderPlaced    = "placed"
+	OrderPaid      = "paid"
+	OrderShipped   = "shipped"
+	OrderDelivered = "delivered"
+	OrderCancelled = "cancelled"
+)
+
+type Order struct {
+	ID              int          `json:"id"`
+	UserID          int          `json:"user_id"`
+	Status          string       `json:"status"`
+	Currency        string       `json:"currency"`
+	Total           money.Amount `json:"total"`
+	Items           []OrderItem  `json:"items"`
+	CreatedAt       time.Time    `json:"created_at"`
+	StatusUpdatedAt time.Time    `json:"status_updated_at"`
+}
+
+// OrderItem is a copy of a cart item taken at checkout. ProductID and
+// VariantID are nil once the product or variant is deleted.
+type OrderItem struct {
+	ProductID   *int         `json:"product_id"`
+	VariantID   *int         `json:"variant_id,omitempty"`
+	ProductName string       `json:"product_name"`
+	SKU         string       `json:"sku,omitempty"`
+	Quantity    int          `json:"quantity"`
+	UnitPrice   money.Amount `json:"unit_price"`
+	LineTotal   money.Amount `json:"line_total"`
+}
+
+// OrderStatusRequest moves an order to another status.
+type OrderStatusRequest struct {
+	Status string `json:"status"`
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	AggregateProduct  = "product"
+	AggregateCategory = "category"
+
+	EventProductCreated  = "product.created"
+	EventProductUpdated  = "product.updated"
+	EventProductDeleted  = "product.deleted"
+	EventCategoryCreated = "category.created"
+	EventCategoryUpdated = "category.updated"
+	EventCategoryDeleted = "category.deleted"
+)
+
+type OutboxEvent struct {
+	ID            int64           `json:"id"`
+	AggregateType string          `json:"aggregate_type"`
+	AggregateID   int             `json:"aggregate_id"`
+	EventType     string          `json:"type"`
+	Payload       json.RawMessage `json:"data"`
+	Attempts      int             `json:"-"`
+	CreatedAt     time.Time       `json:"occurred_at"`
+}
+
+type DeletedEntity struct {
+	ID int `json:"id"`
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"github.com/say8hi/go-api-test/internal/money"
+)
+
+type ProductPrice struct {
+	Currency string       `json:"currency"`
+	Amount   money.Amount `json:"amount"`
+}
+
+type SetProductPriceRequest struct {
+	Amount money.Amount `json:"amount"`
+}
+
+// PriceConversion is attached to a product whose price was converted from
+// another currency because it has no explicit price in the requested one.
+type PriceConversion struct {
+	FromCurrency string       `json:"from_currency"`
+	FromPrice    money.Amount `json:"from_price"`
+	Rate         money.Rate   `json:"rate"`
+}
+
+type ExchangeRate struct {
+	Base      string     `json:"base"`
+	Quote     string     `json:"quote"`
+	Rate      money.Rate `json:"rate"`
+	UpdatedAt time.Time  `json:"updated_at,omitempty"`
+}
+
+type SetExchangeRateRequest struct {
+	Rate money.Rate `json:"rate"`
+}
+
+type ImportResult struct {
+	Imported int `json:"imported"`
+}
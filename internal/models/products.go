@@ -1,23 +1,79 @@
 package models
 
+import "github.com/say8hi/go-api-test/internal/money"
+
 type Product struct {
-	ID          int        `json:"id"`
-	Name        string     `json:"name"`
-	Description string     `json:"description"`
-	Price       float64    `json:"price"`
-	Categories  []Category `json:"categories"`
+	ID             int                `json:"id"`
+	ExternalID     string             `json:"external_id,omitempty"`
+	Name           string             `json:"name"`
+	Slug           string             `json:"slug"`
+	Description    string             `json:"description"`
+	Price          money.Amount       `json:"price"`
+	Currency       string             `json:"currency"`
+	EffectivePrice *money.Amount      `json:"effective_price,omitempty"`
+	Promotions     []AppliedPromotion `json:"promotions,omitempty"`
+	Status         string             `json:"status"`
+	Conversion     *PriceConversion   `json:"conversion,omitempty"`
+	Categories     []Category         `json:"categories"`
+	Variants       []ProductVariant   `json:"variants,omitempty"`
+	Stock          *StockLevel        `json:"stock,omitempty"`
+	Images         []ProductImage     `json:"images,omitempty"`
+	Attributes     Attributes         `json:"attributes,omitempty"`
+	Tags           []string           `json:"tags,omitempty"`
+	Rating         *float64           `json:"rating"`
+	ReviewCount    int                `json:"review_count"`
+}
+
+// Product statuses. Only active products are shown to the public.
+const (
+	StatusDraft    = "draft"
+	StatusActive   = "active"
+	StatusArchived = "archived"
+)
+
+// ProductFilter narrows a product listing. Products without stock tracking
+// count as in stock. Attributes match products having one of the listed
+// values for every attribute, compared as text, and Tags match products
+// carrying every listed tag. Statuses, when set, lists the statuses to
+// include.
+type ProductFilter struct {
+	IncludeDescendants bool
+	InStockOnly        bool
+	Attributes         map[string][]string
+	Tags               []string
+	Statuses           []string
 }
 
+// CreateProductRequest creates a product. Without Slug one is generated from
+// the name.
 type CreateProductRequest struct {
-	Name        string   `json:"name"`
-	Description string   `json:"description"`
-	Price       float64  `json:"price"`
-	Categories  []string `json:"categories"`
+	ExternalID  string       `json:"external_id,omitempty"`
+	Name        string       `json:"name"`
+	Slug        string       `json:"slug,omitempty"`
+	Description string       `json:"description"`
+	Price       money.Amount `json:"price"`
+	Currency    string       `json:"currency,omitempty"`
+	Status      string       `json:"status,omitempty"`
+	Categories  []string     `json:"categories"`
+	Attributes  Attributes   `json:"attributes,omitempty"`
+	Tags        []string     `json:"tags,omitempty"`
 }
 
+// ProductUpdateRequest replaces the attributes of a product when Attributes
+// is set. Renaming keeps the slug; a new Slug replaces it and the old one
+// keeps redirecting.
 type ProductUpdateRequest struct {
-	Name        *string  `json:"name,omitempty"`
-	Description *string  `json:"description,omitempty"`
-	Price       *float64 `json:"price,omitempty"`
-	Categories  []string `json:"categories,omitempty"`
+	ExternalID  *string       `json:"external_id,omitempty"`
+	Name        *string       `json:"name,omitempty"`
+	Slug        *string       `json:"slug,omitempty"`
+	Description *string       `json:"description,omitempty"`
+	Price       *money.Amount `json:"price,omitempty"`
+	Currency    *string       `json:"currency,omitempty"`
+	Categories  []string      `json:"categories,omitempty"`
+	Attributes  Attributes    `json:"attributes,omitempty"`
+}
+
+// ProductStatusRequest moves a product to another status.
+type ProductStatusRequest struct {
+	Status string `json:"status"`
 }
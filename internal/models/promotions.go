@@ -0,0 +1,67 @@
+package models
+
+import (
+	"time"
+
+	"github.com/say8hi/go-api-test/internal/money"
+)
+
+// Promotion kinds. A percentage promotion takes Value percent off the price;
+// a fixed one takes Value off prices in its currency.
+const (
+	PromotionPercentage = "percentage"
+	PromotionFixed      = "fixed"
+)
+
+// Promotion scopes: every product, the products of a category and its
+// subcategories, or a single product.
+const (
+	PromotionScopeCatalog  = "catalog"
+	PromotionScopeCategory = "category"
+	PromotionScopeProduct  = "product"
+)
+
+// Promotion discounts the products in its scope between StartsAt and EndsAt;
+// either end may be open. Stackable promotions combine with each other in
+// Priority order, the others apply alone.
+type Promotion struct {
+	ID         int          `json:"id"`
+	Name       string       `json:"name"`
+	Kind       string       `json:"kind"`
+	Value      money.Amount `json:"value"`
+	Currency   string       `json:"currency,omitempty"`
+	Scope      string       `json:"scope"`
+	CategoryID *int         `json:"category_id,omitempty"`
+	ProductID  *int         `json:"product_id,omitempty"`
+	StartsAt   *time.Time   `json:"starts_at,omitempty"`
+	EndsAt     *time.Time   `json:"ends_at,omitempty"`
+	Stackable  bool         `json:"stackable"`
+	Priority   int          `json:"priority"`
+	CreatedAt  time.Time    `json:"created_at"`
+}
+
+// PromotionRequest creates or replaces a promotion. A fixed promotion without
+// Currency is in the catalog currency.
+type PromotionRequest struct {
+	Name       string       `json:"name"`
+	Kind       string       `json:"kind"`
+	Value      money.Amount `json:"value"`
+	Currency   string       `json:"currency,omitempty"`
+	Scope      string       `json:"scope"`
+	CategoryID *int         `json:"category_id,omitempty"`
+	ProductID  *int         `json:"product_id,omitempty"`
+	StartsAt   *time.Time   `json:"starts_at,omitempty"`
+	EndsAt     *time.Time   `json:"ends_at,omitempty"`
+	Stackable  bool         `json:"stackable"`
+	Priority   int          `json:"priority"`
+}
+
+// AppliedPromotion is a promotion that lowered the price of a product, with
+// the amount it took off.
+type AppliedPromotion struct {
+	ID       int          `json:"id"`
+	Name     string       `json:"name"`
+	Kind     string       `json:"kind"`
+	Value    money.Amount `json:"value"`
+	Discount money.Amount `json:"discount"`
+}
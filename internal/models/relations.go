@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// Relation types of related products. Manual links have one of the first
+// three; RelationRecommended marks products picked automatically.
+const (
+	RelationAccessory   = "accessory"
+	RelationSimilar     = "similar"
+	RelationReplacement = "replacement"
+	RelationRecommended = "recommended"
+)
+
+// ProductRelation links a product to a related one. Links are one-way: an
+// accessory of a product doesn't list the product back.
+type ProductRelation struct {
+	ProductID int       `json:"product_id"`
+	RelatedID int       `json:"related_id"`
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ProductRelationRequest creates or changes the link to a related product.
+type ProductRelationRequest struct {
+	Type string `json:"type"`
+}
+
+// RelatedProduct is a product shown next to another one.
+type RelatedProduct struct {
+	Relation string  `json:"relation"`
+	Product  Product `json:"product"`
+}
+
+// RelatedFilter narrows the related products of a product. With Type set only
+// manual links of that type are listed; otherwise recommendations fill the
+// list up to Limit. Statuses, when set, lists the statuses to include.
+type RelatedFilter struct {
+	Type     string
+	Statuses []string
+	Limit    int
+}
@@ -0,0 +1,50 @@
+package models
+
+import "time"
+
+// Review statuses. Only approved reviews are public and count towards the
+// rating of a product.
+const (
+	ReviewPending  = "pending"
+	ReviewApproved = "approved"
+	ReviewRejected = "rejected"
+)
+
+type Review struct {
+	ID        int       `json:"id"`
+	ProductID int       `json:"product_id"`
+	UserID    int       `json:"user_id"`
+	Username  string    `json:"username"`
+	Rating    int       `json:"rating"`
+	Text      string    `json:"text"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ReviewRequest creates or replaces the review of the current user.
+type ReviewRequest struct {
+	Rating int    `json:"rating"`
+	Text   string `json:"text"`
+}
+
+// ReviewStatusRequest moderates a review.
+type ReviewStatusRequest struct {
+	Status string `json:"status"`
+}
+
+// ReviewFilter narrows a review listing. Sort is one of the ReviewSort
+// values.
+type ReviewFilter struct {
+	ProductID int
+	Statuses  []string
+	Sort      string
+}
+
+// Review listing orders.
+const (
+	ReviewSortNewest  = "newest"
+	ReviewSortOldest  = "oldest"
+	ReviewSortHighest = "highest"
+	ReviewSortLowest  = "lowest"
+)
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Scheduled change statuses. A pending change is applied by the scheduler
+// once it is due, or fails if the product rejects it, unless it is cancelled
+// first.
+const (
+	ChangePending   = "pending"
+	ChangeApplied   = "applied"
+	ChangeFailed    = "failed"
+	ChangeCancelled = "cancelled"
+)
+
+// ScheduledFields are the product fields a scheduled change sets: those of a
+// product update, and the status the product moves to.
+type ScheduledFields struct {
+	ProductUpdateRequest
+	Status *string `json:"status,omitempty"`
+}
+
+// ScheduledChange holds field values a product takes at EffectiveAt. Changes
+// are kept as they were requested, in the shape of ScheduledFields. Error
+// tells why a failed change couldn't be applied.
+type ScheduledChange struct {
+	ID              int             `json:"id"`
+	ProductID       int             `json:"product_id"`
+	Changes         json.RawMessage `json:"changes"`
+	EffectiveAt     time.Time       `json:"effective_at"`
+	Status          string          `json:"status"`
+	Error           string          `json:"error,omitempty"`
+	CreatedBy       *int            `json:"created_by,omitempty"`
+	CreatedAt       time.Time       `json:"created_at"`
+	StatusUpdatedAt time.Time       `json:"status_updated_at"`
+}
+
+// ScheduledChangeRequest schedules Changes, in the shape of ScheduledFields,
+// for EffectiveAt.
+type ScheduledChangeRequest struct {
+	EffectiveAt time.Time       `json:"effective_at"`
+	Changes     json.RawMessage `json:"changes"`
+}
+
+// ScheduledChangeFilter narrows a listing of scheduled changes. ProductID,
+// when not zero, keeps the changes of one product and Statuses, when set,
+// those with one of the statuses.
+type ScheduledChangeFilter struct {
+	ProductID int
+	Statuses  []string
+}
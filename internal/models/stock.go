@@ -0,0 +1,51 @@
+package models
+
+import "time"
+
+// StockLevel is the stock of a product or a variant. Available is what can
+// still be reserved or sold.
+type StockLevel struct {
+	VariantID *int `json:"variant_id,omitempty"`
+	OnHand    int  `json:"on_hand"`
+	Reserved  int  `json:"reserved"`
+	Available int  `json:"available"`
+}
+
+// StockAdjustmentRequest changes the stock of a product, or of one of its
+// variants, by Delta.
+type StockAdjustmentRequest struct {
+	VariantID *int   `json:"variant_id,omitempty"`
+	Delta     int    `json:"delta"`
+	Reason    string `json:"reason"`
+}
+
+const (
+	ReservationActive    = "active"
+	ReservationCommitted = "committed"
+	ReservationReleased  = "released"
+	ReservationExpired   = "expired"
+)
+
+type StockReservation struct {
+	ID        int       `json:"id"`
+	ProductID int       `json:"product_id"`
+	VariantID *int      `json:"variant_id,omitempty"`
+	Quantity  int       `json:"quantity"`
+	Status    string    `json:"status"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// ReserveStockRequest holds Quantity for TTLSeconds, 15 minutes by default.
+type ReserveStockRequest struct {
+	VariantID  *int `json:"variant_id,omitempty"`
+	Quantity   int  `json:"quantity"`
+	TTLSeconds int  `json:"ttl_seconds,omitempty"`
+}
+
+// LowStockItem is a stock level at or below the requested threshold.
+type LowStockItem struct {
+	ProductID   int    `json:"product_id"`
+	ProductName string `json:"product_name"`
+	SKU         string `json:"sku,omitempty"`
+	StockLevel
+}
@@ -0,0 +1,12 @@
+package models
+
+// TagCount is a tag with the number of products carrying it.
+type TagCount struct {
+	Name     string `json:"name"`
+	Products int    `json:"products"`
+}
+
+// TagProductRequest lists tags to add to a product. Missing tags are created.
+type TagProductRequest struct {
+	Tags []string `json:"tags"`
+}
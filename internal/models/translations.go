@@ -0,0 +1,16 @@
+package models
+
+// Translation is the name and description of a product or category in a
+// locale other than the default one. Without Description the description
+// falls back along the locale chain.
+type Translation struct {
+	Locale      string  `json:"locale"`
+	Name        string  `json:"name"`
+	Description *string `json:"description,omitempty"`
+}
+
+// TranslationRequest creates or replaces a translation.
+type TranslationRequest struct {
+	Name        string  `json:"name"`
+	Description *string `json:"description,omitempty"`
+}
@@ -0,0 +1,35 @@
+package models
+
+import "github.com/say8hi/go-api-test/internal/money"
+
+// ProductVariant is a sellable version of a product, e.g. a size and color of
+// a T-shirt. A variant without its own price is sold at the product price; its
+// price is always in the currency of the product, and so is EffectivePrice,
+// its own price once promotions apply.
+type ProductVariant struct {
+	ID             int               `json:"id"`
+	ProductID      int               `json:"product_id"`
+	SKU            string            `json:"sku"`
+	Options        map[string]string `json:"options"`
+	Price          *money.Amount     `json:"price,omitempty"`
+	EffectivePrice *money.Amount     `json:"effective_price,omitempty"`
+	Available      bool              `json:"available"`
+	Stock          *StockLevel       `json:"stock,omitempty"`
+}
+
+type CreateVariantRequest struct {
+	SKU       string            `json:"sku"`
+	Options   map[string]string `json:"options"`
+	Price     *money.Amount     `json:"price,omitempty"`
+	Available *bool             `json:"available,omitempty"`
+}
+
+// VariantUpdateRequest changes the given fields. InheritPrice removes the
+// variant's own price.
+type VariantUpdateRequest struct {
+	SKU          *string           `json:"sku,omitempty"`
+	Options      map[string]string `json:"options,omitempty"`
+	Price        *money.Amount     `json:"price,omitempty"`
+	InheritPrice bool              `json:"inherit_price,omitempty"`
+	Available    *bool             `json:"available,omitempty"`
+}
@@ -0,0 +1,224 @@
+package money
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Amount is an exact amount of money in ten-thousandths of a currency unit.
+// It is stored in NUMERIC(19,4) columns and serialized as a decimal string.
+type Amount int64
+
+const (
+	scale = 4
+	unit  = 10000
+
+	// maxIntegerDigits keeps parsed amounts inside int64 and NUMERIC(19,4).
+	maxIntegerDigits = 14
+)
+
+var (
+	ErrInvalidAmount   = errors.New("invalid amount")
+	ErrUnknownCurrency = errors.New("unknown currency")
+	ErrTooPrecise      = errors.New("amount has more decimal places than the currency allows")
+)
+
+// Parse reads a decimal such as "9.99", "-1.5" or "10". Exponents and more
+// than four decimal places are rejected.
+func Parse(s string) (Amount, error) {
+	s = strings.TrimSpace(s)
+	negative := false
+	if strings.HasPrefix(s, "-") || strings.HasPrefix(s, "+") {
+		negative = s[0] == '-'
+		s = s[1:]
+	}
+
+	integer, fraction, hasPoint := strings.Cut(s, ".")
+	if integer == "" && fraction == "" || hasPoint && fraction == "" {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+	if len(integer) > maxIntegerDigits || len(fraction) > scale {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+
+	var value int64
+	for _, digits := range []string{integer, fraction + strings.Repeat("0", scale-len(fraction))} {
+		for _, r := range digits {
+			if r < '0' || r > '9' {
+				return 0, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+			}
+			value = value*10 + int64(r-'0')
+		}
+	}
+
+	if negative {
+		value = -value
+	}
+	return Amount(value), nil
+}
+
+// MustParse is like Parse but panics on invalid input.
+func MustParse(s string) Amount {
+	a, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
+
+// String formats the amount with at least two decimal places.
+func (a Amount) String() string {
+	value := int64(a)
+	sign := ""
+	if value < 0 {
+		sign = "-"
+		value = -value
+	}
+
+	fraction := fmt.Sprintf("%04d", value%unit)
+	fraction = strings.TrimRight(fraction, "0")
+	for len(fraction) < 2 {
+		fraction += "0"
+	}
+
+	return fmt.Sprintf("%s%d.%s", sign, value/unit, fraction)
+}
+
+// Decimals returns the number of significant decimal places.
+func (a Amount) Decimals() int {
+	value := int64(a)
+	if value < 0 {
+		value = -value
+	}
+	decimals := scale
+	for decimals > 0 && value%10 == 0 {
+		value /= 10
+		decimals--
+	}
+	return decimals
+}
+
+// Round rounds the amount half away from zero to the minor unit of currency.
+func (a Amount) Round(currency string) Amount {
+	step := int64(1)
+	for i := MinorUnits(currency); i < scale; i++ {
+		step *= 10
+	}
+
+	value := int64(a)
+	remainder := value % step
+	value -= remainder
+	if remainder*2 >= step {
+		value += step
+	} else if remainder*2 <= -step {
+		value -= step
+	}
+	return Amount(value)
+}
+
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.String())
+}
+
+// UnmarshalJSON accepts both strings and JSON numbers. Numbers are read from
+// their literal text, so no float rounding happens.
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+
+	text := string(data)
+	if strings.HasPrefix(text, `"`) {
+		if err := json.Unmarshal(data, &text); err != nil {
+			return err
+		}
+	}
+
+	parsed, err := Parse(text)
+	if err != nil {
+		return err
+	}
+	*a = parsed
+	return nil
+}
+
+func (a *Amount) Scan(src interface{}) error {
+	switch src := src.(type) {
+	case []byte:
+		return a.scanString(string(src))
+	case string:
+		return a.scanString(src)
+	case int64:
+		*a = Amount(src * unit)
+		return nil
+	case nil:
+		*a = 0
+		return nil
+	}
+	return fmt.Errorf("money: cannot scan %T into Amount", src)
+}
+
+func (a *Amount) scanString(s string) error {
+	parsed, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*a = parsed
+	return nil
+}
+
+func (a Amount) Value() (driver.Value, error) {
+	return a.String(), nil
+}
+
+// currencies maps supported ISO 4217 codes to the number of digits of their
+// minor unit.
+var currencies = map[string]int{
+	"AED": 2, "AUD": 2, "BHD": 3, "BRL": 2, "BYN": 2, "CAD": 2, "CHF": 2,
+	"CNY": 2, "CZK": 2, "DKK": 2, "EUR": 2, "GBP": 2, "GEL": 2, "HKD": 2,
+	"HUF": 2, "IDR": 2, "ILS": 2, "INR": 2, "JPY": 0, "KGS": 2, "KRW": 0,
+	"KWD": 3, "KZT": 2, "MXN": 2, "NOK": 2, "NZD": 2, "PLN": 2, "RUB": 2,
+	"SEK": 2, "SGD": 2, "THB": 2, "TRY": 2, "UAH": 2, "USD": 2, "UZS": 2,
+	"ZAR": 2,
+}
+
+func ValidCurrency(code string) bool {
+	_, ok := currencies[code]
+	return ok
+}
+
+// MinorUnits returns the number of decimal places used by currency.
+func MinorUnits(currency string) int {
+	if digits, ok := currencies[currency]; ok {
+		return digits
+	}
+	return 2
+}
+
+// DefaultCurrency is the currency of prices that don't specify one, taken
+// from CATALOG_CURRENCY.
+func DefaultCurrency() string {
+	currency := strings.ToUpper(os.Getenv("CATALOG_CURRENCY"))
+	if ValidCurrency(currency) {
+		return currency
+	}
+	return "USD"
+}
+
+// Validate checks that currency is supported and that amount can be expressed
+// in its minor unit.
+func Validate(amount Amount, currency string) error {
+	if !ValidCurrency(currency) {
+		return fmt.Errorf("%w: %s", ErrUnknownCurrency, strconv.Quote(currency))
+	}
+	if amount.Decimals() > MinorUnits(currency) {
+		return fmt.Errorf("%w: %s %s", ErrTooPrecise, amount, currency)
+	}
+	return nil
+}
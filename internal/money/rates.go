@@ -0,0 +1,168 @@
+package money
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+var ErrInvalidRate = errors.New("invalid exchange rate")
+
+// Rate is an exchange rate: how many units of the quote currency one unit of
+// the base currency buys. It is exact and serialized as a decimal string.
+type Rate struct {
+	rat *big.Rat
+}
+
+// ParseRate reads a positive decimal such as "92.5" or "0.0108".
+func ParseRate(s string) (Rate, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || strings.ContainsAny(s, "eE/") {
+		return Rate{}, fmt.Errorf("%w: %q", ErrInvalidRate, s)
+	}
+
+	rat, ok := new(big.Rat).SetString(s)
+	if !ok || rat.Sign() <= 0 {
+		return Rate{}, fmt.Errorf("%w: %q", ErrInvalidRate, s)
+	}
+	return Rate{rat: rat}, nil
+}
+
+func (r Rate) IsZero() bool {
+	return r.rat == nil
+}
+
+func (r Rate) String() string {
+	if r.rat == nil {
+		return "0"
+	}
+	s := strings.TrimRight(r.rat.FloatString(10), "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+// Inverse returns the rate of the opposite direction.
+func (r Rate) Inverse() Rate {
+	return Rate{rat: new(big.Rat).Inv(r.rat)}
+}
+
+// Mul chains two rates, e.g. EUR->USD and USD->RUB into EUR->RUB.
+func (r Rate) Mul(other Rate) Rate {
+	return Rate{rat: new(big.Rat).Mul(r.rat, other.rat)}
+}
+
+func (r Rate) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.String())
+}
+
+func (r *Rate) UnmarshalJSON(data []byte) error {
+	text := string(data)
+	if strings.HasPrefix(text, `"`) {
+		if err := json.Unmarshal(data, &text); err != nil {
+			return err
+		}
+	}
+
+	parsed, err := ParseRate(text)
+	if err != nil {
+		return err
+	}
+	*r = parsed
+	return nil
+}
+
+func (r *Rate) Scan(src interface{}) error {
+	var text string
+	switch src := src.(type) {
+	case []byte:
+		text = string(src)
+	case string:
+		text = src
+	default:
+		return fmt.Errorf("money: cannot scan %T into Rate", src)
+	}
+
+	parsed, err := ParseRate(text)
+	if err != nil {
+		return err
+	}
+	*r = parsed
+	return nil
+}
+
+func (r Rate) Value() (driver.Value, error) {
+	return r.String(), nil
+}
+
+// Convert multiplies the amount by rate and rounds the result half away from
+// zero to the minor unit of currency.
+func (a Amount) Convert(rate Rate, currency string) Amount {
+	step := int64(1)
+	for i := MinorUnits(currency); i < scale; i++ {
+		step *= 10
+	}
+
+	x := new(big.Rat).Mul(new(big.Rat).SetInt64(int64(a)), rate.rat)
+	x.Quo(x, new(big.Rat).SetInt64(step))
+
+	quotient, remainder := new(big.Int).QuoRem(x.Num(), x.Denom(), new(big.Int))
+	remainder.Abs(remainder).Lsh(remainder, 1)
+	if remainder.Cmp(x.Denom()) >= 0 {
+		if x.Sign() < 0 {
+			quotient.Sub(quotient, big.NewInt(1))
+		} else {
+			quotient.Add(quotient, big.NewInt(1))
+		}
+	}
+
+	return Amount(quotient.Int64() * step)
+}
+
+// Ratio returns the rate that turns the amount into other, e.g. a list price
+// into an explicit price. The amount must not be zero.
+func (a Amount) Ratio(other Amount) Rate {
+	return Rate{rat: big.NewRat(int64(other), int64(a))}
+}
+
+// RateTable finds conversion rates between currencies from a set of known
+// pairs.
+type RateTable map[[2]string]Rate
+
+func (t RateTable) Set(base, quote string, rate Rate) {
+	t[[2]string{base, quote}] = rate
+}
+
+// Lookup returns the rate from one currency to another. Besides the stored
+// pair it uses the inverse pair and, failing both, goes through the catalog
+// currency.
+func (t RateTable) Lookup(from, to string) (Rate, bool) {
+	if rate, ok := t.pair(from, to); ok {
+		return rate, true
+	}
+
+	pivot := DefaultCurrency()
+	if from == pivot || to == pivot {
+		return Rate{}, false
+	}
+	first, ok := t.pair(from, pivot)
+	if !ok {
+		return Rate{}, false
+	}
+	second, ok := t.pair(pivot, to)
+	if !ok {
+		return Rate{}, false
+	}
+	return first.Mul(second), true
+}
+
+func (t RateTable) pair(from, to string) (Rate, bool) {
+	if rate, ok := t[[2]string{from, to}]; ok {
+		return rate, true
+	}
+	if rate, ok := t[[2]string{to, from}]; ok {
+		return rate.Inverse(), true
+	}
+	return Rate{}, false
+}
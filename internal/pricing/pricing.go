@@ -0,0 +1,102 @@
+// Package pricing computes the price a product sells at once promotions are
+// applied.
+//
+// Promotions that are not stackable apply alone. Stackable ones apply
+// together, one after the other in priority order, each to the price left by
+// the previous ones. The cheapest of these options is the effective price.
+package pricing
+
+import (
+	"sort"
+
+	"github.com/say8hi/go-api-test/internal/models"
+	"github.com/say8hi/go-api-test/internal/money"
+)
+
+var hundredth, _ = money.ParseRate("0.01")
+
+// EffectivePrice applies promotions to a price in currency and returns the
+// lowered price with the promotions that lowered it. Promotions are expected
+// to be running and in scope; fixed promotions in another currency are
+// skipped. On a tie the stackable promotions win over a single one, and among
+// single ones the promotion with the highest priority wins.
+func EffectivePrice(price money.Amount, currency string, promotions []models.Promotion) (money.Amount, []models.AppliedPromotion) {
+	candidates := make([]models.Promotion, 0, len(promotions))
+	for _, promotion := range promotions {
+		if promotion.Kind == models.PromotionFixed && promotion.Currency != currency {
+			continue
+		}
+		candidates = append(candidates, promotion)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].Priority != candidates[j].Priority {
+			return candidates[i].Priority > candidates[j].Priority
+		}
+		return candidates[i].ID < candidates[j].ID
+	})
+
+	var stackable []models.Promotion
+	for _, promotion := range candidates {
+		if promotion.Stackable {
+			stackable = append(stackable, promotion)
+		}
+	}
+	best, applied := apply(price, currency, stackable)
+
+	for _, promotion := range candidates {
+		if promotion.Stackable {
+			continue
+		}
+		if lowered, alone := apply(price, currency, []models.Promotion{promotion}); lowered < best {
+			best, applied = lowered, alone
+		}
+	}
+	return best, applied
+}
+
+// apply takes promotions off price in order. Promotions that take nothing off
+// are left out of the result.
+func apply(price money.Amount, currency string, promotions []models.Promotion) (money.Amount, []models.AppliedPromotion) {
+	var applied []models.AppliedPromotion
+	for _, promotion := range promotions {
+		discount := Discount(price, currency, promotion)
+		if discount <= 0 {
+			continue
+		}
+		price -= discount
+		applied = append(applied, models.AppliedPromotion{
+			ID:       promotion.ID,
+			Name:     promotion.Name,
+			Kind:     promotion.Kind,
+			Value:    promotion.Value,
+			Discount: discount,
+		})
+	}
+	return price, applied
+}
+
+// Discount returns the amount promotion takes off a price in currency.
+// Percentages are rounded to the minor unit of currency, and no discount is
+// larger than the price.
+func Discount(price money.Amount, currency string, promotion models.Promotion) money.Amount {
+	var discount money.Amount
+	switch promotion.Kind {
+	case models.PromotionPercentage:
+		// The exact share of the price is rounded once, the way converted
+		// prices are.
+		percentage, err := money.ParseRate(promotion.Value.String())
+		if err != nil {
+			return 0
+		}
+		discount = price.Convert(percentage.Mul(hundredth), currency)
+	case models.PromotionFixed:
+		if promotion.Currency == currency {
+			discount = promotion.Value
+		}
+	}
+
+	if discount > price {
+		discount = price
+	}
+	return discount
+}
@@ -0,0 +1,176 @@
+package rabbitmq
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/say8hi/go-api-test/internal/database"
+	"github.com/say8hi/go-api-test/internal/models"
+	"github.com/streadway/amqp"
+)
+
+const (
+	outboxBatchSize    = 100
+	outboxPollInterval = time.Second
+	publishTimeout     = 5 * time.Second
+
+	defaultOutboxRetention = 7 * 24 * time.Hour
+	outboxPruneInterval    = time.Hour
+	outboxPruneBatchSize   = 1000
+)
+
+type outboxPublisher struct {
+	exchange string
+	conn     *amqp.Connection
+	channel  *amqp.Channel
+	confirms chan amqp.Confirmation
+}
+
+func (p *outboxPublisher) connect() error {
+	conn, err := amqp.Dial(amqpURL())
+	if err != nil {
+		return fmt.Errorf("failed to connect to RabbitMQ: %w", err)
+	}
+
+	ch, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to open a channel: %w", err)
+	}
+
+	err = ch.ExchangeDeclare(
+		p.exchange, // name
+		"topic",    // type
+		true,       // durable
+		false,      // auto-deleted
+		false,      // internal
+		false,      // no-wait
+		nil,        // arguments
+	)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to declare exchange %s: %w", p.exchange, err)
+	}
+
+	if err := ch.Confirm(false); err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to enable publisher confirms: %w", err)
+	}
+
+	p.conn = conn
+	p.channel = ch
+	p.confirms = ch.NotifyPublish(make(chan amqp.Confirmation, 1))
+	return nil
+}
+
+func (p *outboxPublisher) close() {
+	if p.conn != nil {
+		p.conn.Close()
+	}
+	p.conn = nil
+	p.channel = nil
+}
+
+// publish sends one event and waits for the broker to confirm it. Any
+// connection problem drops the connection so the next attempt redials.
+func (p *outboxPublisher) publish(event models.OutboxEvent) error {
+	if p.channel == nil {
+		if err := p.connect(); err != nil {
+			return err
+		}
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	err = p.channel.Publish(
+		p.exchange,      // exchange
+		event.EventType, // routing key
+		false,           // mandatory
+		false,           // immediate
+		amqp.Publishing{
+			ContentType:  "application/json",
+			DeliveryMode: amqp.Persistent,
+			MessageId:    strconv.FormatInt(event.ID, 10),
+			Timestamp:    event.CreatedAt,
+			Type:         event.EventType,
+			Headers: amqp.Table{
+				"aggregate_type": event.AggregateType,
+				"aggregate_id":   int64(event.AggregateID),
+			},
+			Body: body,
+		})
+	if err != nil {
+		p.close()
+		return fmt.Errorf("failed to publish event %d: %w", event.ID, err)
+	}
+
+	select {
+	case confirm, ok := <-p.confirms:
+		if !ok {
+			p.close()
+			return errors.New("channel closed before the publish was confirmed")
+		}
+		if !confirm.Ack {
+			return fmt.Errorf("broker rejected event %d", event.ID)
+		}
+	case <-time.After(publishTimeout):
+		p.close()
+		return fmt.Errorf("timed out waiting for confirmation of event %d", event.ID)
+	}
+
+	return nil
+}
+
+// RunOutboxRelay publishes outbox events to the catalog exchange until the
+// process exits. While the broker is unavailable events stay in the outbox.
+// Published events are deleted once they are older than the retention.
+func RunOutboxRelay() {
+	exchange := os.Getenv("OUTBOX_EXCHANGE")
+	if exchange == "" {
+		exchange = "catalog.events"
+	}
+	publisher := &outboxPublisher{exchange: exchange}
+	retention := outboxRetention()
+
+	var lastPrune time.Time
+	for {
+		published, err := database.RelayOutbox(outboxBatchSize, publisher.publish)
+		if err != nil {
+			log.Printf("Outbox relay: %s", err)
+		}
+
+		if time.Since(lastPrune) >= outboxPruneInterval {
+			if _, err := database.PruneOutbox(retention, outboxPruneBatchSize); err != nil {
+				log.Printf("Outbox pruning: %s", err)
+			}
+			lastPrune = time.Now()
+		}
+
+		if published < outboxBatchSize {
+			time.Sleep(outboxPollInterval)
+		}
+	}
+}
+
+// outboxRetention reads OUTBOX_RETENTION_HOURS, how long published events
+// are kept.
+func outboxRetention() time.Duration {
+	value := os.Getenv("OUTBOX_RETENTION_HOURS")
+	if value == "" {
+		return defaultOutboxRetention
+	}
+	hours, err := strconv.Atoi(value)
+	if err != nil || hours < 0 {
+		log.Printf("Invalid OUTBOX_RETENTION_HOURS %q, using %s", value, defaultOutboxRetention)
+		return defaultOutboxRetention
+	}
+	return time.Duration(hours) * time.Hour
+}
@@ -5,20 +5,24 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"time"
 
 	"github.com/say8hi/go-api-test/internal/database"
 	"github.com/say8hi/go-api-test/internal/models"
 	"github.com/streadway/amqp"
 )
 
-func InitRabbitMQ() *amqp.Channel {
-	amqpUrl := fmt.Sprintf("amqp://%s:%s@%s:%s/",
+func amqpURL() string {
+	return fmt.Sprintf("amqp://%s:%s@%s:%s/",
 		os.Getenv("RMQ_USER"),
 		os.Getenv("RMQ_PASSWORD"),
 		os.Getenv("RMQ_HOST"),
 		os.Getenv("RMQ_PORT"),
 	)
-	conn, err := amqp.Dial(amqpUrl)
+}
+
+func InitRabbitMQ() *amqp.Channel {
+	conn, err := amqp.Dial(amqpURL())
 	if err != nil {
 		log.Fatalf("Failed to connect to RabbitMQ: %s", err)
 	}
@@ -61,7 +65,7 @@ func ConsumeMessages(channel *amqp.Channel, queueName string) {
 
 	go func() {
 		for d := range msgs {
-			var products []models.Product
+			var products []models.IngestProduct
 			if err := json.Unmarshal(d.Body, &products); err != nil {
 				log.Printf("Error decoding JSON: %s", err)
 				continue
@@ -69,9 +73,19 @@ func ConsumeMessages(channel *amqp.Channel, queueName string) {
 
 			log.Printf("Received %v products from datacollector", len(products))
 
-			if err := database.ProcessProducts(products); err != nil {
+			// The datacollector stamps a batch with the time it fetched it.
+			observedAt := d.Timestamp
+			if observedAt.IsZero() {
+				observedAt = time.Now()
+			}
+
+			report, err := database.ProcessProducts(products, observedAt)
+			if err != nil {
 				log.Printf("Failed to process products: %s", err)
+				continue
 			}
+			log.Printf("Processed products: %d inserted, %d updated, %d unchanged, %d skipped",
+				report.Inserted, report.Updated, report.Unchanged, report.Skipped)
 		}
 	}()
 
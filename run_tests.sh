@@ -2,7 +2,7 @@
 
 docker-compose -f tests/docker-compose.test.yml up -d
 
-sleep 10
+sleep 20
 
 go test -v ./tests/
 TEST_STATUS=$?
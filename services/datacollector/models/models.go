@@ -19,11 +19,14 @@ type Tag struct {
     Name string `json:"name"`
 }
 
+// Product is sent to the API for ingestion. Petstore has no description or
+// price, so the product carries neither and the API keeps the catalog values.
 type Product struct {
     Name        string   `json:"name"`
-    Description string   `json:"description,omitempty"`
-    Price       float64  `json:"price,omitempty"`       
+    Status      string   `json:"status,omitempty"`
     Categories  []Category `json:"categories"`
+    Images      []string   `json:"images,omitempty"`
+    Tags        []string   `json:"tags,omitempty"`
 }
 
 type Category struct {
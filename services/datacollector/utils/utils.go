@@ -9,9 +9,10 @@ import (
 	"os"
 	"service-datacollector/models"
 	"strconv"
+	"time"
 )
 
-func publishToRabbitMQ(products []models.Product) {
+func publishToRabbitMQ(products []models.Product, fetchedAt time.Time) {
 	amqpUrl := fmt.Sprintf("amqp://%s:%s@%s:%s/",
 		os.Getenv("RMQ_USER"),
 		os.Getenv("RMQ_PASSWORD"),
@@ -54,6 +55,7 @@ func publishToRabbitMQ(products []models.Product) {
       false,  // immediate
       amqp.Publishing{
           ContentType: "application/json",
+          Timestamp:   fetchedAt,
           Body:        body,
       })
 		if err != nil {
@@ -61,8 +63,16 @@ func publishToRabbitMQ(products []models.Product) {
 		}
 }
 
+// productStatuses maps petstore pet statuses onto catalog product statuses.
+var productStatuses = map[string]string{
+	"available": "active",
+	"pending":   "draft",
+	"sold":      "archived",
+}
+
 func FetchData() {
 	url := "https://petstore.swagger.io/v2/pet/findByStatus?status=available"
+	fetchedAt := time.Now()
 	resp, err := http.Get(url)
 	if err != nil {
 		log.Fatalf("Error fetching data: %s", err)
@@ -76,16 +86,24 @@ func FetchData() {
 
 	var products []models.Product
 	for _, pet := range pets {
+		var tags []string
+		for _, tag := range pet.Tags {
+			if tag.Name != "" {
+				tags = append(tags, tag.Name)
+			}
+		}
 		product := models.Product{
 			Name:        pet.Name,
-			Description: pet.Status,
+			Status:      productStatuses[pet.Status],
 			Categories: []models.Category{{
 				Name:        pet.Category.Name,
 				Description: strconv.FormatInt(pet.Category.ID, 10),
 			}},
+			Images: pet.PhotoUrls,
+			Tags:   tags,
 		}
 		products = append(products, product)
 	}
-	publishToRabbitMQ(products)
+	publishToRabbitMQ(products, fetchedAt)
 	log.Printf("Processed %d products", len(products))
 }